@@ -3,7 +3,10 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 
+	"gofi/pkg/daemon"
+	gofidesktop "gofi/pkg/desktop"
 	"gofi/pkg/gofi"
 	"gofi/pkg/log"
 )
@@ -11,26 +14,71 @@ import (
 func main() {
 	logLevel := flag.String("log", "info", "Set logging level (off, error, warning, info, debug)")
 	kill := flag.Bool("kill", false, "Kill running gofi instance")
+	events := flag.Bool("events", false, "Print window events of the running gofi instance as JSON lines")
+	action := flag.String("action", "", "Run a window action on the running gofi instance (activate, minimize, pull, send, maximized, fullscreen, above, sticky, ...)")
+	window := flag.String("window", "", "Window ID for -action, decimal or 0x prefixed hex")
+	monitor := flag.String("monitor", "", "Only list windows on this monitor, e.g. DP-1, or current for the monitor of the active window")
+	desktop := flag.Int("desktop", -1, "Target desktop for -action send")
+	sortMode := flag.String("sort", daemon.SortMRU, "Window order: mru (most recently used first) or stacking (topmost first)")
+	backend := flag.String("backend", gofidesktop.BackendAuto, "Window manager backend: "+gofidesktop.BackendAuto+" or one of "+strings.Join(gofidesktop.BackendNames(), ", "))
+	closeTimeout := flag.Duration("close-timeout", gofidesktop.DefaultCloseTimeout, "Time a closed window gets to close before it is left open, or killed if it stopped answering pings")
+	record := flag.String("record", "", "Record the window manager session to a trace file for replay in tests")
 	flag.Parse()
 
 	log.SetupLogger(*logLevel, false)
 
+	if err := gofidesktop.SelectBackend(*backend); err != nil {
+		log.Error("%s", err)
+		os.Exit(1)
+	}
+
 	if *kill {
 		log.Debug("Killing gofi instance")
 		gofi.KillInstance()
 		os.Exit(0)
 	}
 
+	if *action != "" {
+		if err := gofi.RunAction(*action, *window, *desktop); err != nil {
+			log.Error("Action %s failed: %s", *action, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *events {
+		if err := gofi.StreamEvents(os.Stdout); err != nil {
+			log.Error("Event stream ended: %s", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	options := daemon.WindowListParams{Monitor: *monitor, Sort: *sortMode}
+	if err := options.Validate(); err != nil {
+		log.Error("%s", err.Message)
+		os.Exit(1)
+	}
+
 	instanceManager := gofi.NewInstanceManager()
 	defer instanceManager.Cleanup()
 
-	if instanceManager.CheckExistingInstance() {
+	running, err := instanceManager.CheckExistingInstance(options)
+	if err != nil {
+		log.Error("%s", err)
+		os.Exit(1)
+	}
+	if running {
 		log.Debug("Another instance already running, signaled and exiting")
 		os.Exit(0)
 	}
 
 	app := gofi.NewApp()
 	defer app.Cleanup()
+	app.SetCloseTimeout(*closeTimeout)
+	if *record != "" {
+		app.SetRecordFile(*record)
+	}
 
 	if err := instanceManager.StartIPCServer(app); err != nil {
 		log.Error("Failed to start IPC server: %s", err)
@@ -42,6 +90,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	app.Show()
+	app.Show(options)
 	app.Run()
 }
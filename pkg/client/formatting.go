@@ -11,6 +11,8 @@ import (
 // ColumnOrder defines the order of columns in the formatted output
 var ColumnOrder = []string{
 	"desktop",
+	"monitor",
+	"state",
 	"instance",
 	"title",
 	"class",
@@ -19,7 +21,9 @@ var ColumnOrder = []string{
 
 // ColumnWidths defines the width of each column
 var ColumnWidths = map[string]int{
-	"desktop":  4,  // e.g., "[0] "
+	"desktop":  8,  // e.g., "[mail]  "
+	"monitor":  8,  // e.g., "HDMI-1"
+	"state":    1,  // e.g., "_" for hidden windows
 	"instance": 20, // Increased width
 	"title":    55,
 	"class":    18, // Increased width
@@ -49,6 +53,9 @@ func FormatWindows(
 	}
 	if order == nil {
 		order = ColumnOrder
+		if !multipleMonitors(windows) {
+			order = withoutColumn(order, "monitor")
+		}
 	}
 
 	lines := make([]string, len(windows))
@@ -60,6 +67,42 @@ func FormatWindows(
 	return lines
 }
 
+// multipleMonitors checks if the windows are spread over more than one monitor
+// Args:
+//
+//	windows: List of windows
+//
+// Returns:
+//
+//	bool: True if at least two different monitors are used
+func multipleMonitors(windows []shared.Window) bool {
+	for _, window := range windows {
+		if window.Monitor != windows[0].Monitor {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutColumn returns a copy of the column order without one column
+// Args:
+//
+//	order: Column order
+//	column: Column to leave out
+//
+// Returns:
+//
+//	[]string: Column order without the column
+func withoutColumn(order []string, column string) []string {
+	result := make([]string, 0, len(order))
+	for _, key := range order {
+		if key != column {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
 // formatWindow formats a single window
 // Args:
 //
@@ -88,9 +131,13 @@ func formatWindow(window shared.Window, widths map[string]int) map[string]string
 	classFitted := fitColumn(className, widths["class"])
 	titleFitted := fitColumn(title, widths["title"])
 	desktopFitted := fitColumn(desktop, widths["desktop"])
+	stateFitted := fitColumn(window.StateStr(), widths["state"])
+	monitorFitted := fitColumn(window.Monitor, widths["monitor"])
 
 	return map[string]string{
 		"desktop":   desktopFitted,
+		"state":     stateFitted,
+		"monitor":   monitorFitted,
 		"instance":  instanceFitted,
 		"title":     titleFitted,
 		"class":     classFitted,
@@ -9,6 +9,8 @@ import (
 
 var testWidths = map[string]int{
 	"desktop":  4,
+	"state":    1,
+	"monitor":  4,
 	"instance": 20,
 	"title":    20,
 	"class":    18,
@@ -47,6 +49,7 @@ func TestFormatWindows(t *testing.T) {
 			w.ClassName = "Class2"
 			w.Instance = "Instance2"
 			w.Desktop = 2
+			w.State = shared.StateHidden
 		}),
 	}
 
@@ -55,8 +58,8 @@ func TestFormatWindows(t *testing.T) {
 	if len(result) != 2 {
 		t.Fatalf("formatWindows length incorrect: got %d, want 2", len(result))
 	}
-	expected1 := "[1]  i1                   Win1                 Class1             0x1"
-	expected2 := "[2]  Class2               LongWindowTitle Need Instance2          0x2"
+	expected1 := "[1]    i1                   Win1                 Class1             0x1"
+	expected2 := "[2]  _ Class2               LongWindowTitle Need Instance2          0x2"
 
 	if result[0] != expected1 {
 		t.Errorf("formatWindows first window incorrect:\n GOT: %q\nWANT: %q", result[0], expected1)
@@ -66,6 +69,39 @@ func TestFormatWindows(t *testing.T) {
 	}
 }
 
+func TestFormatWindowsMonitorColumn(t *testing.T) {
+	windows := []shared.Window{
+		*makeWindow(t, func(w *shared.Window) {
+			w.ID = 1
+			w.Title = "Win1"
+			w.ClassName = "Class1"
+			w.Instance = "i1"
+			w.Monitor = "DP-1"
+		}),
+		*makeWindow(t, func(w *shared.Window) {
+			w.ID = 2
+			w.Title = "Win2"
+			w.ClassName = "Class2"
+			w.Instance = "i2"
+			w.Monitor = "DP-2"
+		}),
+	}
+
+	result := client.FormatWindows(windows, testWidths, nil)
+	expected := "[1]  DP-2   i2                   Win2                 Class2             0x2"
+	if result[1] != expected {
+		t.Errorf("formatWindows monitor column incorrect:\n GOT: %q\nWANT: %q", result[1], expected)
+	}
+
+	// A single monitor is not worth a column
+	windows[1].Monitor = "DP-1"
+	result = client.FormatWindows(windows, testWidths, nil)
+	expected = "[1]    i2                   Win2                 Class2             0x2"
+	if result[1] != expected {
+		t.Errorf("formatWindows single monitor incorrect:\n GOT: %q\nWANT: %q", result[1], expected)
+	}
+}
+
 func TestFormatWindowsEmpty(t *testing.T) {
 	result := client.FormatWindows([]shared.Window{}, testWidths, nil)
 
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
+	"gofi/pkg/desktop"
 	"gofi/pkg/log"
 	"gofi/pkg/shared"
 )
@@ -13,22 +15,58 @@ import (
 // FuzzyFinder is the command used for fuzzy finding. Can be replaced for testing.
 var FuzzyFinder = "fzf"
 
+// GofiCommand is the gofi binary used by window action key bindings.
+// Defaults to the running executable when empty.
+var GofiCommand = ""
+
 // SelectWindow shows GUI for window selection using fzf in st terminal
 // Args:
 //
 //	windows: List of windows to select from
+//	caps: Window manager capabilities, keys for missing features are left out
+//	tuiFlag: Whether to run in the current terminal instead of st
 //
 // Returns:
 //
-//	*shared.Window: Selected window or nil
-func SelectWindow(windows []shared.Window, tuiFlag bool) {
+//	int: Selected window ID or 0 if nothing was selected
+func SelectWindow(windows []shared.Window, caps desktop.Capabilities, tuiFlag bool) int {
 	formattedLines := FormatWindows(windows, nil, nil)
 	tempFiles := createTempFiles()
+	if tempFiles == nil {
+		return 0
+	}
 	defer cleanupTempFiles(tempFiles)
 
 	writeWindowList(formattedLines, tempFiles["list"])
-	createFzfScript(tempFiles)
+	createFzfScript(tempFiles, caps)
 	runTerminalWithFzf(tempFiles["exec"], tuiFlag)
+	return readSelection(tempFiles["result"])
+}
+
+// readSelection reads the selected window ID written by the fzf script
+// Args:
+//
+//	resultFile: Path to result file
+//
+// Returns:
+//
+//	int: Selected window ID or 0 if nothing was selected
+func readSelection(resultFile string) int {
+	data, err := os.ReadFile(resultFile)
+	if err != nil {
+		log.Error("Failed to read selection: %s", err)
+		return 0
+	}
+	selected := strings.TrimSpace(string(data))
+	if selected == "" {
+		return 0
+	}
+	id, err := strconv.ParseInt(selected, 0, 64)
+	if err != nil {
+		log.Error("Invalid window ID in selection %q: %s", selected, err)
+		return 0
+	}
+	return int(id)
 }
 
 // createTempFiles creates temporary files for fzf script
@@ -64,7 +102,8 @@ func writeWindowList(formattedLines []string, listFile string) {
 // Args:
 //
 //	tempFiles: Map of temporary files
-func createFzfScript(tempFiles map[string]string) {
+//	caps: Window manager capabilities
+func createFzfScript(tempFiles map[string]string, caps desktop.Capabilities) {
 	script := fmt.Sprintf(`#!/bin/bash
 
 get_win_id() {
@@ -72,19 +111,20 @@ get_win_id() {
 }
 export -f get_win_id
 
-kill_window() {
-    xargs xkill -id >> /tmp/gofi.log 2>&1
+window_action() {
+    local action=$1
+    shift
+    get_win_id | xargs -r -I%% '%s' --action "$action" --window %% "$@" >> /tmp/gofi.log 2>&1
 }
-export -f kill_window
+export -f window_action
 
 # Catppuccin Mocha colors
 export FZF_DEFAULT_OPTS="
   --color=bg+:#313244,bg:#1e1e2e,spinner:#f5e0dc,hl:#f38ba8
   --color=fg:#cdd6f4,header:#f38ba8,info:#cba6f7,pointer:#f5e0dc
   --color=marker:#f5e0dc,fg+:#cdd6f4,prompt:#cba6f7,hl+:#f38ba8
-  --bind='alt-x:execute(echo {{+}} | get_win_id | kill_window >> /tmp/gofi.log 2>&1)+abort'
-"
-
+%s"
+%s
 # Use wmctrl to activate SKIP_TASKBAR
 gofi=$(xdotool search --name '^gofi$')
 if [ -n "$gofi" ]; then
@@ -94,9 +134,8 @@ fi
 selected=$(cat %s | %s | sed 's/.*0x/0x/g')
 if [ -n "$selected" ]; then
     echo "$selected" > %s
-    wmctrl -i -a $selected
 fi
-`, tempFiles["list"], FuzzyFinder, tempFiles["result"])
+`, gofiCommand(), fzfBindings(caps), fzfDesktopBindings(caps), tempFiles["list"], FuzzyFinder, tempFiles["result"])
 
 	file, err := os.Create(tempFiles["exec"])
 	if err != nil {
@@ -115,6 +154,88 @@ fi
 	}
 }
 
+// keyBinding is a selector key running a window action
+type keyBinding struct {
+	key    string
+	action string
+	abort  bool                            // Close the selector afterwards
+	usable func(desktop.Capabilities) bool // Nil if always available
+}
+
+// keyBindings are the selector keys, see the README
+var keyBindings = []keyBinding{
+	{"alt-x", "close", true, nil},
+	{"alt-k", "kill", true, nil},
+	{"alt-n", "minimize", true, nil},
+	{"alt-m", "maximized", false, hasState(shared.StateMaximized)},
+	{"alt-f", "fullscreen", false, hasState(shared.StateFullscreen)},
+	{"alt-t", "above", false, hasState(shared.StateAbove)},
+	{"alt-s", "sticky", false, hasState(shared.StateSticky)},
+	{"alt-p", "pull", true, nil},
+}
+
+// hasState checks if the window manager can change a window state
+func hasState(state shared.WindowState) func(desktop.Capabilities) bool {
+	return func(caps desktop.Capabilities) bool { return caps.HasState(state) }
+}
+
+// fzfBindings returns the --bind options of all usable key bindings
+// Args:
+//
+//	caps: Window manager capabilities
+//
+// Returns:
+//
+//	string: One option per line
+func fzfBindings(caps desktop.Capabilities) string {
+	var lines strings.Builder
+	for _, b := range keyBindings {
+		if b.usable != nil && !b.usable(caps) {
+			continue
+		}
+		abort := ""
+		if b.abort {
+			abort = "+abort"
+		}
+		fmt.Fprintf(&lines, "  --bind='%s:execute-silent(echo {} | window_action %s)%s'\n", b.key, b.action, abort)
+	}
+	return lines.String()
+}
+
+// fzfDesktopBindings returns the script lines binding Alt-1 to Alt-9 to
+// sending the window to a desktop, empty without desktop support
+// Args:
+//
+//	caps: Window manager capabilities
+//
+// Returns:
+//
+//	string: Script lines
+func fzfDesktopBindings(caps desktop.Capabilities) string {
+	if !caps.Has("_NET_WM_DESKTOP") {
+		return ""
+	}
+	return `# Alt-1 to Alt-9 send the window to desktop 1 to 9
+for i in 1 2 3 4 5 6 7 8 9; do
+    FZF_DEFAULT_OPTS+=" --bind='alt-$i:execute-silent(echo {} | window_action send --desktop $((i - 1)))'"
+done
+`
+}
+
+// gofiCommand returns the gofi binary for the fzf script
+// Returns:
+//
+//	string: GofiCommand, the running executable or "gofi" as last resort
+func gofiCommand() string {
+	if GofiCommand != "" {
+		return GofiCommand
+	}
+	if executable, err := os.Executable(); err == nil {
+		return executable
+	}
+	return "gofi"
+}
+
 // runTerminalWithFzf runs st terminal with the fzf script
 // Args:
 //
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"gofi/pkg/client" // Import the package being tested
+	"gofi/pkg/desktop"
 	"gofi/pkg/shared"
 )
 
@@ -37,12 +38,11 @@ func TestSelectWindowWithSimpleFinder(t *testing.T) {
 		},
 	}
 
-	// Call SelectWindow (it returns void)
-	client.SelectWindow(windows, true)
-
-	// Since SelectWindow returns void, we cannot check the selected window here.
-	// This test now only verifies that the function runs without panic
-	// when using the mock fuzzy finder.
+	// head -n1 selects the first window
+	selected := client.SelectWindow(windows, desktop.FullCapabilities("test"), true)
+	if selected != 0x12345678 {
+		t.Errorf("Selected window incorrect: got 0x%x, want 0x12345678", selected)
+	}
 }
 
 /* // Remove tests for unexported helper functions
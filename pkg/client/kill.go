@@ -2,23 +2,30 @@ package client
 
 import (
 	"os"
-	"os/exec"
+	"time"
 
 	"gofi/pkg/desktop"
 	"gofi/pkg/log"
 	"gofi/pkg/shared"
 )
 
-// KillExistingGofiWindows finds and kills any existing gofi windows
+// KillExistingGofiWindows finds and closes any existing gofi windows.
+// They are ours to replace, so a window still open after the timeout is
+// killed even if it answers pings.
 // Args:
 //
 //	ours: List of window titles to kill
-func KillExistingGofiWindows(ours []string) {
+//	timeout: Time a gofi window gets to close before it is killed
+func KillExistingGofiWindows(ours []string, timeout time.Duration) {
 	if ours == nil {
 		ours = []string{"gofi", "pofi", "rofi"}
 	}
 
-	wm := desktop.Instance()
+	wm, err := desktop.Instance()
+	if err != nil {
+		log.Error("Failed to close gofi windows: %v", err)
+		return
+	}
 	windows := wm.StackingList()
 
 	// Find gofi windows
@@ -29,39 +36,26 @@ func KillExistingGofiWindows(ours []string) {
 		}
 	}
 
-	// Kill each gofi window
+	// Close each gofi window, killing it if it does not react
 	for _, window := range gofis {
-		log.Debug("Killing gofi window: %s", window.Title)
+		log.Debug("Closing gofi window: %s", window.Title)
 
-		if KillWindowWmctrl(*window) {
-			continue
-		}
-		if KillWindowXkill(*window) {
-			continue
+		options := desktop.CloseOptions{Timeout: timeout, KillOnTimeout: true}
+		if err := desktop.CloseOrKillWindow(wm, window.ID, options); err != nil {
+			log.Error("Failed to kill window %s: %s", window.Title, err)
 		}
-		log.Error("Failed to kill window: %s", window.Title)
 	}
 }
 
-// KillWindow kills a window by its ID
-// Args:
-//
-//	windowID: Window ID to kill
-//
-// Returns:
-//
-//	error: Error if any
-func KillWindow(windowID string) error {
-	cmd := exec.Command("xkill", "-id", windowID)
-	return cmd.Run()
-}
-
 // KillStWindows kills all st terminal windows except the current one
 // Returns:
 //
 //	error: Error if any
 func KillStWindows() error {
-	wm := desktop.Instance()
+	wm, err := desktop.Instance()
+	if err != nil {
+		return err
+	}
 	windows := wm.StackingList()
 
 	ours := []string{
@@ -71,7 +65,7 @@ func KillStWindows() error {
 
 	for _, window := range windows {
 		if containsStr(ours, window.Title) && isStWindow(window.ClassName) {
-			if err := KillWindow(window.HexID()); err != nil {
+			if err := wm.KillWindow(window.ID); err != nil {
 				log.Error("Failed to kill window %s: %s", window.HexID(), err)
 			}
 		}
@@ -1,39 +1,194 @@
 package daemon
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gofi/pkg/desktop"
+	"gofi/pkg/log"
 	"gofi/pkg/shared"
 )
 
+// processKillWait is how long a hung process gets to exit after SIGTERM
+const processKillWait = 500 * time.Millisecond
+
 type API struct {
-	windows    *WindowList
-	autoCloser *GofiAutoCloser
-	mutex      sync.RWMutex
+	wm           desktop.WindowManager
+	windows      *WindowList
+	autoCloser   *GofiAutoCloser
+	events       *EventBus
+	snapshot     atomic.Pointer[Snapshot] // Last published window list
+	changes      changeLog                // Events of the latest generations
+	closeTimeout time.Duration            // Time to wait for a closed window, see SetCloseTimeout
+	mutex        sync.RWMutex
 }
 
-func NewAPI() *API {
-	wm := desktop.Instance()
+// NewAPI creates a new API instance
+// Args:
+//
+//	wm: Window manager to act on, see desktop.Instance
+//
+// Returns:
+//
+//	*API: New API instance
+//	error: Error if no window manager is given
+func NewAPI(wm desktop.WindowManager) (*API, error) {
+	if wm == nil {
+		return nil, fmt.Errorf("no window manager given")
+	}
 	autoCloser := NewGofiAutoCloser(wm)
 	windows := NewWindowList(wm, NewHistory())
 
-	return &API{
-		windows:    windows,
-		autoCloser: autoCloser,
+	api := &API{
+		wm:           wm,
+		windows:      windows,
+		autoCloser:   autoCloser,
+		events:       NewEventBus(),
+		closeTimeout: desktop.DefaultCloseTimeout,
 	}
+	api.snapshot.Store(newSnapshot(nil, nil, 0, -1))
+	return api, nil
 }
 
-func (api *API) ClientList() []*shared.Window {
+// windowManager returns the current window manager, see Reconnect
+func (api *API) windowManager() desktop.WindowManager {
 	api.mutex.RLock()
 	defer api.mutex.RUnlock()
-	return api.windows.ClientList()
+	return api.wm
+}
+
+// Reconnect switches to a new window manager connection after the old one
+// was lost. Windows that still exist keep their place in the history.
+// Args:
+//
+//	wm: Window manager of the new connection
+func (api *API) Reconnect(wm desktop.WindowManager) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	api.wm = wm
+	api.autoCloser = NewGofiAutoCloser(wm)
+	logCapabilities(wm.Capabilities())
+	api.windows.Reconnect(wm)
+	api.publishChanges()
+}
+
+// Capabilities reports the window manager and the features it supports
+// Returns:
+//
+//	desktop.Capabilities: The capability set
+func (api *API) Capabilities() desktop.Capabilities {
+	return api.windowManager().Capabilities()
+}
+
+// UpdateCapabilities rescans the window list after the window manager was
+// replaced or changed its features
+func (api *API) UpdateCapabilities() {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	logCapabilities(api.wm.Capabilities())
+	api.windows.UpdateWindowList()
+	api.autoCloser.CheckFocusAndClose()
+	api.publishChanges()
+}
+
+// logCapabilities reports the window manager and the features gofi has to
+// do without
+func logCapabilities(caps desktop.Capabilities) {
+	log.Info("Window manager: %s", caps)
+	if !caps.Has("_NET_CLIENT_LIST") {
+		log.Warn("The window manager does not list client windows, searching the window tree instead")
+	}
+	if !caps.Has("_NET_ACTIVE_WINDOW") {
+		log.Warn("The window manager does not report the active window, following the input focus instead")
+	}
+	if !caps.Has("_NET_WM_DESKTOP", "_NET_CURRENT_DESKTOP") {
+		log.Warn("No desktop support, windows cannot be moved between desktops")
+	}
+}
+
+func (api *API) ClientList() []*shared.Window {
+	return api.ListWindows(WindowListParams{})
+}
+
+// ListWindows returns the client list filtered and ordered by the options
+// Args:
+//
+//	options: Monitor filter and sort mode, see WindowListParams
+//
+// Returns:
+//
+//	[]*shared.Window: Matching windows
+func (api *API) ListWindows(options WindowListParams) []*shared.Window {
+	return api.ListSnapshot(options).Windows
+}
+
+// ListSnapshot is ListWindows with the generation of the listed windows
+// Args:
+//
+//	options: Monitor filter and sort mode, see WindowListParams
+//
+// Returns:
+//
+//	SnapshotResult: Generation and matching windows
+func (api *API) ListSnapshot(options WindowListParams) SnapshotResult {
+	snapshot := api.Snapshot()
+	return SnapshotResult{
+		Generation: snapshot.Generation,
+		Windows:    snapshot.List(options, api.windowManager().DesktopNames()),
+	}
+}
+
+// Snapshot returns the last published window list without locking.
+// The snapshot never changes, updates publish a new one.
+// Returns:
+//
+//	*Snapshot: Current snapshot, generation 0 before the list was initialized
+func (api *API) Snapshot() *Snapshot {
+	return api.snapshot.Load()
+}
+
+// Changes returns the events published after a generation
+// Args:
+//
+//	since: Generation the caller knows, e.g. from a snapshot
+//
+// Returns:
+//
+//	[]Event: Events in order, nil if nothing changed
+//	uint64: Latest generation
+//	bool: False if the generation is unknown or too old, the caller has to
+//	      take a new snapshot instead
+func (api *API) Changes(since uint64) ([]Event, uint64, bool) {
+	return api.changes.since(since)
+}
+
+// Monitors lists the monitors of the window manager
+// Returns:
+//
+//	[]shared.Monitor: Monitors, never nil so it encodes as an array
+func (api *API) Monitors() []shared.Monitor {
+	monitors := api.windowManager().Monitors()
+	if monitors == nil {
+		monitors = []shared.Monitor{}
+	}
+	return monitors
 }
 
 func (api *API) InitializeWindowList() {
 	api.mutex.Lock()
 	defer api.mutex.Unlock()
+	logCapabilities(api.wm.Capabilities())
 	api.windows.Initialize()
+	// The initial list is not announced as events, clients start from it
+	previous := api.snapshot.Load()
+	next := api.windows.snapshot()
+	next.Generation = previous.Generation + 1
+	api.snapshot.Store(next)
+	api.changes.reset(next.Generation)
 }
 
 func (api *API) UpdateWindowList() {
@@ -42,4 +197,350 @@ func (api *API) UpdateWindowList() {
 
 	api.windows.UpdateWindowList()
 	api.autoCloser.CheckFocusAndClose()
+	api.publishChanges()
+}
+
+// SyncClientList updates the window list after the set of client windows
+// changed, fetching only new windows
+func (api *API) SyncClientList() {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	api.windows.SyncClientList()
+	api.autoCloser.CheckFocusAndClose()
+	api.publishChanges()
+}
+
+// UpdateActiveWindow updates the history after the active window changed
+func (api *API) UpdateActiveWindow() {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if api.windows.UpdateActiveWindow() {
+		api.autoCloser.CheckFocusAndClose()
+		api.publishChanges()
+	}
+}
+
+// UpdateCurrentDesktop re-reads the current desktop after another desktop
+// was shown and publishes a current-desktop-changed event
+func (api *API) UpdateCurrentDesktop() {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if api.windows.UpdateCurrentDesktop() {
+		api.publishChanges()
+	}
+}
+
+// UpdateStacking re-reads the stacking order after windows were raised or lowered.
+// Only the stacking sort mode depends on it, a new generation is published
+// without events.
+func (api *API) UpdateStacking() {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if api.windows.UpdateStacking() {
+		api.publishChanges()
+	}
+}
+
+// UpdateWindowProperty re-reads a single changed property of one window
+// Args:
+//
+//	windowID: ID of the window
+//	atom: Name of the changed property, e.g. "_NET_WM_NAME"
+func (api *API) UpdateWindowProperty(windowID int, atom string) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if api.windows.UpdateProperty(windowID, atom) {
+		api.publishChanges()
+	}
+}
+
+// UpdateWindowGeometry re-reads the geometry of one window after it was
+// moved or resized
+// Args:
+//
+//	windowID: ID of the window
+func (api *API) UpdateWindowGeometry(windowID int) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if api.windows.UpdateGeometry(windowID) {
+		api.publishChanges()
+	}
+}
+
+// UpdateMonitors re-reads the monitors after outputs were added, removed
+// or rearranged
+func (api *API) UpdateMonitors() {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if api.windows.UpdateMonitors() {
+		api.publishChanges()
+	}
+}
+
+// Subscribe registers for window events
+// Args:
+//
+//	types: Event types to receive, all types if empty
+//
+// Returns:
+//
+//	*Subscription: New subscription, cancel it when done
+func (api *API) Subscribe(types []EventType) *Subscription {
+	return api.events.Subscribe(types)
+}
+
+// publishChanges publishes a new snapshot if the window list changed and
+// sends the events since the last one. Callers hold the write lock.
+func (api *API) publishChanges() {
+	previous := api.snapshot.Load()
+	next := api.windows.snapshot()
+	if next.sameState(previous) {
+		return
+	}
+	events := diffEvents(previous, next)
+	next.Generation = previous.Generation + 1
+	api.snapshot.Store(next)
+	api.changes.add(next.Generation, events)
+	api.events.Publish(events)
+}
+
+// ActivateWindow activates a window through the window manager
+// Args:
+//
+//	windowID: ID of the window to activate
+//
+// Returns:
+//
+//	error: Error if the window could not be activated
+func (api *API) ActivateWindow(windowID int) error {
+	return api.windowManager().ActivateWindow(windowID)
+}
+
+// Desktops describes the desktops of the window manager
+// Returns:
+//
+//	DesktopsResult: Desktop count, names and current desktop
+func (api *API) Desktops() DesktopsResult {
+	return DesktopsResult{
+		Count:   api.windowManager().DesktopCount(),
+		Names:   api.windowManager().DesktopNames(),
+		Current: api.windowManager().CurrentDesktop(),
+	}
+}
+
+// SwitchDesktop switches to another desktop
+// Args:
+//
+//	desktop: Index of the desktop to switch to
+//
+// Returns:
+//
+//	error: Error if the desktop could not be switched
+func (api *API) SwitchDesktop(desktop int) error {
+	return api.windowManager().SwitchDesktop(desktop)
+}
+
+// MoveWindowToDesktop moves a window to another desktop.
+// The history is updated right away and a desktop-changed event is published.
+// Args:
+//
+//	windowID: ID of the window to move
+//	desktop: Index of the target desktop
+//
+// Returns:
+//
+//	error: Error if the window could not be moved
+func (api *API) MoveWindowToDesktop(windowID int, desktop int) error {
+	if err := api.windowManager().MoveWindowToDesktop(windowID, desktop); err != nil {
+		return err
+	}
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.windows.MoveWindow(windowID, desktop)
+	api.publishChanges()
+	return nil
+}
+
+// PullWindow moves a window to the current desktop and activates it
+// Args:
+//
+//	windowID: ID of the window to pull
+//
+// Returns:
+//
+//	error: Error if the window could not be moved or activated
+func (api *API) PullWindow(windowID int) error {
+	wm := api.windowManager()
+	current := wm.CurrentDesktop()
+	if current >= 0 && wm.Capabilities().Has("_NET_WM_DESKTOP") && api.needsMove(windowID, current) {
+		if err := api.MoveWindowToDesktop(windowID, current); err != nil {
+			return err
+		}
+	}
+	return wm.ActivateWindow(windowID)
+}
+
+// needsMove checks if a window is shown on another desktop than the given one.
+// Sticky windows are shown everywhere, unknown windows are left to the window manager.
+func (api *API) needsMove(windowID int, desktop int) bool {
+	window, ok := api.Snapshot().Window(windowID)
+	if !ok {
+		return true
+	}
+	return window.Desktop != desktop && !window.State.Has(shared.StateSticky)
+}
+
+// SetWindowState adds or removes state flags of a window
+// Args:
+//
+//	windowID: ID of the window
+//	state: Flags to change
+//	enabled: True to add the flags, false to remove them
+//
+// Returns:
+//
+//	error: Error if the state could not be changed
+func (api *API) SetWindowState(windowID int, state shared.WindowState, enabled bool) error {
+	return api.windowManager().SetWindowState(windowID, state, enabled)
+}
+
+// ToggleWindowState toggles state flags of a window
+// Args:
+//
+//	windowID: ID of the window
+//	state: Flags to toggle
+//
+// Returns:
+//
+//	error: Error if the state could not be changed
+func (api *API) ToggleWindowState(windowID int, state shared.WindowState) error {
+	return api.windowManager().ToggleWindowState(windowID, state)
+}
+
+// SetCloseTimeout sets how long CloseWindow waits for a window to close.
+// Must be called before windows are closed.
+// Args:
+//
+//	timeout: Time a window answering pings gets before it is left open
+func (api *API) SetCloseTimeout(timeout time.Duration) {
+	api.closeTimeout = timeout
+}
+
+// CloseWindow asks a window to close and kills it in the background only if
+// it stops answering pings before it closed. Windows still answering, e.g.
+// asking to save changes, are left open, KillWindow kills them.
+// Args:
+//
+//	windowID: ID of the window to close
+//
+// Returns:
+//
+//	error: Error if the window is unknown
+func (api *API) CloseWindow(windowID int) error {
+	if _, known := api.Snapshot().Window(windowID); !known {
+		return fmt.Errorf("unknown window %d", windowID)
+	}
+
+	options := desktop.CloseOptions{Timeout: api.closeTimeout, Responding: api.responding}
+	go func() {
+		if err := desktop.CloseOrKillWindow(api.windowManager(), windowID, options); err != nil {
+			log.Error("Failed to close window %d: %v", windowID, err)
+		}
+	}()
+	return nil
+}
+
+// responding checks whether a window answered its last ping, see PingWindows.
+// Windows no longer listed count as responding.
+func (api *API) responding(windowID int) bool {
+	window, ok := api.Snapshot().Window(windowID)
+	return !ok || !window.NotResponding
+}
+
+// KillWindow forcibly closes a window without asking it first.
+// The process of a window not responding to pings is killed with
+// shared.KillProcess, a hung client would not notice losing its connection.
+// Args:
+//
+//	windowID: ID of the window to kill
+//
+// Returns:
+//
+//	error: Error if the window could not be killed
+func (api *API) KillWindow(windowID int) error {
+	var pid int
+	if window, ok := api.Snapshot().Window(windowID); ok && window.NotResponding {
+		pid = window.PID
+	}
+
+	if pid > 0 {
+		err := shared.KillProcess(pid, processKillWait)
+		if err == nil {
+			return nil
+		}
+		log.Warn("Failed to kill process %d of window %d: %v", pid, windowID, err)
+	}
+	return api.windowManager().KillWindow(windowID)
+}
+
+// PingWindows pings all windows and marks those that did not answer the
+// previous ping within the timeout as not responding. The pings are sent
+// without holding the lock.
+// Args:
+//
+//	timeout: Time a window gets to answer
+func (api *API) PingWindows(timeout time.Duration) {
+	now := time.Now()
+	api.mutex.Lock()
+	if api.windows.ExpirePings(now, timeout) {
+		api.publishChanges()
+	}
+	ids := api.windows.StartPings(now)
+	wm := api.wm
+	api.mutex.Unlock()
+
+	var failed []int
+	for _, id := range ids {
+		if !wm.PingWindow(id) {
+			failed = append(failed, id)
+		}
+	}
+	if len(failed) > 0 {
+		api.mutex.Lock()
+		api.windows.CancelPings(failed, now)
+		api.mutex.Unlock()
+	}
+}
+
+// HandlePong records the answer of a window to a ping
+// Args:
+//
+//	windowID: ID of the answering window
+func (api *API) HandlePong(windowID int) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if api.windows.Pong(windowID) {
+		api.publishChanges()
+	}
+}
+
+// MinimizeWindow iconifies a window
+// Args:
+//
+//	windowID: ID of the window to minimize
+//
+// Returns:
+//
+//	error: Error if the window could not be minimized
+func (api *API) MinimizeWindow(windowID int) error {
+	return api.windowManager().MinimizeWindow(windowID)
 }
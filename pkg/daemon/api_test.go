@@ -0,0 +1,169 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gofi/pkg/desktop"
+)
+
+// newTestAPI creates an API on top of a window manager, failing the test on errors
+func newTestAPI(t *testing.T, wm desktop.WindowManager) *API {
+	t.Helper()
+	api, err := NewAPI(wm)
+	if err != nil {
+		t.Fatalf("NewAPI failed: %v", err)
+	}
+	return api
+}
+
+// newTestWatcher creates a watcher for an API, failing the test on errors
+func newTestWatcher(t *testing.T, wm desktop.WindowManager, api *API) *WindowWatcher {
+	t.Helper()
+	watcher, err := NewWindowWatcher(wm, api)
+	if err != nil {
+		t.Fatalf("NewWindowWatcher failed: %v", err)
+	}
+	return watcher
+}
+
+func TestConstructorsRequireWindowManager(t *testing.T) {
+	if _, err := NewAPI(nil); err == nil {
+		t.Error("Expected NewAPI to fail without a window manager")
+	}
+	api := newTestAPI(t, desktop.NewMockWindowManager())
+	if _, err := NewWindowWatcher(nil, api); err == nil {
+		t.Error("Expected NewWindowWatcher to fail without a window manager")
+	}
+	if _, err := NewWindowWatcher(desktop.NewMockWindowManager(), nil); err == nil {
+		t.Error("Expected NewWindowWatcher to fail without an API")
+	}
+}
+
+func TestActivateWindowWithMock(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	api := newTestAPI(t, wm)
+	api.InitializeWindowList()
+
+	if err := api.ActivateWindow(3); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	if err := api.ActivateWindow(42); err == nil {
+		t.Error("Expected error activating unknown window")
+	}
+
+	activations := wm.Activations()
+	if len(activations) != 1 || activations[0] != 3 {
+		t.Errorf("Unexpected activations: %v", activations)
+	}
+	if wm.ActiveWindowID() != 3 {
+		t.Errorf("Active window: got %d, want 3", wm.ActiveWindowID())
+	}
+}
+
+func TestMoveWindowToDesktopPublishesEvent(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	api := newTestAPI(t, wm)
+	api.InitializeWindowList()
+	sub := api.Subscribe([]EventType{EventDesktopChanged})
+	defer sub.Cancel()
+
+	if err := api.MoveWindowToDesktop(1, 1); err != nil {
+		t.Fatalf("MoveWindowToDesktop failed: %v", err)
+	}
+	if err := api.MoveWindowToDesktop(1, 5); err == nil {
+		t.Error("Expected error moving to unknown desktop")
+	}
+
+	select {
+	case event := <-sub.Events:
+		if event.Window.ID != 1 || event.Window.Desktop != 1 {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	default:
+		t.Fatal("Expected desktop-changed event")
+	}
+
+	// The next rescan agrees with the history, no duplicate event
+	api.UpdateWindowList()
+	select {
+	case event := <-sub.Events:
+		t.Errorf("Unexpected event after rescan: %+v", event)
+	default:
+	}
+}
+
+func TestCloseWindowEscalates(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	api := newTestAPI(t, wm)
+	api.SetCloseTimeout(200 * time.Millisecond)
+	watcher := newTestWatcher(t, wm, api)
+	if !watcher.Start() {
+		t.Fatal("Failed to start watcher")
+	}
+	defer watcher.Stop()
+
+	// Pings run much faster than the watcher would, pongs arrive as events
+	stopPings := make(chan struct{})
+	defer close(stopPings)
+	go func() {
+		for {
+			select {
+			case <-stopPings:
+				return
+			case <-time.After(10 * time.Millisecond):
+				api.PingWindows(50 * time.Millisecond)
+			}
+		}
+	}()
+
+	// A window asking to save changes stays open while it answers pings
+	wm.SetBusy(2, true)
+	if err := api.CloseWindow(2); err != nil {
+		t.Fatalf("CloseWindow failed: %v", err)
+	}
+	// A hung window is killed once it missed its pings
+	wm.SetHung(3, true)
+	if err := api.CloseWindow(3); err != nil {
+		t.Fatalf("CloseWindow failed: %v", err)
+	}
+	if err := api.CloseWindow(42); err == nil {
+		t.Error("Expected error closing unknown window")
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if kills := wm.Kills(); len(kills) != 1 || kills[0] != 3 {
+		t.Errorf("Expected only hung window 3 to be killed, got %v", kills)
+	}
+	window, listed := api.Snapshot().Window(2)
+	if !listed || window.NotResponding {
+		t.Errorf("Expected window 2 to stay open and responding, got %+v", window)
+	}
+}
+
+func TestPullWindowWithoutDesktopSupport(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	wm.SetCapabilities(desktop.NewCapabilities("twm", []string{"_NET_CLIENT_LIST", "_NET_ACTIVE_WINDOW"}))
+	api := newTestAPI(t, wm)
+	api.InitializeWindowList()
+
+	// Window 3 is on desktop 1, pulling only activates it
+	if err := api.PullWindow(3); err != nil {
+		t.Fatalf("PullWindow failed: %v", err)
+	}
+	if desktop := wm.WindowDesktop(3); desktop != 1 {
+		t.Errorf("Expected the window to stay on desktop 1, got %d", desktop)
+	}
+	if activations := wm.Activations(); len(activations) != 1 || activations[0] != 3 {
+		t.Errorf("Unexpected activations: %v", activations)
+	}
+
+	_, rpcErr := HandleMoveWindow(api.MoveWindowToDesktop, json.RawMessage(`{"id":3,"desktop":0}`))
+	if rpcErr == nil || rpcErr.Code != ErrCodeUnavailable {
+		t.Errorf("Expected an unavailable error for moving, got %+v", rpcErr)
+	}
+	if caps := api.Capabilities(); caps.WindowManager != "twm" || caps.Has("_NET_WM_DESKTOP") {
+		t.Errorf("Unexpected capabilities: %+v", caps)
+	}
+}
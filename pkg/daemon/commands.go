@@ -2,43 +2,505 @@ package daemon
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 
+	"gofi/pkg/desktop"
 	"gofi/pkg/log"
 	"gofi/pkg/shared"
 )
 
-// HandleHello handles the HELLO command
+// Method names understood by the daemon IPC server
+const (
+	MethodHandshake    = "handshake"
+	MethodWindowList   = "windows.list"
+	MethodShow         = "selector.show"
+	MethodQuit         = "daemon.quit"
+	MethodSubscribe    = "events.subscribe"
+	MethodActivate     = "windows.activate"
+	MethodDesktops     = "desktops.list"
+	MethodSwitch       = "desktops.switch"
+	MethodSetState     = "windows.set_state"
+	MethodToggle       = "windows.toggle_state"
+	MethodMinimize     = "windows.minimize"
+	MethodMove         = "windows.move_to_desktop"
+	MethodPull         = "windows.pull"
+	MethodMonitors     = "monitors.list"
+	MethodClose        = "windows.close"
+	MethodKill         = "windows.kill"
+	MethodSnapshot     = "windows.snapshot"
+	MethodChanges      = "windows.changes"
+	MethodCapabilities = "wm.capabilities"
+
+	// MethodEvent is the method of notifications streamed to subscribers
+	MethodEvent = "event"
+)
+
+// knownEventTypes lists all event types a client may subscribe to
+var knownEventTypes = map[EventType]bool{
+	EventWindowAdded:       true,
+	EventWindowRemoved:     true,
+	EventTitleChanged:      true,
+	EventActiveChanged:     true,
+	EventDesktopChanged:    true,
+	EventRespondingChanged: true,
+
+	EventCurrentDesktopChanged: true,
+}
+
+// HandshakeParams are sent by the client with the handshake method
+// Fields:
+//
+//	ProtocolVersion: Protocol version the client speaks
+type HandshakeParams struct {
+	ProtocolVersion int `json:"protocol_version"`
+}
+
+// HandshakeResult describes the daemon's protocol version and capabilities
+// Fields:
+//
+//	ProtocolVersion: Protocol version the daemon speaks
+//	Methods: All methods the daemon accepts
+type HandshakeResult struct {
+	ProtocolVersion int      `json:"protocol_version"`
+	Methods         []string `json:"methods"`
+}
+
+// MonitorCurrent selects the monitor of the active window
+const MonitorCurrent = "current"
+
+// Sort modes of the window list
+const (
+	// SortMRU lists the most recently used windows first, the default
+	SortMRU = "mru"
+	// SortStacking lists the visually topmost windows first
+	SortStacking = "stacking"
+)
+
+// WindowListParams filter and order the windows of windows.list and selector.show
+// Fields:
+//
+//	Monitor: Only list windows on this monitor, MonitorCurrent for the
+//	         monitor of the active window, all windows if empty
+//	Sort: SortMRU or SortStacking, SortMRU if empty
+type WindowListParams struct {
+	Monitor string `json:"monitor,omitempty"`
+	Sort    string `json:"sort,omitempty"`
+}
+
+// Validate checks the sort mode
 // Returns:
 //
-//	string: Simple HELLO response
-func HandleHello() string {
-	return "HELLO"
+//	*Error: Error if the sort mode is unknown
+func (p WindowListParams) Validate() *Error {
+	switch p.Sort {
+	case "", SortMRU, SortStacking:
+		return nil
+	}
+	return NewError(ErrCodeInvalidParams, "unknown sort mode %q, want %q or %q", p.Sort, SortMRU, SortStacking)
 }
 
-// HandleActiveWindowList handles the ACTIVE_WINDOW_LIST command
+// SnapshotResult is a window list together with its generation
+// Fields:
+//
+//	Generation: Generation of the list, pass it to windows.changes
+//	Windows: Windows as returned by windows.list
+type SnapshotResult struct {
+	Generation uint64           `json:"generation"`
+	Windows    []*shared.Window `json:"windows"`
+}
+
+// ChangesParams select the generation windows.changes starts after
+// Fields:
+//
+//	Since: Last generation the caller knows
+type ChangesParams struct {
+	Since uint64 `json:"since"`
+}
+
+// ChangesResult lists the events after a generation
+// Fields:
+//
+//	Generation: Latest generation
+//	Events: Events in order, empty if nothing changed
+//	Reset: True if the generation is too old or unknown, e.g. after a daemon
+//	       restart. Events is empty then, take a new windows.snapshot.
+type ChangesResult struct {
+	Generation uint64  `json:"generation"`
+	Events     []Event `json:"events"`
+	Reset      bool    `json:"reset,omitempty"`
+}
+
+// SubscribeParams select the events streamed to a subscriber
+// Fields:
+//
+//	Events: Event types to receive, all types if empty
+type SubscribeParams struct {
+	Events []EventType `json:"events,omitempty"`
+}
+
+// SubscribeResult acknowledges a subscription before the first event
+type SubscribeResult struct {
+	Subscribed bool `json:"subscribed"`
+}
+
+// WindowParams identify the window a method acts on
+// Fields:
+//
+//	ID: Window ID
+type WindowParams struct {
+	ID int `json:"id"`
+}
+
+// StateParams select the window state a method changes
+// Fields:
+//
+//	ID: Window ID
+//	State: State name, e.g. "maximized", "fullscreen", "above", "sticky"
+//	Enabled: For windows.set_state, true to add and false to remove the state
+type StateParams struct {
+	ID      int    `json:"id"`
+	State   string `json:"state"`
+	Enabled bool   `json:"enabled"`
+}
+
+// DesktopParams identify the desktop a method acts on
+// Fields:
+//
+//	Desktop: Desktop index
+type DesktopParams struct {
+	Desktop int `json:"desktop"`
+}
+
+// MoveParams select the window and desktop of windows.move_to_desktop
+// Fields:
+//
+//	ID: Window ID
+//	Desktop: Index of the target desktop
+type MoveParams struct {
+	ID      int `json:"id"`
+	Desktop int `json:"desktop"`
+}
+
+// DesktopsResult describes the desktops of the window manager
+// Fields:
+//
+//	Count: Number of desktops, 0 if unknown
+//	Names: Desktop names indexed by desktop number
+//	Current: Index of the current desktop, -1 if unknown
+type DesktopsResult struct {
+	Count   int      `json:"count"`
+	Names   []string `json:"names"`
+	Current int      `json:"current"`
+}
+
+// QuitResult acknowledges a quit request
+type QuitResult struct {
+	Message string `json:"message"`
+}
+
+// RegisterAPIMethods registers all window and desktop methods.
+// The API is looked up on every call since it may not exist yet when the
+// IPC server starts; calls before that fail with ErrCodeUnavailable.
+// Args:
+//
+//	d: Dispatcher to register on
+//	getAPI: Returns the current API or nil
+func RegisterAPIMethods(d *Dispatcher, getAPI func() *API) {
+	withAPI := func(handle func(*API, json.RawMessage) (interface{}, *Error)) Handler {
+		return func(params json.RawMessage) (interface{}, *Error) {
+			api := getAPI()
+			if api == nil {
+				return nil, NewError(ErrCodeUnavailable, "window list not available yet")
+			}
+			return handle(api, params)
+		}
+	}
+
+	d.Register(MethodWindowList, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleWindowList(api.ListWindows, params)
+	}))
+	d.Register(MethodSnapshot, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleSnapshot(api.ListSnapshot, params)
+	}))
+	d.Register(MethodChanges, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleChanges(api.Changes, params)
+	}))
+	d.Register(MethodSubscribe, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleSubscribe(api.Subscribe, params)
+	}))
+	d.Register(MethodActivate, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleWindowAction(api.ActivateWindow, params)
+	}))
+	d.Register(MethodSetState, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleWindowState(params, func(id int, state shared.WindowState, enabled bool) error {
+			return api.SetWindowState(id, state, enabled)
+		})
+	}))
+	d.Register(MethodToggle, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleWindowState(params, func(id int, state shared.WindowState, _ bool) error {
+			return api.ToggleWindowState(id, state)
+		})
+	}))
+	d.Register(MethodMinimize, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleWindowAction(api.MinimizeWindow, params)
+	}))
+	d.Register(MethodMove, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleMoveWindow(api.MoveWindowToDesktop, params)
+	}))
+	d.Register(MethodPull, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleWindowAction(api.PullWindow, params)
+	}))
+	d.Register(MethodClose, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleWindowAction(api.CloseWindow, params)
+	}))
+	d.Register(MethodKill, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleWindowAction(api.KillWindow, params)
+	}))
+	d.Register(MethodMonitors, withAPI(func(api *API, _ json.RawMessage) (interface{}, *Error) {
+		return api.Monitors(), nil
+	}))
+	d.Register(MethodDesktops, withAPI(func(api *API, _ json.RawMessage) (interface{}, *Error) {
+		return api.Desktops(), nil
+	}))
+	d.Register(MethodCapabilities, withAPI(func(api *API, _ json.RawMessage) (interface{}, *Error) {
+		return api.Capabilities(), nil
+	}))
+	d.Register(MethodSwitch, withAPI(func(api *API, params json.RawMessage) (interface{}, *Error) {
+		return HandleSwitchDesktop(api.SwitchDesktop, params)
+	}))
+}
+
+// handleHandshake handles the handshake method, replacing the old HELLO command.
+// A missing protocol version is accepted for simple scripts.
+func (d *Dispatcher) handleHandshake(params json.RawMessage) (interface{}, *Error) {
+	var p HandshakeParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.ProtocolVersion != 0 && p.ProtocolVersion != ProtocolVersion {
+		return nil, NewError(ErrCodeUnsupportedVersion,
+			"protocol version %d not supported, daemon speaks %d",
+			p.ProtocolVersion, ProtocolVersion)
+	}
+	return HandshakeResult{ProtocolVersion: ProtocolVersion, Methods: d.Methods()}, nil
+}
+
+// HandleWindowList handles the windows.list method
 // Args:
 //
-//	windows: List of windows
+//	list: Function listing the windows, usually API.ListWindows
+//	params: Raw WindowListParams
 //
 // Returns:
 //
-//	string: JSON string containing window list data
-func HandleActiveWindowList(windows []shared.Window) string {
-	jsonData, err := json.Marshal(windows)
-	if err != nil {
-		log.Error("Error marshaling window list: %s", err)
-		return fmt.Sprintf("ERROR: %s", err)
+//	interface{}: The window list, never nil so it encodes as an array
+//	*Error: Error if the params are invalid
+func HandleWindowList(list func(WindowListParams) []*shared.Window, params json.RawMessage) (interface{}, *Error) {
+	var p WindowListParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
 	}
+	windows := list(p)
+	if windows == nil {
+		windows = []*shared.Window{}
+	}
+	return windows, nil
+}
 
-	return string(jsonData)
+// HandleSnapshot handles the windows.snapshot method
+// Args:
+//
+//	list: Function listing the windows with their generation, usually API.ListSnapshot
+//	params: Raw WindowListParams
+//
+// Returns:
+//
+//	interface{}: SnapshotResult, its window list never nil
+//	*Error: Error if the params are invalid
+func HandleSnapshot(list func(WindowListParams) SnapshotResult, params json.RawMessage) (interface{}, *Error) {
+	var p WindowListParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	result := list(p)
+	if result.Windows == nil {
+		result.Windows = []*shared.Window{}
+	}
+	return result, nil
+}
+
+// HandleChanges handles the windows.changes method
+// Args:
+//
+//	changes: Function returning the events after a generation, usually API.Changes
+//	params: Raw ChangesParams
+//
+// Returns:
+//
+//	interface{}: ChangesResult, its events never nil
+//	*Error: Error if the params are invalid
+func HandleChanges(changes func(uint64) ([]Event, uint64, bool), params json.RawMessage) (interface{}, *Error) {
+	var p ChangesParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	events, generation, ok := changes(p.Since)
+	if events == nil {
+		events = []Event{}
+	}
+	return ChangesResult{Generation: generation, Events: events, Reset: !ok}, nil
+}
+
+// HandleQuit handles the daemon.quit method
+// Returns:
+//
+//	interface{}: BYE acknowledgement
+//	*Error: Always nil
+func HandleQuit() (interface{}, *Error) {
+	log.Info("Received quit request")
+	return QuitResult{Message: "BYE"}, nil
+}
+
+// HandleSubscribe handles the events.subscribe method
+// Args:
+//
+//	subscribe: Function creating the subscription, usually API.Subscribe
+//	params: Raw SubscribeParams
+//
+// Returns:
+//
+//	interface{}: The *Subscription to stream
+//	*Error: Error if an unknown event type was requested or events are unavailable
+func HandleSubscribe(subscribe func([]EventType) *Subscription, params json.RawMessage) (interface{}, *Error) {
+	var p SubscribeParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	for _, t := range p.Events {
+		if !knownEventTypes[t] {
+			return nil, NewError(ErrCodeInvalidParams, "unknown event type %q", t)
+		}
+	}
+	sub := subscribe(p.Events)
+	if sub == nil {
+		return nil, NewError(ErrCodeUnavailable, "window events not available yet")
+	}
+	return sub, nil
+}
+
+// HandleWindowAction handles methods acting on a single window, like windows.activate
+// Args:
+//
+//	action: Function acting on a window, e.g. API.ActivateWindow
+//	params: Raw WindowParams
+//
+// Returns:
+//
+//	interface{}: True on success
+//	*Error: Error if the params are invalid or the action failed
+func HandleWindowAction(action func(int) error, params json.RawMessage) (interface{}, *Error) {
+	var p WindowParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.ID == 0 {
+		return nil, NewError(ErrCodeInvalidParams, "missing window id")
+	}
+	if err := action(p.ID); err != nil {
+		return nil, actionError(ErrCodeInternal, err)
+	}
+	return true, nil
+}
+
+// HandleSwitchDesktop handles the desktops.switch method
+// Args:
+//
+//	switchDesktop: Function switching desktops, usually API.SwitchDesktop
+//	params: Raw DesktopParams
+//
+// Returns:
+//
+//	interface{}: True on success
+//	*Error: Error if the params are invalid or switching failed
+func HandleSwitchDesktop(switchDesktop func(int) error, params json.RawMessage) (interface{}, *Error) {
+	var p DesktopParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if err := switchDesktop(p.Desktop); err != nil {
+		return nil, actionError(ErrCodeInvalidParams, err)
+	}
+	return true, nil
+}
+
+// HandleMoveWindow handles the windows.move_to_desktop method
+// Args:
+//
+//	move: Function moving a window, usually API.MoveWindowToDesktop
+//	params: Raw MoveParams
+//
+// Returns:
+//
+//	interface{}: True on success
+//	*Error: Error if the params are invalid or moving failed
+func HandleMoveWindow(move func(int, int) error, params json.RawMessage) (interface{}, *Error) {
+	var p MoveParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.ID == 0 {
+		return nil, NewError(ErrCodeInvalidParams, "missing window id")
+	}
+	if err := move(p.ID, p.Desktop); err != nil {
+		return nil, actionError(ErrCodeInternal, err)
+	}
+	return true, nil
 }
 
-// HandleQuit handles the QUIT command
+// HandleWindowState handles the windows.set_state and windows.toggle_state methods
+// Args:
+//
+//	params: Raw StateParams
+//	change: Function applying the state change
+//
 // Returns:
 //
-//	string: BYE response to acknowledge the quit request
-func HandleQuit() string {
-	log.Info("Received QUIT command")
-	return "BYE"
+//	interface{}: True on success
+//	*Error: Error if the params are invalid or the change failed
+func HandleWindowState(params json.RawMessage, change func(int, shared.WindowState, bool) error) (interface{}, *Error) {
+	var p StateParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	state, err := shared.ParseWindowState(p.State)
+	if p.ID == 0 || err != nil {
+		return nil, NewError(ErrCodeInvalidParams, "need window id and valid state, got %d/%q", p.ID, p.State)
+	}
+	if err := change(p.ID, state, p.Enabled); err != nil {
+		return nil, actionError(ErrCodeInternal, err)
+	}
+	return true, nil
+}
+
+// actionError converts the error of a failed action. Features the window
+// manager does not support are reported as ErrCodeUnavailable.
+// Args:
+//
+//	code: Error code for other errors
+//	err: Error of the action
+//
+// Returns:
+//
+//	*Error: Protocol error
+func actionError(code int, err error) *Error {
+	if errors.Is(err, desktop.ErrUnsupported) {
+		return NewError(ErrCodeUnavailable, "%s", err)
+	}
+	return NewError(code, "%s", err)
 }
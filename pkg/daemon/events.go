@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"sync"
+
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// EventType names a change in the window list
+type EventType string
+
+const (
+	EventWindowAdded       EventType = "window-added"
+	EventWindowRemoved     EventType = "window-removed"
+	EventTitleChanged      EventType = "title-changed"
+	EventActiveChanged     EventType = "active-changed"
+	EventDesktopChanged    EventType = "desktop-changed"
+	EventRespondingChanged EventType = "responding-changed"
+	// EventCurrentDesktopChanged is sent when another desktop is shown,
+	// it carries the desktop instead of a window
+	EventCurrentDesktopChanged EventType = "current-desktop-changed"
+
+	// subscriberBuffer is the number of events queued per subscriber
+	// before further events are dropped for that subscriber
+	subscriberBuffer = 64
+)
+
+// Event describes a single change of a window or of the current desktop
+// Fields:
+//
+//	Type: Kind of change
+//	Window: Window state after the change, or the last known state if removed
+//	Desktop: New current desktop, only set for EventCurrentDesktopChanged
+type Event struct {
+	Type    EventType     `json:"type"`
+	Window  shared.Window `json:"window,omitzero"`
+	Desktop *int          `json:"desktop,omitempty"`
+}
+
+// diffEvents derives the events that turn the before snapshot into the after snapshot
+func diffEvents(before, after *Snapshot) []Event {
+	var events []Event
+	for _, id := range before.order {
+		if _, ok := after.windows[id]; !ok {
+			events = append(events, Event{Type: EventWindowRemoved, Window: before.windows[id]})
+		}
+	}
+	for _, id := range after.order {
+		events = append(events, diffWindow(before.windows, after.windows[id])...)
+	}
+	active, ok := after.windows[after.activeID]
+	if ok && after.activeID != before.activeID {
+		events = append(events, Event{Type: EventActiveChanged, Window: active})
+	}
+	if after.currentDesktop != before.currentDesktop && after.currentDesktop >= 0 {
+		current := after.currentDesktop
+		events = append(events, Event{Type: EventCurrentDesktopChanged, Desktop: &current})
+	}
+	return events
+}
+
+// diffWindow derives the events for a single window present in the new state
+func diffWindow(known map[int]shared.Window, w shared.Window) []Event {
+	before, existed := known[w.ID]
+	if !existed {
+		return []Event{{Type: EventWindowAdded, Window: w}}
+	}
+	var events []Event
+	if before.Title != w.Title {
+		events = append(events, Event{Type: EventTitleChanged, Window: w})
+	}
+	if before.Desktop != w.Desktop {
+		events = append(events, Event{Type: EventDesktopChanged, Window: w})
+	}
+	if before.NotResponding != w.NotResponding {
+		events = append(events, Event{Type: EventRespondingChanged, Window: w})
+	}
+	return events
+}
+
+// Subscription is a stream of events for a single subscriber
+type Subscription struct {
+	Events <-chan Event
+	id     int
+	bus    *EventBus
+}
+
+// Cancel stops the subscription and closes its event channel
+func (s *Subscription) Cancel() {
+	s.bus.unsubscribe(s.id)
+}
+
+// subscriber is the bus side of a subscription
+type subscriber struct {
+	events chan Event
+	types  map[EventType]bool
+}
+
+// EventBus fans out window events to subscribers
+type EventBus struct {
+	subscribers map[int]*subscriber
+	nextID      int
+	mutex       sync.Mutex
+}
+
+// NewEventBus creates a new EventBus instance
+// Returns:
+//
+//	*EventBus: New event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[int]*subscriber)}
+}
+
+// Subscribe registers a new subscriber
+// Args:
+//
+//	types: Event types to receive, all types if empty
+//
+// Returns:
+//
+//	*Subscription: New subscription
+func (b *EventBus) Subscribe(types []EventType) *Subscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sub := &subscriber{events: make(chan Event, subscriberBuffer)}
+	if len(types) > 0 {
+		sub.types = make(map[EventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+	b.nextID++
+	b.subscribers[b.nextID] = sub
+	return &Subscription{Events: sub.events, id: b.nextID, bus: b}
+}
+
+// unsubscribe removes a subscriber and closes its channel
+func (b *EventBus) unsubscribe(id int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if sub, ok := b.subscribers[id]; ok {
+		delete(b.subscribers, id)
+		close(sub.events)
+	}
+}
+
+// Publish sends events to all interested subscribers without blocking.
+// Events are dropped for subscribers that do not keep up.
+func (b *EventBus) Publish(events []Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, event := range events {
+		for id, sub := range b.subscribers {
+			if sub.types != nil && !sub.types[event.Type] {
+				continue
+			}
+			select {
+			case sub.events <- event:
+			default:
+				log.Warn("Subscriber %d too slow, dropping %s event", id, event.Type)
+			}
+		}
+	}
+}
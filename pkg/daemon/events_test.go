@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"testing"
+
+	"gofi/pkg/shared"
+)
+
+func TestDiffEvents(t *testing.T) {
+	before := newSnapshot([]*shared.Window{
+		shared.NewWindow(1, "Terminal", "st", "Normal", "st", 0, 10),
+		shared.NewWindow(2, "Browser", "firefox", "Normal", "firefox", 0, 20),
+		shared.NewWindow(3, "Editor", "gedit", "Normal", "gedit", 1, 30),
+	}, nil, 1, 0)
+	after := newSnapshot([]*shared.Window{
+		shared.NewWindow(1, "Terminal - vim", "st", "Normal", "st", 0, 10),
+		shared.NewWindow(3, "Editor", "gedit", "Normal", "gedit", 2, 30),
+		shared.NewWindow(4, "Mail", "thunderbird", "Normal", "thunderbird", 0, 40),
+	}, nil, 3, 2)
+	hung := after.windows[3]
+	hung.NotResponding = true
+	after.windows[3] = hung
+
+	want := []struct {
+		eventType EventType
+		id        int
+	}{
+		{EventWindowRemoved, 2},
+		{EventTitleChanged, 1},
+		{EventDesktopChanged, 3},
+		{EventRespondingChanged, 3},
+		{EventWindowAdded, 4},
+		{EventActiveChanged, 3},
+		{EventCurrentDesktopChanged, 0},
+	}
+
+	events := diffEvents(before, after)
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %d: %v", len(want), len(events), events)
+	}
+	if desktop := events[len(events)-1].Desktop; desktop == nil || *desktop != 2 {
+		t.Errorf("Expected a change to desktop 2, got %v", desktop)
+	}
+	for i, w := range want {
+		if events[i].Type != w.eventType || events[i].Window.ID != w.id {
+			t.Errorf("Event %d: got %s/%d, want %s/%d",
+				i, events[i].Type, events[i].Window.ID, w.eventType, w.id)
+		}
+	}
+}
+
+func TestEventBusFiltersAndCancels(t *testing.T) {
+	bus := NewEventBus()
+	all := bus.Subscribe(nil)
+	activeOnly := bus.Subscribe([]EventType{EventActiveChanged})
+
+	bus.Publish([]Event{
+		{Type: EventWindowAdded, Window: shared.Window{ID: 1}},
+		{Type: EventActiveChanged, Window: shared.Window{ID: 1}},
+	})
+
+	if len(all.Events) != 2 {
+		t.Errorf("Expected 2 events for unfiltered subscriber, got %d", len(all.Events))
+	}
+	if len(activeOnly.Events) != 1 {
+		t.Errorf("Expected 1 event for filtered subscriber, got %d", len(activeOnly.Events))
+	}
+
+	activeOnly.Cancel()
+	activeOnly.Cancel() // Cancelling twice must be safe
+	for range activeOnly.Events {
+	}
+	bus.Publish([]Event{{Type: EventActiveChanged}})
+	if len(all.Events) != 3 {
+		t.Errorf("Expected 3 events after cancel, got %d", len(all.Events))
+	}
+}
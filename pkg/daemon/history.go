@@ -54,9 +54,10 @@ func (h *History) KeepOnly(windows []*shared.Window) bool {
 	// Check if the list actually changed (length or content)
 	changed := len(h.windows) != len(keptWindows)
 	if !changed {
-		// If length is same, check if elements are the same (order matters here)
+		// If length is same, check if elements are the same (order matters here).
+		// A window moved to another desktop counts as a change as well.
 		for i := range keptWindows {
-			if h.windows[i].ID != keptWindows[i].ID {
+			if h.windows[i].ID != keptWindows[i].ID || h.windows[i].Desktop != keptWindows[i].Desktop {
 				changed = true
 				break
 			}
@@ -121,6 +122,42 @@ func (h *History) UpdateActiveWindow(activeID int) bool {
 	return changed
 }
 
+// Replace swaps the entry of a window for an updated one, keeping the order.
+// Windows handed out before stay unchanged.
+// Args:
+//
+//	window: Updated window, matched by ID
+//
+// Returns:
+//
+//	bool: True if the window was found.
+func (h *History) Replace(window *shared.Window) bool {
+	for i, histWindow := range h.windows {
+		if histWindow.ID == window.ID {
+			h.windows[i] = window
+			return true
+		}
+	}
+	return false
+}
+
+// Find looks up a window in the history
+// Args:
+//
+//	windowID: ID of the window
+//
+// Returns:
+//
+//	*shared.Window: The window or nil if it is not in the history
+func (h *History) Find(windowID int) *shared.Window {
+	for _, window := range h.windows {
+		if window.ID == windowID {
+			return window
+		}
+	}
+	return nil
+}
+
 // GetActiveID returns the ID of the currently active window
 // Returns:
 //
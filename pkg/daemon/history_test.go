@@ -37,3 +37,30 @@ func TestHistory(t *testing.T) {
 		t.Errorf("History not cleared: got %d", len(h.windows))
 	}
 }
+
+func TestHistoryReplace(t *testing.T) {
+	h := NewHistory()
+	first := &shared.Window{ID: 1, Desktop: 0}
+	second := &shared.Window{ID: 2, Desktop: 0}
+	h.Initialize([]*shared.Window{first, second})
+
+	moved := *second
+	moved.Desktop = 1
+	if !h.Replace(&moved) {
+		t.Error("Expected known window to be replaced")
+	}
+	if h.Replace(&shared.Window{ID: 3}) {
+		t.Error("Unknown window should not be replaced")
+	}
+	if h.Find(2).Desktop != 1 || h.windows[1].ID != 2 {
+		t.Errorf("Replaced window not updated in place: %+v", h.windows[1])
+	}
+	if second.Desktop != 0 {
+		t.Error("Windows handed out before must stay unchanged")
+	}
+
+	// A rescan reporting the old desktop again is a change too
+	if !h.KeepOnly([]*shared.Window{first, second}) {
+		t.Error("Expected KeepOnly to report the desktop change")
+	}
+}
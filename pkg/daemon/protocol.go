@@ -0,0 +1,237 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const (
+	// ProtocolVersion is bumped on every incompatible protocol change
+	ProtocolVersion = 1
+
+	// jsonRPCVersion is the JSON-RPC version tag sent with every message
+	jsonRPCVersion = "2.0"
+)
+
+// Error codes. The first block is taken from JSON-RPC 2.0,
+// the second block is gofi specific.
+const (
+	ErrCodeParse          = -32700
+	ErrCodeInvalidRequest = -32600
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInvalidParams  = -32602
+	ErrCodeInternal       = -32603
+
+	ErrCodeUnsupportedVersion = -32000
+	ErrCodeUnavailable        = -32001
+)
+
+// Request is a single JSON-RPC request sent to the daemon
+// Fields:
+//
+//	JSONRPC: Always "2.0"
+//	ID: Caller chosen request ID, echoed in the response
+//	Method: Method name, see the Method* constants
+//	Params: Optional method parameters
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the daemon's answer to a Request.
+// Exactly one of Result and Error is set.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a typed protocol error
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// NewError creates a new protocol error
+// Args:
+//
+//	code: One of the ErrCode* constants
+//	format: Format string for the message
+//	args: Arguments
+//
+// Returns:
+//
+//	*Error: New error
+func NewError(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// NewRequest creates a request with marshaled params
+// Args:
+//
+//	id: Request ID
+//	method: Method name
+//	params: Params to marshal, may be nil
+//
+// Returns:
+//
+//	Request: New request
+//	error: Error if params could not be marshaled
+func NewRequest(id int, method string, params interface{}) (Request, error) {
+	req := Request{JSONRPC: jsonRPCVersion, ID: id, Method: method}
+	if params == nil {
+		return req, nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return req, fmt.Errorf("failed to marshal params: %w", err)
+	}
+	req.Params = data
+	return req, nil
+}
+
+// Notification is a message sent by the daemon without a request,
+// used to stream events to subscribers
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// NewEventNotification wraps an event into a notification
+// Args:
+//
+//	event: Event to send
+//
+// Returns:
+//
+//	Notification: Notification with method "event"
+func NewEventNotification(event Event) Notification {
+	return Notification{JSONRPC: jsonRPCVersion, Method: MethodEvent, Params: event}
+}
+
+// Handler processes the params of a single method call
+type Handler func(params json.RawMessage) (interface{}, *Error)
+
+// AfterResponse is a handler result whose action must only run once the
+// response has been written, e.g. quitting the daemon
+type AfterResponse struct {
+	Result interface{}
+	Action func()
+}
+
+// Dispatcher routes requests to registered method handlers
+type Dispatcher struct {
+	handlers map[string]Handler
+}
+
+// NewDispatcher creates a dispatcher with the handshake method registered
+// Returns:
+//
+//	*Dispatcher: New dispatcher
+func NewDispatcher() *Dispatcher {
+	d := &Dispatcher{handlers: make(map[string]Handler)}
+	d.Register(MethodHandshake, d.handleHandshake)
+	return d
+}
+
+// Register adds a handler for a method, replacing any existing one
+func (d *Dispatcher) Register(method string, handler Handler) {
+	d.handlers[method] = handler
+}
+
+// Methods returns the sorted names of all registered methods
+func (d *Dispatcher) Methods() []string {
+	methods := make([]string, 0, len(d.handlers))
+	for method := range d.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Dispatch decodes a raw request line and returns the encoded response.
+// If the method opened an event stream the subscription is returned as well
+// and the caller is responsible for streaming and cancelling it. An action
+// returned by the method through AfterResponse has to be run by the caller
+// after writing the response.
+// Args:
+//
+//	line: Raw JSON request
+//
+// Returns:
+//
+//	[]byte: Raw JSON response
+//	*Subscription: Event stream opened by the request, or nil
+//	func(): Action to run after the response was written, or nil
+func (d *Dispatcher) Dispatch(line []byte) ([]byte, *Subscription, func()) {
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return encodeResponse(0, nil, NewError(ErrCodeParse, "%s", err)), nil, nil
+	}
+	result, rpcErr := d.call(req)
+	var after func()
+	if deferred, ok := result.(AfterResponse); ok {
+		result, after = deferred.Result, deferred.Action
+	}
+	sub, isStream := result.(*Subscription)
+	if isStream {
+		result = SubscribeResult{Subscribed: true}
+	}
+	return encodeResponse(req.ID, result, rpcErr), sub, after
+}
+
+// call validates the request and invokes its handler
+func (d *Dispatcher) call(req Request) (interface{}, *Error) {
+	if req.JSONRPC != jsonRPCVersion {
+		return nil, NewError(ErrCodeInvalidRequest, "jsonrpc must be %q", jsonRPCVersion)
+	}
+	handler, ok := d.handlers[req.Method]
+	if !ok {
+		return nil, NewError(ErrCodeMethodNotFound, "unknown method %q", req.Method)
+	}
+	return handler(req.Params)
+}
+
+// encodeResponse builds and marshals a response
+func encodeResponse(id int, result interface{}, rpcErr *Error) []byte {
+	resp := Response{JSONRPC: jsonRPCVersion, ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = NewError(ErrCodeInternal, "failed to marshal result: %s", err)
+		} else {
+			resp.Result = data
+		}
+	}
+	data, _ := json.Marshal(resp) // Response itself always marshals
+	return data
+}
+
+// DecodeParams unmarshals params into target, mapping failures to ErrCodeInvalidParams
+// Args:
+//
+//	params: Raw params, may be empty
+//	target: Pointer to decode into
+//
+// Returns:
+//
+//	*Error: Error if the params are malformed
+func DecodeParams(params json.RawMessage, target interface{}) *Error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, target); err != nil {
+		return NewError(ErrCodeInvalidParams, "%s", err)
+	}
+	return nil
+}
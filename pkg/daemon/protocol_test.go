@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gofi/pkg/shared"
+)
+
+func dispatchJSON(t *testing.T, d *Dispatcher, line string) Response {
+	var resp Response
+	data, _, _ := d.Dispatch([]byte(line))
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestDispatcherHandshake(t *testing.T) {
+	d := NewDispatcher()
+	d.Register(MethodQuit, func(json.RawMessage) (interface{}, *Error) { return HandleQuit() })
+
+	resp := dispatchJSON(t, d, `{"jsonrpc":"2.0","id":7,"method":"handshake","params":{"protocol_version":1}}`)
+	if resp.ID != 7 || resp.Error != nil {
+		t.Fatalf("Unexpected handshake response: %+v", resp)
+	}
+
+	var result HandshakeResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("Failed to decode handshake result: %v", err)
+	}
+	if result.ProtocolVersion != ProtocolVersion {
+		t.Errorf("Protocol version: got %d, want %d", result.ProtocolVersion, ProtocolVersion)
+	}
+	if len(result.Methods) != 2 || result.Methods[0] != MethodQuit || result.Methods[1] != MethodHandshake {
+		t.Errorf("Unexpected methods: %v", result.Methods)
+	}
+}
+
+func TestDispatcherErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		code int
+	}{
+		{"parse error", `{not json`, ErrCodeParse},
+		{"missing jsonrpc", `{"id":1,"method":"handshake"}`, ErrCodeInvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"nope"}`, ErrCodeMethodNotFound},
+		{"bad params", `{"jsonrpc":"2.0","id":1,"method":"handshake","params":[1]}`, ErrCodeInvalidParams},
+		{"old client", `{"jsonrpc":"2.0","id":1,"method":"handshake","params":{"protocol_version":99}}`, ErrCodeUnsupportedVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := dispatchJSON(t, NewDispatcher(), tt.line)
+			if resp.Error == nil || resp.Error.Code != tt.code {
+				t.Errorf("Expected error code %d, got %+v", tt.code, resp.Error)
+			}
+			if resp.Result != nil {
+				t.Errorf("Expected no result, got %s", resp.Result)
+			}
+		})
+	}
+}
+
+func TestDispatcherAfterResponse(t *testing.T) {
+	d := NewDispatcher()
+	quit := false
+	d.Register(MethodQuit, func(json.RawMessage) (interface{}, *Error) {
+		result, err := HandleQuit()
+		return AfterResponse{Result: result, Action: func() { quit = true }}, err
+	})
+
+	data, _, after := d.Dispatch([]byte(`{"jsonrpc":"2.0","id":3,"method":"daemon.quit"}`))
+	if quit {
+		t.Fatal("Action ran before the response was written")
+	}
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil || resp.Error != nil || string(resp.Result) != `{"message":"BYE"}` {
+		t.Errorf("Unexpected quit response %s: %v", data, err)
+	}
+	if after == nil {
+		t.Fatal("Expected an action to run after the response")
+	}
+	after()
+	if !quit {
+		t.Error("Expected the returned action to quit")
+	}
+}
+
+func TestHandleWindowListSort(t *testing.T) {
+	var got WindowListParams
+	list := func(p WindowListParams) []*shared.Window {
+		got = p
+		return nil
+	}
+
+	result, err := HandleWindowList(list, json.RawMessage(`{"monitor":"DP-1","sort":"stacking"}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if got.Monitor != "DP-1" || got.Sort != SortStacking {
+		t.Errorf("Expected monitor and sort to be passed on, got %+v", got)
+	}
+	if windows, ok := result.([]*shared.Window); !ok || windows == nil {
+		t.Errorf("Expected an empty window list, got %#v", result)
+	}
+
+	if _, err := HandleWindowList(list, json.RawMessage(`{"sort":"alphabetical"}`)); err == nil || err.Code != ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params for unknown sort, got %+v", err)
+	}
+}
+
+func TestHandleChanges(t *testing.T) {
+	changes := func(since uint64) ([]Event, uint64, bool) {
+		return nil, 7, since == 7
+	}
+
+	result, err := HandleChanges(changes, json.RawMessage(`{"since":3}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	got, ok := result.(ChangesResult)
+	if !ok || !got.Reset || got.Generation != 7 || got.Events == nil {
+		t.Errorf("Expected a reset with an empty event list, got %#v", result)
+	}
+
+	if _, err := HandleChanges(changes, json.RawMessage(`{"since":"7"}`)); err == nil || err.Code != ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params for a string generation, got %+v", err)
+	}
+}
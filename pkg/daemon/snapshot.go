@@ -0,0 +1,282 @@
+package daemon
+
+import (
+	"sort"
+	"sync"
+
+	"gofi/pkg/shared"
+)
+
+// maxChangeLog is the number of generations whose events are kept for Changes
+const maxChangeLog = 256
+
+// Snapshot is an immutable copy of the window list at one generation.
+// Every change of the list is published as a new snapshot with a higher
+// generation, so readers never see a list while it is updated.
+type Snapshot struct {
+	Generation uint64
+	windows    map[int]shared.Window
+	order      []int // Window IDs, most recently used first
+	stacking   []int // Window IDs, topmost first, empty if unknown
+	activeID   int
+	// Desktop shown, -1 if unknown
+	currentDesktop int
+}
+
+// newSnapshot copies the given windows into a snapshot of generation 0
+// Args:
+//
+//	windows: Windows, most recently used first
+//	stacking: Window IDs, topmost first
+//	activeID: ID of the active window
+//	currentDesktop: Desktop shown, -1 if unknown
+//
+// Returns:
+//
+//	*Snapshot: New snapshot
+func newSnapshot(windows []*shared.Window, stacking []int, activeID int, currentDesktop int) *Snapshot {
+	s := &Snapshot{
+		windows:        make(map[int]shared.Window, len(windows)),
+		order:          make([]int, 0, len(windows)),
+		stacking:       append([]int(nil), stacking...),
+		activeID:       activeID,
+		currentDesktop: currentDesktop,
+	}
+	for _, w := range windows {
+		s.windows[w.ID] = *w
+		s.order = append(s.order, w.ID)
+	}
+	return s
+}
+
+// Windows returns copies of all windows, most recently used first
+// Returns:
+//
+//	[]shared.Window: Windows of the snapshot
+func (s *Snapshot) Windows() []shared.Window {
+	windows := make([]shared.Window, 0, len(s.order))
+	for _, id := range s.order {
+		windows = append(windows, s.windows[id])
+	}
+	return windows
+}
+
+// Window looks up a window by ID
+// Args:
+//
+//	windowID: ID of the window
+//
+// Returns:
+//
+//	shared.Window: Copy of the window
+//	bool: False if the window is not in the snapshot
+func (s *Snapshot) Window(windowID int) (shared.Window, bool) {
+	w, ok := s.windows[windowID]
+	return w, ok
+}
+
+// ActiveID returns the ID of the active window, 0 if none
+func (s *Snapshot) ActiveID() int {
+	return s.activeID
+}
+
+// List prepares the window list for clients (e.g., Alt-Tab).
+// Windows are filtered by monitor and ordered by the sort mode, "Normal"
+// windows come first and the first two are swapped for quick toggling.
+// MonitorCurrent selects the monitor of the active window, an empty monitor
+// keeps all windows. SortStacking falls back to the history order if the
+// window manager has no stacking order.
+// Args:
+//
+//	options: Monitor filter and sort mode
+//	desktopNames: Names of the desktops, added to the windows
+//
+// Returns:
+//
+//	[]*shared.Window: New copies of the matching windows, nil if none
+func (s *Snapshot) List(options WindowListParams, desktopNames []string) []*shared.Window {
+	windows := make([]*shared.Window, 0, len(s.order))
+	for _, id := range s.order {
+		w := s.windows[id]
+		windows = append(windows, &w)
+	}
+	if options.Sort == SortStacking && len(s.stacking) > 0 {
+		windows = sortByStacking(windows, s.stacking)
+	}
+
+	monitor := options.Monitor
+	if monitor == MonitorCurrent {
+		monitor = s.windows[s.activeID].Monitor
+	}
+	if monitor != "" {
+		filtered := windows[:0]
+		for _, w := range windows {
+			if w.Monitor == monitor {
+				filtered = append(filtered, w)
+			}
+		}
+		windows = filtered
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+
+	windows = partitionAndReorder(windows)
+	applyAltTabSwap(windows)
+	for _, w := range windows {
+		w.DesktopName = desktopName(desktopNames, w.Desktop)
+	}
+	return windows
+}
+
+// sameState reports whether two snapshots hold the same windows in the same
+// order on the same desktop
+func (s *Snapshot) sameState(other *Snapshot) bool {
+	if s.activeID != other.activeID || s.currentDesktop != other.currentDesktop ||
+		!equalIDs(s.order, other.order) ||
+		!equalIDs(s.stacking, other.stacking) {
+		return false
+	}
+	for id, w := range s.windows {
+		if other.windows[id] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// equalIDs compares two lists of window IDs
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortByStacking sorts windows topmost first. Windows missing from the
+// stacking order keep their relative order after the stacked ones.
+func sortByStacking(windows []*shared.Window, stacking []int) []*shared.Window {
+	rank := make(map[int]int, len(stacking))
+	for i, id := range stacking {
+		rank[id] = i
+	}
+	sorted := append([]*shared.Window(nil), windows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, iStacked := rank[sorted[i].ID]
+		rj, jStacked := rank[sorted[j].ID]
+		if iStacked != jStacked {
+			return iStacked
+		}
+		return iStacked && ri < rj
+	})
+	return sorted
+}
+
+// desktopName looks up the name of a desktop, empty if it has none
+func desktopName(names []string, desktop int) string {
+	if desktop < 0 || desktop >= len(names) {
+		return ""
+	}
+	return names[desktop]
+}
+
+// partitionAndReorder separates windows into "Normal" and "Special" types,
+// returning a new slice with "Normal" windows first.
+// Windows asking to be skipped by taskbars are left out, like gofi itself.
+func partitionAndReorder(windows []*shared.Window) []*shared.Window {
+	normalWindows := make([]*shared.Window, 0, len(windows))
+	specialWindows := make([]*shared.Window, 0, len(windows))
+
+	for _, w := range windows {
+		if w.State.Has(shared.StateSkipTaskbar) {
+			continue
+		}
+		if w.Type == "Normal" {
+			normalWindows = append(normalWindows, w)
+		} else { // Treat non-Normal as Special
+			specialWindows = append(specialWindows, w)
+		}
+	}
+	return append(normalWindows, specialWindows...)
+}
+
+// applyAltTabSwap swaps the first two elements of the slice if it has at least two elements.
+func applyAltTabSwap(windows []*shared.Window) {
+	if len(windows) >= 2 {
+		windows[0], windows[1] = windows[1], windows[0]
+	}
+}
+
+// changeEntry holds the events that led to one generation
+type changeEntry struct {
+	generation uint64
+	events     []Event
+}
+
+// changeLog keeps the events of the latest generations so clients can catch
+// up with Changes instead of fetching the whole list again
+type changeLog struct {
+	entries    []changeEntry
+	generation uint64 // Latest generation
+	mutex      sync.Mutex
+}
+
+// add records the events of a new generation, dropping the oldest entries
+func (c *changeLog) add(generation uint64, events []Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = append(c.entries, changeEntry{generation, events})
+	if len(c.entries) > maxChangeLog {
+		c.entries = append([]changeEntry(nil), c.entries[len(c.entries)-maxChangeLog:]...)
+	}
+	c.generation = generation
+}
+
+// reset forgets all entries, callers of since with an older generation
+// have to take a new snapshot
+func (c *changeLog) reset(generation uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = nil
+	c.generation = generation
+}
+
+// since collects the events after the given generation
+// Args:
+//
+//	generation: Last generation the caller knows
+//
+// Returns:
+//
+//	[]Event: Events in order, nil if nothing changed
+//	uint64: Latest generation
+//	bool: False if the generation is unknown or too old, the caller has to
+//	      fetch the whole list again
+func (c *changeLog) since(generation uint64) ([]Event, uint64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation > c.generation {
+		return nil, c.generation, false
+	}
+	if generation == c.generation {
+		return nil, c.generation, true
+	}
+	if len(c.entries) == 0 || c.entries[0].generation > generation+1 {
+		return nil, c.generation, false
+	}
+	var events []Event
+	for _, entry := range c.entries {
+		if entry.generation > generation {
+			events = append(events, entry.events...)
+		}
+	}
+	return events, c.generation, true
+}
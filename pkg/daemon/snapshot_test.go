@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"sync"
+	"testing"
+
+	"gofi/pkg/desktop"
+)
+
+func TestSnapshotGenerations(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	api := newTestAPI(t, wm)
+	if generation := api.Snapshot().Generation; generation != 0 {
+		t.Fatalf("Expected generation 0 before initialization, got %d", generation)
+	}
+	api.InitializeWindowList()
+
+	initial := api.Snapshot()
+	if initial.Generation != 1 {
+		t.Fatalf("Expected generation 1 after initialization, got %d", initial.Generation)
+	}
+	if _, _, ok := api.Changes(0); ok {
+		t.Error("Expected a reset for changes before the initial list")
+	}
+
+	// A rescan without changes keeps the generation
+	api.UpdateWindowList()
+	if api.Snapshot() != initial {
+		t.Errorf("Expected unchanged snapshot, got generation %d", api.Snapshot().Generation)
+	}
+
+	wm.SetWindowTitle(2, "Renamed")
+	api.UpdateWindowList()
+	if err := api.MoveWindowToDesktop(1, 1); err != nil {
+		t.Fatalf("MoveWindowToDesktop failed: %v", err)
+	}
+
+	events, generation, ok := api.Changes(initial.Generation)
+	if !ok || generation != 3 {
+		t.Fatalf("Expected changes up to generation 3, got %d (ok=%v)", generation, ok)
+	}
+	if len(events) != 2 || events[0].Type != EventTitleChanged || events[1].Type != EventDesktopChanged {
+		t.Errorf("Unexpected events: %v", events)
+	}
+	if events, _, ok := api.Changes(generation); !ok || events != nil {
+		t.Errorf("Expected no changes for the latest generation, got %v (ok=%v)", events, ok)
+	}
+	if _, _, ok := api.Changes(generation + 1); ok {
+		t.Error("Expected a reset for an unknown generation")
+	}
+
+	// Earlier snapshots are not touched by updates
+	if w, _ := initial.Window(2); w.Title == "Renamed" {
+		t.Error("Initial snapshot changed after an update")
+	}
+	if w, _ := api.Snapshot().Window(2); w.Title != "Renamed" {
+		t.Errorf("Expected renamed window in the latest snapshot, got %q", w.Title)
+	}
+}
+
+func TestChangeLogDropsOldGenerations(t *testing.T) {
+	var changes changeLog
+	changes.reset(1)
+	for generation := uint64(2); generation <= maxChangeLog+11; generation++ {
+		changes.add(generation, []Event{{Type: EventTitleChanged}})
+	}
+
+	if _, _, ok := changes.since(1); ok {
+		t.Error("Expected a reset for a dropped generation")
+	}
+	events, generation, ok := changes.since(11)
+	if !ok || generation != maxChangeLog+11 || len(events) != maxChangeLog {
+		t.Errorf("Expected %d events up to generation %d, got %d up to %d (ok=%v)",
+			maxChangeLog, maxChangeLog+11, len(events), generation, ok)
+	}
+}
+
+// TestSnapshotConcurrentReaders is meant for the race detector
+func TestSnapshotConcurrentReaders(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	api := newTestAPI(t, wm)
+	api.InitializeWindowList()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, w := range api.ListWindows(WindowListParams{Sort: SortStacking}) {
+					w.Title = "changed by reader"
+				}
+				api.Changes(api.Snapshot().Generation)
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		wm.SetActiveWindow(i%3 + 1)
+		api.UpdateActiveWindow()
+		api.UpdateStacking()
+	}
+	wg.Wait()
+
+	for _, w := range api.Snapshot().Windows() {
+		if w.Title == "changed by reader" {
+			t.Fatalf("Reader changed window %d of the snapshot", w.ID)
+		}
+	}
+}
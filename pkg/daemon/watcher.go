@@ -2,13 +2,28 @@ package daemon
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"gofi/pkg/desktop"
 	"gofi/pkg/log"
 	"gofi/pkg/shared"
 )
 
+const (
+	// pingInterval is the time between pings of all windows
+	pingInterval = 5 * time.Second
+	// pingTimeout is the time a window gets to answer a ping. Timeouts are
+	// checked with the next round of pings.
+	pingTimeout = 3 * time.Second
+
+	// reconnectBackoffMin is the wait before the first reconnect attempt,
+	// doubled after every failed attempt up to reconnectBackoffMax
+	reconnectBackoffMin = 500 * time.Millisecond
+	reconnectBackoffMax = 30 * time.Second
+)
+
 type WindowWatcher struct {
 	stopEvent   *sync.WaitGroup
 	eventThread *sync.WaitGroup
@@ -18,26 +33,31 @@ type WindowWatcher struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 	mutex       sync.Mutex
+	// Supervision, see SetReconnect
+	reconnect  func() (desktop.WindowManager, error)
+	backoffMin time.Duration
+	backoffMax time.Duration
 }
 
 // NewWindowWatcher creates a new WindowWatcher instance
 // Args:
 //
-//	wm: Optional window manager
-//	api: Optional API instance
+//	wm: Window manager to watch, usually the one of the API
+//	api: API to keep up to date
 //
 // Returns:
 //
 //	*WindowWatcher: New window watcher instance
+//	error: Error if the window manager or the API is missing
 func NewWindowWatcher(
 	wm desktop.WindowManager,
 	api *API,
-) *WindowWatcher {
+) (*WindowWatcher, error) {
 	if wm == nil {
-		wm = desktop.Instance()
+		return nil, fmt.Errorf("no window manager given")
 	}
 	if api == nil {
-		panic("API cannot be nil")
+		return nil, fmt.Errorf("no API given")
 	}
 
 	// Create context for cancellation
@@ -51,7 +71,20 @@ func NewWindowWatcher(
 		isStopping:  false,
 		ctx:         ctx,
 		cancel:      cancel,
-	}
+		backoffMin:  reconnectBackoffMin,
+		backoffMax:  reconnectBackoffMax,
+	}, nil
+}
+
+// SetReconnect enables supervision: when the connection to the window
+// manager is lost, connect is retried with exponential backoff and the API
+// switched to the new connection. Without it the watcher stops.
+// Must be called before Start.
+// Args:
+//
+//	connect: Function creating a new window manager connection
+func (ww *WindowWatcher) SetReconnect(connect func() (desktop.WindowManager, error)) {
+	ww.reconnect = connect
 }
 
 // ClientList gets the client list from API
@@ -67,12 +100,12 @@ func (ww *WindowWatcher) ClientList() []*shared.Window {
 //
 //	bool: True if started successfully
 func (ww *WindowWatcher) Start() bool {
-	ww.api.InitializeWindowList()
-
+	// Events first, so windows listed during initialization are watched
 	if !ww.wm.InitEvents() {
 		log.Error("Failed to initialize events")
 		return false
 	}
+	ww.api.InitializeWindowList()
 
 	ww.startWatcherThread()
 	return true
@@ -97,13 +130,31 @@ func (ww *WindowWatcher) Stop() bool {
 	return true
 }
 
-// startWatcherThread starts the watcher thread
+// startWatcherThread starts the watcher and ping threads
 func (ww *WindowWatcher) startWatcherThread() {
-	ww.eventThread.Add(1)
+	ww.eventThread.Add(2)
 	go func() {
 		defer ww.eventThread.Done()
 		ww.windowEventThread()
 	}()
+	go func() {
+		defer ww.eventThread.Done()
+		ww.pingThread()
+	}()
+}
+
+// pingThread pings all windows regularly to detect hung clients
+func (ww *WindowWatcher) pingThread() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ww.ctx.Done():
+			return
+		case <-ticker.C:
+			ww.api.PingWindows(pingTimeout)
+		}
+	}
 }
 
 // windowEventThread runs the window event loop
@@ -113,35 +164,108 @@ func (ww *WindowWatcher) windowEventThread() {
 		case <-ww.ctx.Done():
 			return
 		default:
-			eventName := ww.wm.AwaitEvent(ww.ctx)
-			// AwaitEvent returns "" on error, cancellation, or EOF
-			if eventName == "" {
+			event := ww.wm.AwaitEvent(ww.ctx)
+			// AwaitEvent returns EventNone on error, cancellation, or EOF
+			if event.Kind == desktop.EventNone {
 				// Check if the context was cancelled, which is an expected way to stop
 				if ww.ctx.Err() != nil {
 					log.Debug("Window event thread stopping due to context cancellation.")
-				} else {
-					// If context wasn't cancelled, it's likely an X server error/disconnect
-					ww.logError("AwaitEvent returned empty string, likely X connection issue or other error.")
+					return
+				}
+				// If context wasn't cancelled, it's likely an X server error/disconnect
+				ww.logError("AwaitEvent returned no event, likely X connection issue or other error.")
+				if !ww.reconnectWithBackoff() {
+					return
 				}
-				return // Stop the thread in either case
+				continue
 			}
+			ww.handleEvent(event)
+		}
+	}
+}
 
-			// Filter events and update list only for relevant ones
-			switch eventName {
-			case
-				"PropertyNotifyEvent",
-				"MapNotifyEvent",
-				"DestroyNotifyEvent",
-				"CreateNotifyEvent":
-				ww.api.UpdateWindowList()
-			case
-				"UnmapNotifyEvent",
-				"ConfigureNotifyEvent":
-				// log.Debug("Ignoring window event: %s", eventName)
-			default:
-				log.Warn("Unhandled window event type: %s", eventName)
-			}
+// reconnectWithBackoff replaces the lost window manager connection, waiting
+// twice as long after every failed attempt.
+// Returns:
+//
+//	bool: True if reconnected, false if not supervised or stopped meanwhile
+func (ww *WindowWatcher) reconnectWithBackoff() bool {
+	if ww.reconnect == nil {
+		return false
+	}
+
+	delay := ww.backoffMin
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ww.ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		wm, err := ww.reconnect()
+		if err == nil && !wm.InitEvents() {
+			err = fmt.Errorf("failed to initialize events")
 		}
+		if err == nil {
+			ww.wm = wm
+			ww.api.Reconnect(wm)
+			log.Info("Reconnected to the window manager after %d attempts", attempt)
+			return true
+		}
+
+		delay = min(delay*2, ww.backoffMax)
+		ww.logError("Reconnect attempt %d failed, retrying in %s: %v", attempt, delay, err)
+	}
+}
+
+// handleEvent updates the window list for relevant events.
+// Only the window and property named in the event are re-read.
+// Args:
+//
+//	event: Event received from the window manager
+func (ww *WindowWatcher) handleEvent(event desktop.Event) {
+	switch event.Kind {
+	case desktop.EventProperty:
+		ww.handlePropertyEvent(event)
+	case desktop.EventConfigure:
+		ww.api.UpdateWindowGeometry(event.WindowID)
+	case desktop.EventPong:
+		ww.api.HandlePong(event.WindowID)
+	case desktop.EventMonitors:
+		ww.api.UpdateMonitors()
+	case desktop.EventOverflow:
+		// Events were lost, only a full rescan is reliable
+		ww.api.UpdateWindowList()
+	case
+		desktop.EventMap,
+		desktop.EventUnmap,
+		desktop.EventDestroy,
+		desktop.EventCreate,
+		desktop.EventOther:
+		// Client windows come and go with _NET_CLIENT_LIST
+	default:
+		log.Warn("Unhandled window event: %s", event)
+	}
+}
+
+// handlePropertyEvent reacts to a changed property of the root or a client window
+// Args:
+//
+//	event: Property event
+func (ww *WindowWatcher) handlePropertyEvent(event desktop.Event) {
+	switch event.Atom {
+	case "_NET_CLIENT_LIST":
+		ww.api.SyncClientList()
+	case "_NET_ACTIVE_WINDOW":
+		ww.api.UpdateActiveWindow()
+	case "_NET_CLIENT_LIST_STACKING":
+		ww.api.UpdateStacking()
+	case "_NET_CURRENT_DESKTOP":
+		ww.api.UpdateCurrentDesktop()
+	case "_NET_SUPPORTING_WM_CHECK", "_NET_SUPPORTED":
+		ww.api.UpdateCapabilities()
+	default:
+		ww.api.UpdateWindowProperty(event.WindowID, event.Atom)
 	}
 }
 
@@ -0,0 +1,108 @@
+package daemon
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"gofi/pkg/desktop"
+)
+
+// Windows of testdata/gofi_session_mock.trace. The trace is synthetic: the
+// session was scripted against desktop.MockWindowManager and recorded with
+// desktop.Recorder, its window manager is "mock". TestXvfbRecordAndReplay
+// records a session of real X clients.
+const (
+	sessionTerminal = 0x1e00003
+	sessionBrowser  = 0x2200007
+	sessionEditor   = 0x3400002
+	sessionGofi     = 0x4000002
+)
+
+// replaySession plays a session trace file through the event handling of a watcher
+// Args:
+//
+//	t: The test
+//	path: Path of the trace
+//
+// Returns:
+//
+//	*API: The API after the last event
+func replaySession(t *testing.T, path string) *API {
+	t.Helper()
+	replay, err := desktop.OpenReplay(path)
+	if err != nil {
+		t.Fatalf("Failed to open the trace: %v", err)
+	}
+	return replayTrace(t, replay)
+}
+
+// replayTrace plays a session trace through the event handling of a watcher
+// Args:
+//
+//	t: The test
+//	replay: The opened trace
+//
+// Returns:
+//
+//	*API: The API after the last event
+func replayTrace(t *testing.T, replay *desktop.Replay) *API {
+	t.Helper()
+	api := newTestAPI(t, replay)
+	watcher := newTestWatcher(t, replay, api)
+	api.InitializeWindowList()
+
+	for {
+		event := replay.AwaitEvent(context.Background())
+		if event.Kind == desktop.EventNone {
+			return api
+		}
+		watcher.handleEvent(event)
+	}
+}
+
+// historyIDs returns the IDs of the windows in the history, most recent first
+func historyIDs(api *API) []int {
+	api.mutex.RLock()
+	defer api.mutex.RUnlock()
+
+	var ids []int
+	for _, w := range api.windows.history.windows {
+		ids = append(ids, w.ID)
+	}
+	return ids
+}
+
+func TestReplayGofiSession(t *testing.T) {
+	// gofi opens while a browser floods title changes, the editor is picked
+	// and gofi closes, then the browser is activated and closed
+	api := replaySession(t, "testdata/gofi_session_mock.trace")
+
+	if ids := historyIDs(api); !slices.Equal(ids, []int{sessionTerminal, sessionEditor}) {
+		t.Errorf("Expected history [terminal editor], got %x", ids)
+	}
+
+	// The first two windows are swapped for quick toggling
+	clients := api.ClientList()
+	var ids []int
+	for _, w := range clients {
+		ids = append(ids, w.ID)
+	}
+	if !slices.Equal(ids, []int{sessionEditor, sessionTerminal}) {
+		t.Fatalf("Expected client list [editor terminal], got %x", ids)
+	}
+	if clients[0].Title != "● main.go - gofi - Visual Studio Code" || clients[1].Title != "vim README.md" {
+		t.Errorf("Expected the last titles, got %q and %q", clients[0].Title, clients[1].Title)
+	}
+	if clients[0].DesktopName != "work" {
+		t.Errorf("Expected the editor on desktop work, got %q", clients[0].DesktopName)
+	}
+	if active := api.Snapshot().ActiveID(); active != sessionTerminal {
+		t.Errorf("Expected the terminal to be active, got %x", active)
+	}
+	for _, id := range []int{sessionBrowser, sessionGofi} {
+		if _, ok := api.Snapshot().Window(id); ok {
+			t.Errorf("Closed window %x is still listed", id)
+		}
+	}
+}
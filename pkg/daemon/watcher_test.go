@@ -1,7 +1,9 @@
 package daemon
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"gofi/pkg/desktop"
 	"gofi/pkg/shared"
@@ -12,10 +14,10 @@ func TestWatcher(t *testing.T) {
 	wm := desktop.NewMockWindowManager()
 
 	// Create API
-	api := NewAPI()
+	api := newTestAPI(t, wm)
 
 	// Create watcher
-	watcher := NewWindowWatcher(wm, api)
+	watcher := newTestWatcher(t, wm, api)
 
 	// Test starting watcher
 	if !watcher.Start() {
@@ -49,3 +51,127 @@ func (m *mockAPI) RemoveWindow(w *shared.Window) {
 		}
 	}
 }
+
+func TestWatcherHandlesTypedEvents(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	api := newTestAPI(t, wm)
+	watcher := newTestWatcher(t, wm, api)
+	sub := api.Subscribe(nil)
+	defer sub.Cancel()
+
+	if !watcher.Start() {
+		t.Fatal("Failed to start watcher")
+	}
+	defer watcher.Stop()
+
+	wm.SetWindowTitle(2, "Browser - News")
+	wm.EnqueueEvent(desktop.Event{Kind: desktop.EventProperty, WindowID: 2, Atom: "_NET_WM_NAME"})
+	expectEvent(t, sub, EventTitleChanged, 2)
+
+	wm.AddWindow(shared.NewWindow(4, "Mail", "thunderbird", "Normal", "thunderbird", 0, 88))
+	wm.EnqueueEvent(desktop.Event{Kind: desktop.EventProperty, WindowID: 1, Atom: "_NET_CLIENT_LIST"})
+	expectEvent(t, sub, EventWindowAdded, 4)
+}
+
+func TestWatcherPublishesCurrentDesktop(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	api := newTestAPI(t, wm)
+	watcher := newTestWatcher(t, wm, api)
+	sub := api.Subscribe([]EventType{EventCurrentDesktopChanged})
+	defer sub.Cancel()
+
+	if !watcher.Start() {
+		t.Fatal("Failed to start watcher")
+	}
+	defer watcher.Stop()
+
+	if err := wm.SwitchDesktop(1); err != nil {
+		t.Fatalf("SwitchDesktop failed: %v", err)
+	}
+	wm.EnqueueEvent(desktop.Event{Kind: desktop.EventProperty, WindowID: 1, Atom: "_NET_CURRENT_DESKTOP"})
+	select {
+	case event := <-sub.Events:
+		if event.Desktop == nil || *event.Desktop != 1 || event.Window.ID != 0 {
+			t.Errorf("Expected a change to desktop 1 without a window, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the desktop change")
+	}
+
+	// Re-reading an unchanged desktop publishes nothing
+	api.UpdateCurrentDesktop()
+	select {
+	case event := <-sub.Events:
+		t.Errorf("Unexpected event %+v", event)
+	default:
+	}
+}
+
+// expectEvent waits for the next event and checks its type and window
+func expectEvent(t *testing.T, sub *Subscription, eventType EventType, windowID int) {
+	t.Helper()
+	select {
+	case event := <-sub.Events:
+		if event.Type != eventType || event.Window.ID != windowID {
+			t.Errorf("Got %s for window %d, want %s for window %d",
+				event.Type, event.Window.ID, eventType, windowID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for %s", eventType)
+	}
+}
+
+func TestWatcherReconnects(t *testing.T) {
+	old := desktop.NewMockWindowManager()
+	api := newTestAPI(t, old)
+	watcher := newTestWatcher(t, old, api)
+	watcher.backoffMin = time.Millisecond
+
+	// The new connection sees window 1 gone and window 4 new and active
+	replacement := desktop.NewMockWindowManager()
+	replacement.RemoveWindow(1)
+	replacement.AddWindow(shared.NewWindow(4, "Mail", "thunderbird", "Normal", "thunderbird", 0, 88))
+	replacement.SetActiveWindow(4)
+
+	attempts := make(chan int, 10)
+	watcher.SetReconnect(func() (desktop.WindowManager, error) {
+		attempts <- 1
+		if len(attempts) == 1 {
+			return nil, fmt.Errorf("display not ready")
+		}
+		return replacement, nil
+	})
+
+	if !watcher.Start() {
+		t.Fatal("Failed to start watcher")
+	}
+	defer watcher.Stop()
+
+	// Most recently used first: 3, 2, 1
+	for _, id := range []int{2, 3} {
+		old.SetActiveWindow(id)
+		api.UpdateActiveWindow()
+	}
+	sub := api.Subscribe(nil)
+	defer sub.Cancel()
+
+	old.EnqueueEvent(desktop.Event{Kind: desktop.EventNone})
+	expectEvent(t, sub, EventWindowRemoved, 1)
+	expectEvent(t, sub, EventWindowAdded, 4)
+	expectEvent(t, sub, EventActiveChanged, 4)
+
+	if got := len(attempts); got != 2 {
+		t.Errorf("Expected 2 reconnect attempts, got %d", got)
+	}
+	api.mutex.RLock()
+	history := ids(api.windows.history.windows)
+	api.mutex.RUnlock()
+	if !equalIDs(history, []int{4, 3, 2}) {
+		t.Errorf("History after reconnect: got %v, want [4 3 2]", history)
+	}
+
+	// Events now come from the new connection
+	replacement.SetWindowTitle(2, "Browser - News")
+	replacement.EnqueueEvent(desktop.Event{Kind: desktop.EventProperty, WindowID: 2, Atom: "_NET_WM_NAME"})
+	expectEvent(t, sub, EventTitleChanged, 2)
+}
@@ -0,0 +1,217 @@
+package daemon
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"gofi/pkg/desktop"
+	"gofi/pkg/desktop/xtest"
+)
+
+// setupXvfbWatcher starts Xvfb with a fake window manager and a watcher
+// keeping an API up to date.
+// Skips the test if Xvfb is not installed.
+func setupXvfbWatcher(t *testing.T) (*API, desktop.WindowManager, *xtest.Server) {
+	server := xtest.StartXvfb(t)
+	xtest.StartFakeWM(t, server)
+
+	wm, err := desktop.NewXLibWindowManager()
+	if err != nil {
+		t.Fatalf("Failed to connect to Xvfb: %v", err)
+	}
+	t.Cleanup(wm.Cleanup)
+
+	api := newTestAPI(t, wm)
+	watcher := newTestWatcher(t, wm, api)
+	if !watcher.Start() {
+		t.Fatal("Failed to start watcher")
+	}
+	t.Cleanup(func() { watcher.Stop() })
+	return api, wm, server
+}
+
+// snapshotTitle returns the title of a window in the current snapshot,
+// false if it is not listed
+func snapshotTitle(api *API, windowID int) (string, bool) {
+	w, ok := api.Snapshot().Window(windowID)
+	return w.Title, ok
+}
+
+func TestXvfbWatcherTracksClients(t *testing.T) {
+	api, wm, server := setupXvfbWatcher(t)
+
+	terminal := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Terminal", Instance: "st", Class: "st"})
+	xtest.WaitFor(t, "the terminal to be listed", func() bool {
+		title, ok := snapshotTitle(api, terminal.ID())
+		return ok && title == "Terminal"
+	})
+
+	terminal.SetTitle("vim README.md")
+	xtest.WaitFor(t, "the title change", func() bool {
+		title, _ := snapshotTitle(api, terminal.ID())
+		return title == "vim README.md"
+	})
+
+	browser := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Browser", Instance: "Navigator", Class: "firefox"})
+	xtest.WaitFor(t, "the browser to be listed and active", func() bool {
+		return api.Snapshot().ActiveID() == browser.ID()
+	})
+
+	if err := wm.ActivateWindow(terminal.ID()); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the terminal to become active", func() bool {
+		return api.Snapshot().ActiveID() == terminal.ID()
+	})
+
+	browser.Destroy()
+	xtest.WaitFor(t, "the browser to be removed", func() bool {
+		_, ok := snapshotTitle(api, browser.ID())
+		return !ok && len(api.Snapshot().Windows()) == 1
+	})
+}
+
+func TestXvfbAutoCloser(t *testing.T) {
+	api, wm, server := setupXvfbWatcher(t)
+
+	editor := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Editor", Instance: "code", Class: "Code"})
+	gofi := xtest.NewClient(t, server, xtest.ClientOptions{Title: "gofi", Instance: "st", Class: "st-256color"})
+	xtest.WaitFor(t, "the gofi window to become active", func() bool {
+		return api.Snapshot().ActiveID() == gofi.ID()
+	})
+
+	// Focusing another window closes the gofi window
+	if err := wm.ActivateWindow(editor.ID()); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the gofi window to close", func() bool {
+		_, listed := snapshotTitle(api, gofi.ID())
+		return gofi.Closed() && !listed
+	})
+	if editor.Closed() {
+		t.Error("The editor was closed too")
+	}
+
+	// Other windows losing the focus stay open
+	terminal := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Terminal", Instance: "st", Class: "st-256color"})
+	xtest.WaitFor(t, "the terminal to become active", func() bool {
+		return api.Snapshot().ActiveID() == terminal.ID()
+	})
+	if err := wm.ActivateWindow(editor.ID()); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the editor to become active", func() bool {
+		return api.Snapshot().ActiveID() == editor.ID()
+	})
+	if terminal.Closed() {
+		t.Error("The terminal was closed after losing the focus")
+	}
+}
+
+func TestXvfbCloseWindowAnsweringPings(t *testing.T) {
+	api, wm, server := setupXvfbWatcher(t)
+	api.SetCloseTimeout(500 * time.Millisecond)
+
+	busy := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Unsaved", Instance: "gedit", Class: "Gedit", Busy: true})
+	hung := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Hung", Instance: "hung", Class: "Hung", Hung: true})
+	xtest.WaitFor(t, "both windows to be listed", func() bool {
+		return len(api.Snapshot().Windows()) == 2
+	})
+
+	if err := api.CloseWindow(busy.ID()); err != nil {
+		t.Fatalf("CloseWindow failed: %v", err)
+	}
+	if err := api.CloseWindow(hung.ID()); err != nil {
+		t.Fatalf("CloseWindow failed: %v", err)
+	}
+	// Ping rounds as the watcher runs them, only faster
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		api.PingWindows(100 * time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	xtest.WaitFor(t, "the hung window to be killed", func() bool {
+		return hung.Closed()
+	})
+	if busy.Closed() || !listed(wm, busy.ID()) {
+		t.Error("The window answering pings was killed")
+	}
+	if window, _ := api.Snapshot().Window(busy.ID()); window.NotResponding {
+		t.Error("The window answering pings is marked as not responding")
+	}
+}
+
+func TestXvfbRecordAndReplay(t *testing.T) {
+	server := xtest.StartXvfb(t)
+	xtest.StartFakeWM(t, server)
+	wm, err := desktop.NewXLibWindowManager()
+	if err != nil {
+		t.Fatalf("Failed to connect to Xvfb: %v", err)
+	}
+	t.Cleanup(wm.Cleanup)
+
+	var buffer bytes.Buffer
+	recorder := desktop.NewRecorder(wm, desktop.NewTraceWriter(&buffer))
+	api := newTestAPI(t, recorder)
+	watcher := newTestWatcher(t, recorder, api)
+	if !watcher.Start() {
+		t.Fatal("Failed to start watcher")
+	}
+
+	// A terminal and an editor open, the terminal changes its title and is
+	// activated again, then the editor closes
+	terminal := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Terminal", Instance: "st", Class: "st", PID: 1414})
+	editor := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Editor", Instance: "code", Class: "Code", PID: 2718})
+	xtest.WaitFor(t, "the editor to become active", func() bool {
+		return api.Snapshot().ActiveID() == editor.ID()
+	})
+	terminal.SetTitle("vim README.md")
+	if err := wm.ActivateWindow(terminal.ID()); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the terminal to become active with its new title", func() bool {
+		title, _ := snapshotTitle(api, terminal.ID())
+		return api.Snapshot().ActiveID() == terminal.ID() && title == "vim README.md"
+	})
+	editor.Destroy()
+	xtest.WaitFor(t, "the editor to be removed", func() bool {
+		_, ok := snapshotTitle(api, editor.ID())
+		return !ok
+	})
+	watcher.Stop()
+	watcher.eventThread.Wait()
+
+	replay, err := desktop.NewReplay(&buffer)
+	if err != nil {
+		t.Fatalf("The recorded trace does not replay: %v", err)
+	}
+	if caps := replay.Capabilities(); caps.WindowManager != xtest.FakeWMName {
+		t.Errorf("Expected the trace of the fake window manager, got %q", caps.WindowManager)
+	}
+	replayed := replayTrace(t, replay)
+	if windows := replayed.Snapshot().Windows(); len(windows) != 1 {
+		t.Fatalf("Expected only the terminal after the replay, got %v", windows)
+	}
+	if title, _ := snapshotTitle(replayed, terminal.ID()); title != "vim README.md" {
+		t.Errorf("Expected the new title after the replay, got %q", title)
+	}
+	if active := replayed.Snapshot().ActiveID(); active != terminal.ID() {
+		t.Errorf("Expected the terminal to be active after the replay, got %x", active)
+	}
+	if ids := historyIDs(replayed); !slices.Contains(ids, terminal.ID()) || slices.Contains(ids, editor.ID()) {
+		t.Errorf("Expected the terminal and not the editor in the history, got %x", ids)
+	}
+}
+
+// listed checks whether a window is a client window
+func listed(wm desktop.WindowManager, windowID int) bool {
+	for _, id := range wm.ClientIDs() {
+		if id == windowID {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package daemon
 
 import (
+	"time"
+
 	"gofi/pkg/desktop"
 	"gofi/pkg/log"
 	"gofi/pkg/shared"
@@ -12,19 +14,23 @@ const (
 )
 
 // WindowList manages the current list and history of windows.
+// Windows are cached and updated one property at a time, see UpdateProperty.
+// Cached windows are never modified, updates replace them with a copy.
 type WindowList struct {
-	wm      desktop.WindowManager
-	history *History // Maintains the ordered history and active window state
+	wm       desktop.WindowManager
+	history  *History               // Maintains the ordered history and active window state
+	activeID int                    // Active window as last reported by the WindowManager
+	current  int                    // Current desktop as last reported by the WindowManager
+	cache    map[int]*shared.Window // Current windows by ID
+	monitors []shared.Monitor       // Monitors as of the last full scan or monitor change
+	stacking []int                  // Window IDs from top to bottom, empty if not advertised
+	pings    map[int]time.Time      // Unanswered pings by window ID
 }
 
 // NewWindowList creates a new WindowList instance.
-// It requires a WindowManager and a History instance.
-// If wm or history are nil, it uses default implementations.
+// It requires a WindowManager, NewAPI checks it is given.
+// If history is nil, a new one is used.
 func NewWindowList(wm desktop.WindowManager, history *History) *WindowList {
-	if wm == nil {
-		// Rely on desktop.Instance() to handle its own potential errors/nil return
-		wm = desktop.Instance()
-	}
 	if history == nil {
 		history = NewHistory()
 	}
@@ -32,26 +38,80 @@ func NewWindowList(wm desktop.WindowManager, history *History) *WindowList {
 	return &WindowList{
 		wm:      wm,
 		history: history,
+		cache:   make(map[int]*shared.Window),
+		current: -1,
+		pings:   make(map[int]time.Time),
 	}
 }
 
 // Initialize fetches the current window state and populates the history.
 // It should be called once when the service starts.
+// Without a history yet, windows start in stacking order if the window
+// manager advertises one, so the recently raised windows come first.
 func (wl *WindowList) Initialize() {
 	initialWindows := wl.wm.StackingList()
+	wl.UpdateStacking()
+	if len(wl.stacking) > 0 {
+		initialWindows = sortByStacking(initialWindows, wl.stacking)
+	}
 	// Assume StackingList returns a valid slice (even if empty) or history handles nil
 	wl.history.Initialize(initialWindows)
+	wl.setCache(initialWindows)
+	wl.monitors = wl.wm.Monitors()
 
-	activeID := wl.wm.ActiveWindowID()
-	wl.history.UpdateActiveWindow(activeID)
+	wl.activeID = wl.wm.ActiveWindowID()
+	wl.history.UpdateActiveWindow(wl.activeID)
+	wl.current = wl.wm.CurrentDesktop()
 	log.Debug("WindowList initialized.") // Simplified log message
 }
 
-// UpdateWindowList refreshes the window list based on the current state from the WindowManager.
+// UpdateWindowList rescans all windows from the WindowManager.
 // It updates the internal history and logs the list if changes occurred.
+// Expensive, prefer SyncClientList and UpdateProperty when reacting to events.
 func (wl *WindowList) UpdateWindowList() {
 	currentWindows := wl.wm.StackingList()
+	wl.monitors = wl.wm.Monitors()
+	wl.current = wl.wm.CurrentDesktop()
+	wl.applyClientList(currentWindows)
+}
+
+// Reconnect switches to a new WindowManager and rescans all windows.
+// Unlike Initialize the history is kept for windows that still exist.
+func (wl *WindowList) Reconnect(wm desktop.WindowManager) {
+	wl.wm = wm
+	wl.pings = make(map[int]time.Time) // Answers to old pings are lost
+	wl.UpdateStacking()
+	wl.UpdateWindowList()
+	log.Debug("WindowList reconnected")
+}
+
+// SyncClientList updates the list after the set of client windows changed.
+// Only windows not cached yet are fetched from the WindowManager.
+func (wl *WindowList) SyncClientList() {
+	clientIDs := wl.wm.ClientIDs()
+	if clientIDs == nil {
+		log.Warn("Could not read client list, keeping current windows")
+		return
+	}
+
+	currentWindows := make([]*shared.Window, 0, len(clientIDs))
+	for _, id := range clientIDs {
+		window := wl.cache[id]
+		if window == nil {
+			window = wl.wm.WindowInfo(id)
+		}
+		if window != nil {
+			currentWindows = append(currentWindows, window)
+		}
+	}
+	wl.applyClientList(currentWindows)
+}
+
+// applyClientList replaces the cached windows and updates the history
+func (wl *WindowList) applyClientList(currentWindows []*shared.Window) {
+	wl.setCache(currentWindows)
 	activeID := wl.wm.ActiveWindowID()
+	wl.activeID = activeID
 
 	// Update history state
 	listChanged := wl.history.KeepOnly(currentWindows)
@@ -64,53 +124,221 @@ func (wl *WindowList) UpdateWindowList() {
 	}
 }
 
-// ClientList prepares and returns the window list formatted for client consumption (e.g., Alt-Tab).
-// It partitions windows by type ("Normal" vs. others) and swaps the first two for quick toggling.
-// Returns nil if the history is empty.
-func (wl *WindowList) ClientList() []*shared.Window {
-	orderedWindows := wl.history.windows
-	if len(orderedWindows) == 0 {
-		return nil
+// UpdateActiveWindow re-reads the active window and moves it to the front.
+// Returns true if the active window changed.
+func (wl *WindowList) UpdateActiveWindow() bool {
+	activeID := wl.wm.ActiveWindowID()
+	changed := activeID != wl.activeID
+	wl.activeID = activeID
+	if wl.history.UpdateActiveWindow(activeID) {
+		wl.logWindowList(wl.history.windows)
+		changed = true
 	}
+	return changed
+}
 
-	// Partition and reorder for presentation
-	presentedList := wl.partitionAndReorder(orderedWindows)
+// UpdateCurrentDesktop re-reads the current desktop from the WindowManager.
+// Returns true if another desktop is shown.
+func (wl *WindowList) UpdateCurrentDesktop() bool {
+	current := wl.wm.CurrentDesktop()
+	changed := current != wl.current
+	wl.current = current
+	return changed
+}
 
-	// Perform Alt-Tab swap
-	wl.applyAltTabSwap(presentedList)
+// UpdateStacking re-reads the stacking order from the WindowManager.
+// Returns true if the order changed.
+func (wl *WindowList) UpdateStacking() bool {
+	bottomToTop := wl.wm.StackingOrder()
+	stacking := make([]int, len(bottomToTop))
+	for i, id := range bottomToTop {
+		stacking[len(bottomToTop)-1-i] = id
+	}
 
-	// We have to update all titles now
-	for _, w := range presentedList {
-		w.Title = wl.wm.WindowTitle(w.ID)
+	changed := len(stacking) != len(wl.stacking)
+	for i := 0; !changed && i < len(stacking); i++ {
+		changed = stacking[i] != wl.stacking[i]
 	}
+	wl.stacking = stacking
+	return changed
+}
 
-	return presentedList
+// UpdateProperty re-reads the field backed by a changed property of one window.
+// Properties gofi does not show and unknown windows are ignored without asking
+// the WindowManager. Returns true if the window changed.
+func (wl *WindowList) UpdateProperty(windowID int, atom string) bool {
+	if wl.cache[windowID] == nil {
+		return false
+	}
+
+	switch atom {
+	case "_NET_WM_NAME", "WM_NAME":
+		return wl.updateWindow(windowID, func(w *shared.Window) {
+			w.Title = wl.wm.WindowTitle(windowID)
+		})
+	case "WM_CLASS":
+		return wl.updateWindow(windowID, func(w *shared.Window) {
+			w.Instance, w.ClassName = wl.wm.WindowClass(windowID)
+		})
+	case "_NET_WM_DESKTOP":
+		return wl.updateWindow(windowID, func(w *shared.Window) {
+			w.Desktop = wl.wm.WindowDesktop(windowID)
+		})
+	case "_NET_WM_STATE":
+		return wl.updateWindow(windowID, func(w *shared.Window) {
+			w.State = wl.wm.WindowState(windowID)
+		})
+	case "_NET_WM_WINDOW_TYPE":
+		// Rare, simply fetch the whole window again
+		window := wl.wm.WindowInfo(windowID)
+		return window != nil && wl.updateWindow(windowID, func(w *shared.Window) {
+			notResponding := w.NotResponding
+			*w = *window
+			w.NotResponding = notResponding
+		})
+	}
+	return false
 }
 
-// partitionAndReorder separates windows into "Normal" and "Special" types,
-// returning a new slice with "Normal" windows first.
-func (wl *WindowList) partitionAndReorder(windows []*shared.Window) []*shared.Window {
-	normalWindows := make([]*shared.Window, 0, len(windows))
-	specialWindows := make([]*shared.Window, 0, len(windows))
+// ExpirePings marks windows as not responding whose ping is older than the
+// timeout.
+// Returns true if a window was marked.
+func (wl *WindowList) ExpirePings(now time.Time, timeout time.Duration) bool {
+	changed := false
+	for id, sent := range wl.pings {
+		if wl.cache[id] == nil {
+			delete(wl.pings, id)
+		} else if now.Sub(sent) >= timeout && wl.setResponding(id, false) {
+			log.Info("Window %d is not responding", id)
+			changed = true
+		}
+	}
+	return changed
+}
 
-	for _, w := range windows {
-		// Assume w is not nil and w.Type is valid, as per original code's implicit assumption
-		if w.Type == "Normal" {
-			normalWindows = append(normalWindows, w)
-		} else { // Treat non-Normal as Special
-			specialWindows = append(specialWindows, w)
+// StartPings records a ping sent now to every window without an unanswered
+// ping. The pings are sent by the caller without holding the lock, recording
+// them first keeps an early pong from being lost.
+// Returns the IDs of the windows to ping.
+func (wl *WindowList) StartPings(now time.Time) []int {
+	var ids []int
+	for id := range wl.cache {
+		if _, pending := wl.pings[id]; !pending {
+			wl.pings[id] = now
+			ids = append(ids, id)
 		}
 	}
-	return append(normalWindows, specialWindows...)
+	return ids
 }
 
-// applyAltTabSwap swaps the first two elements of the slice if it has at least two elements.
-func (wl *WindowList) applyAltTabSwap(windows []*shared.Window) {
-	if len(windows) >= 2 {
-		windows[0], windows[1] = windows[1], windows[0]
+// CancelPings forgets pings from StartPings that could not be sent
+func (wl *WindowList) CancelPings(windowIDs []int, sent time.Time) {
+	for _, id := range windowIDs {
+		if wl.pings[id].Equal(sent) {
+			delete(wl.pings, id)
+		}
 	}
 }
 
+// Pong handles the answer of a window to a ping.
+// Returns true if the window was marked as not responding before.
+func (wl *WindowList) Pong(windowID int) bool {
+	delete(wl.pings, windowID)
+	if wl.setResponding(windowID, true) {
+		log.Info("Window %d is responding again", windowID)
+		return true
+	}
+	return false
+}
+
+// setResponding updates the NotResponding flag of a window.
+// Returns true if the flag changed.
+func (wl *WindowList) setResponding(windowID int, responding bool) bool {
+	return wl.updateWindow(windowID, func(w *shared.Window) { w.NotResponding = !responding })
+}
+
+// UpdateGeometry re-reads the geometry and monitor of one window.
+// Returns true if the window changed.
+func (wl *WindowList) UpdateGeometry(windowID int) bool {
+	if wl.cache[windowID] == nil {
+		return false
+	}
+	return wl.updateWindow(windowID, func(w *shared.Window) {
+		w.Geometry = wl.wm.WindowGeometry(windowID)
+		w.Monitor = shared.MonitorFor(w.Geometry, wl.monitors)
+	})
+}
+
+// UpdateMonitors re-reads the monitors after they changed and assigns every
+// window to the monitor now showing most of it.
+// Returns true if a window moved to another monitor.
+func (wl *WindowList) UpdateMonitors() bool {
+	wl.monitors = wl.wm.Monitors()
+	changed := false
+	for id := range wl.cache {
+		changed = wl.updateWindow(id, func(w *shared.Window) {
+			w.Monitor = shared.MonitorFor(w.Geometry, wl.monitors)
+		}) || changed
+	}
+	return changed
+}
+
+// MoveWindow updates the history after a window was moved to another desktop,
+// without waiting for the window manager to report the change.
+func (wl *WindowList) MoveWindow(windowID int, desktop int) {
+	if wl.updateWindow(windowID, func(w *shared.Window) { w.Desktop = desktop }) {
+		log.Debug("Window %d moved to desktop %d", windowID, desktop)
+	}
+}
+
+// updateWindow applies a change to a copy of a cached window and replaces the
+// cached and history entries with it. Returns true if the window changed.
+func (wl *WindowList) updateWindow(windowID int, change func(*shared.Window)) bool {
+	cached := wl.cache[windowID]
+	if cached == nil {
+		return false
+	}
+	updated := *cached
+	change(&updated)
+	if updated == *cached {
+		return false
+	}
+	wl.cache[windowID] = &updated
+	wl.history.Replace(&updated)
+	return true
+}
+
+// setCache replaces all cached windows.
+// Rescanned windows keep the NotResponding flag, the WindowManager does not know it.
+func (wl *WindowList) setCache(windows []*shared.Window) {
+	previous := wl.cache
+	wl.cache = make(map[int]*shared.Window, len(windows))
+	for _, w := range windows {
+		if old := previous[w.ID]; old != nil && old.NotResponding && !w.NotResponding {
+			w.NotResponding = true // Only fresh windows lack the flag
+		}
+		wl.cache[w.ID] = w
+	}
+}
+
+// snapshot returns a copy of the current windows, stacking order and
+// active window. The generation is left to the caller.
+func (wl *WindowList) snapshot() *Snapshot {
+	return newSnapshot(wl.history.windows, wl.stacking, wl.activeID, wl.current)
+}
+
+// ClientList prepares and returns the window list formatted for client consumption (e.g., Alt-Tab).
+// It partitions windows by type ("Normal" vs. others) and swaps the first two for quick toggling.
+// Returns nil if the history is empty.
+func (wl *WindowList) ClientList() []*shared.Window {
+	return wl.ListWindows(WindowListParams{})
+}
+
+// ListWindows is ClientList with a monitor filter and sort mode, see Snapshot.List
+func (wl *WindowList) ListWindows(options WindowListParams) []*shared.Window {
+	return wl.snapshot().List(options, wl.wm.DesktopNames())
+}
+
 // logWindowList formats and logs the provided window list for debugging.
 func (wl *WindowList) logWindowList(windows []*shared.Window) {
 	log.Debug("Window state changed. Current list (%d windows):", len(windows))
@@ -2,8 +2,10 @@ package daemon
 
 import (
 	"testing"
+	"time"
 
 	"gofi/pkg/desktop"
+	"gofi/pkg/shared"
 )
 
 func TestWindowList(t *testing.T) {
@@ -43,3 +45,249 @@ func TestWindowList(t *testing.T) {
 		}
 	}
 }
+
+func TestClientListDesktopNames(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	wl := NewWindowList(wm, nil)
+	wl.Initialize()
+
+	for _, win := range wl.ClientList() {
+		want := []string{"main", "work"}[win.Desktop]
+		if win.DesktopName != want {
+			t.Errorf("Window %d on desktop %d: got name %q, want %q",
+				win.ID, win.Desktop, win.DesktopName, want)
+		}
+	}
+}
+
+func TestClientListSkipsSkipTaskbarWindows(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	panel := shared.NewWindow(4, "Panel", "polybar", "Normal", "polybar", -1, 77)
+	panel.State = shared.StateSkipTaskbar | shared.StateSticky
+	wm.AddWindow(panel)
+
+	wl := NewWindowList(wm, nil)
+	wl.Initialize()
+
+	for _, win := range wl.ClientList() {
+		if win.ID == panel.ID {
+			t.Error("Expected skip-taskbar window to be left out")
+		}
+	}
+}
+
+func TestListWindowsByMonitor(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	left := shared.NewWindow(4, "Mail", "thunderbird", "Normal", "thunderbird", 0, 88)
+	left.Monitor = "DP-1"
+	right := shared.NewWindow(5, "Chat", "slack", "Normal", "slack", 0, 99)
+	right.Monitor = "DP-2"
+	wm.AddWindow(left)
+	wm.AddWindow(right)
+	wm.SetActiveWindow(right.ID)
+
+	wl := NewWindowList(wm, nil)
+	wl.Initialize()
+
+	if got := len(wl.ListWindows(WindowListParams{})); got != 5 {
+		t.Errorf("Unfiltered list: got %d windows, want 5", got)
+	}
+	onLeft := wl.ListWindows(WindowListParams{Monitor: "DP-1"})
+	if len(onLeft) != 1 || onLeft[0].ID != left.ID {
+		t.Errorf("Windows on DP-1: got %v, want only window 4", onLeft)
+	}
+	current := wl.ListWindows(WindowListParams{Monitor: MonitorCurrent})
+	if len(current) != 1 || current[0].ID != right.ID {
+		t.Errorf("Windows on current monitor: got %v, want only window 5", current)
+	}
+}
+
+func TestUpdateMonitorsAfterHotplug(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	laptop := shared.Monitor{Name: "eDP-1", Geometry: shared.Geometry{Width: 1920, Height: 1080}}
+	wm.SetMonitors([]shared.Monitor{laptop})
+	mail := shared.NewWindow(4, "Mail", "thunderbird", "Normal", "thunderbird", 0, 88)
+	mail.Geometry = shared.Geometry{X: 100, Y: 100, Width: 800, Height: 600}
+	mail.Monitor = "eDP-1"
+	wm.AddWindow(mail)
+
+	wl := NewWindowList(wm, nil)
+	wl.Initialize()
+	if wl.UpdateMonitors() {
+		t.Error("Unchanged monitors changed a window")
+	}
+
+	// An external monitor takes over the left side, the laptop moves right
+	external := shared.Monitor{Name: "DP-1", Geometry: shared.Geometry{Width: 2560, Height: 1440}}
+	laptop.Geometry.X = 2560
+	wm.SetMonitors([]shared.Monitor{external, laptop})
+	if !wl.UpdateMonitors() {
+		t.Fatal("Expected the window to move to the external monitor")
+	}
+	if onExternal := wl.ListWindows(WindowListParams{Monitor: "DP-1"}); len(onExternal) != 1 || onExternal[0].ID != mail.ID {
+		t.Errorf("Windows on DP-1: got %v, want only window 4", onExternal)
+	}
+}
+
+func TestListWindowsStacking(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	wm.SetActiveWindow(2)
+	// Bottom to top: the editor is raised above the terminal
+	wm.SetStackingOrder([]int{2, 1, 3})
+
+	wl := NewWindowList(wm, nil)
+	wl.Initialize()
+
+	// Without a history the stacking order seeds it, active window first
+	if got := ids(wl.history.windows); !equalIDs(got, []int{2, 3, 1}) {
+		t.Errorf("Initial history: got %v, want [2 3 1]", got)
+	}
+
+	wm.SetStackingOrder([]int{3, 2, 1})
+	if !wl.UpdateStacking() {
+		t.Error("Expected stacking change to be reported")
+	}
+	if wl.UpdateStacking() {
+		t.Error("Expected unchanged stacking order to report no change")
+	}
+
+	// Topmost first, then the usual swap of the first two
+	stacked := ids(wl.ListWindows(WindowListParams{Sort: SortStacking}))
+	if !equalIDs(stacked, []int{2, 1, 3}) {
+		t.Errorf("Stacking sort: got %v, want [2 1 3]", stacked)
+	}
+	mru := ids(wl.ListWindows(WindowListParams{Sort: SortMRU}))
+	if !equalIDs(mru, []int{3, 2, 1}) {
+		t.Errorf("MRU sort: got %v, want [3 2 1]", mru)
+	}
+
+	// Without a stacking order the history is used
+	wm.SetStackingOrder(nil)
+	wl.UpdateStacking()
+	if got := ids(wl.ListWindows(WindowListParams{Sort: SortStacking})); !equalIDs(got, mru) {
+		t.Errorf("Stacking sort without stacking order: got %v, want %v", got, mru)
+	}
+}
+
+func ids(windows []*shared.Window) []int {
+	result := make([]int, len(windows))
+	for i, w := range windows {
+		result[i] = w.ID
+	}
+	return result
+}
+
+func TestIncrementalUpdates(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	wl := NewWindowList(wm, nil)
+	wl.Initialize()
+
+	// A title change re-reads only that title
+	titles := wm.CallCount("WindowTitle")
+	wm.SetWindowTitle(2, "Browser - News")
+	if !wl.UpdateProperty(2, "_NET_WM_NAME") {
+		t.Error("Expected title change to be reported")
+	}
+	if got := wm.CallCount("WindowTitle") - titles; got != 1 {
+		t.Errorf("Title change: got %d title reads, want 1", got)
+	}
+	if got := wl.cache[2].Title; got != "Browser - News" {
+		t.Errorf("Cached title: got %q", got)
+	}
+
+	// Unknown windows and uninteresting properties are ignored
+	if wl.UpdateProperty(42, "_NET_WM_NAME") || wl.UpdateProperty(2, "_NET_WM_ICON") {
+		t.Error("Expected ignored updates to report no change")
+	}
+
+	// A client list change fetches only the new window
+	wm.AddWindow(shared.NewWindow(4, "Mail", "thunderbird", "Normal", "thunderbird", 0, 88))
+	wm.RemoveWindow(1)
+	wl.SyncClientList()
+	if got := wm.CallCount("WindowInfo"); got != 1 {
+		t.Errorf("Client list sync: got %d window fetches, want 1", got)
+	}
+	if wl.cache[4] == nil || wl.cache[1] != nil {
+		t.Errorf("Cache not synced: %v", wl.cache)
+	}
+	if got := wm.CallCount("StackingList"); got != 1 {
+		t.Errorf("Got %d full scans, want only the initial one", got)
+	}
+
+	// State changes are picked up per window
+	wm.SetWindowState(3, shared.StateAbove, true)
+	if !wl.UpdateProperty(3, "_NET_WM_STATE") || !wl.history.Find(3).State.Has(shared.StateAbove) {
+		t.Error("Expected state change in history")
+	}
+}
+
+// pingWindows runs one round of pings the way API.PingWindows does
+func pingWindows(wl *WindowList, now time.Time, timeout time.Duration) bool {
+	changed := wl.ExpirePings(now, timeout)
+	var failed []int
+	for _, id := range wl.StartPings(now) {
+		if !wl.wm.PingWindow(id) {
+			failed = append(failed, id)
+		}
+	}
+	wl.CancelPings(failed, now)
+	return changed
+}
+
+func TestPingMarksHungWindows(t *testing.T) {
+	wm := desktop.NewMockWindowManager()
+	wm.SetHung(3, true)
+	wl := NewWindowList(wm, nil)
+	wl.Initialize()
+
+	start := time.Now()
+	if pingWindows(wl, start, 3*time.Second) {
+		t.Error("Expected no change on the first round of pings")
+	}
+	if got := len(wm.Pings()); got != 3 {
+		t.Fatalf("Expected 3 pings, got %d", got)
+	}
+	wl.Pong(1)
+	wl.Pong(2)
+
+	if !pingWindows(wl, start.Add(5*time.Second), 3*time.Second) {
+		t.Error("Expected window 3 to be marked as not responding")
+	}
+	for _, w := range wl.ClientList() {
+		if w.NotResponding != (w.ID == 3) {
+			t.Errorf("Window %d: NotResponding is %v", w.ID, w.NotResponding)
+		}
+	}
+	// Only answered pings are repeated
+	if got := len(wm.Pings()); got != 5 {
+		t.Errorf("Expected 5 pings, got %d", got)
+	}
+
+	// A rescan does not forget the marker
+	wl.UpdateWindowList()
+	if !wl.cache[3].NotResponding {
+		t.Error("Expected rescan to keep the not responding marker")
+	}
+
+	if !wl.Pong(3) || wl.cache[3].NotResponding {
+		t.Error("Expected late answer to clear the marker")
+	}
+
+	// A pong arriving before the ping was sent completely still counts
+	wl.Pong(1)
+	wl.Pong(2)
+	ids := wl.StartPings(start.Add(6 * time.Second))
+	for _, id := range ids {
+		wl.Pong(id)
+	}
+	if wl.ExpirePings(start.Add(10*time.Second), 3*time.Second) {
+		t.Error("Expected early answers to count")
+	}
+
+	// Pings that could not be sent are not waited for
+	ids = wl.StartPings(start.Add(11 * time.Second))
+	wl.CancelPings(ids, start.Add(11*time.Second))
+	if len(wl.pings) != 0 {
+		t.Errorf("Expected no pending pings, got %v", wl.pings)
+	}
+}
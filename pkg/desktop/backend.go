@@ -0,0 +1,220 @@
+package desktop
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gofi/pkg/log"
+)
+
+// BackendAuto selects the best available backend
+const BackendAuto = "auto"
+
+// Backend is a window manager implementation gofi can run on
+// Fields:
+//
+//	Name: Name for --backend, e.g. "x11"
+//	Priority: Order of automatic selection, higher is tried first
+//	Probe: Checks the environment, returns why the backend cannot work here or nil
+//	Open: Connects to the window manager
+type Backend struct {
+	Name     string
+	Priority int
+	Probe    func() error
+	Open     func() (WindowManager, error)
+}
+
+// backendRegistry holds the registered backends and the selected one
+type backendRegistry struct {
+	backends []Backend
+	selected string
+	mutex    sync.Mutex
+}
+
+// registry is filled by the init functions of the backends
+var registry = &backendRegistry{selected: BackendAuto}
+
+// RegisterBackend makes a backend available, usually from an init function
+// Args:
+//
+//	backend: Backend to add, replacing one with the same name
+func RegisterBackend(backend Backend) {
+	registry.register(backend)
+}
+
+// BackendNames lists the registered backends in order of automatic selection
+// Returns:
+//
+//	[]string: Backend names
+func BackendNames() []string {
+	return registry.names()
+}
+
+// SelectBackend sets the backend Instance opens
+// Args:
+//
+//	name: Backend name or BackendAuto
+//
+// Returns:
+//
+//	error: Error if no backend has that name
+func SelectBackend(name string) error {
+	return registry.selectBackend(name)
+}
+
+func (r *backendRegistry) register(backend Backend) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, b := range r.backends {
+		if b.Name == backend.Name {
+			r.backends[i] = backend
+			return
+		}
+	}
+	r.backends = append(r.backends, backend)
+	sort.SliceStable(r.backends, func(i, j int) bool {
+		return r.backends[i].Priority > r.backends[j].Priority
+	})
+}
+
+func (r *backendRegistry) names() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.namesLocked()
+}
+
+func (r *backendRegistry) selectBackend(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if name == "" {
+		name = BackendAuto
+	}
+	if name != BackendAuto && r.find(name) == nil {
+		return fmt.Errorf("unknown backend %q, expected %s or one of: %s", name, BackendAuto, strings.Join(r.namesLocked(), ", "))
+	}
+	r.selected = name
+	return nil
+}
+
+// find looks up a backend by name, the mutex must be held
+func (r *backendRegistry) find(name string) *Backend {
+	for i := range r.backends {
+		if r.backends[i].Name == name {
+			return &r.backends[i]
+		}
+	}
+	return nil
+}
+
+// namesLocked is names with the mutex held
+func (r *backendRegistry) namesLocked() []string {
+	names := make([]string, len(r.backends))
+	for i, b := range r.backends {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// selection returns the selected backend name
+func (r *backendRegistry) selection() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.selected
+}
+
+// open connects with a backend. Automatic selection tries all backends
+// whose probe passes, best first. The error names every tried backend and
+// why it could not start.
+func (r *backendRegistry) open(name string) (WindowManager, string, error) {
+	r.mutex.Lock()
+	candidates := append([]Backend(nil), r.backends...)
+	if name != BackendAuto {
+		candidates = nil
+		if b := r.find(name); b != nil {
+			candidates = []Backend{*b}
+		}
+	}
+	r.mutex.Unlock()
+
+	var reasons []string
+	for _, b := range candidates {
+		if err := b.Probe(); err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", b.Name, err))
+			continue
+		}
+		wm, err := b.Open()
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", b.Name, err))
+			continue
+		}
+		log.Info("Using the %s backend", b.Name)
+		return wm, b.Name, nil
+	}
+	if len(reasons) == 0 {
+		return nil, "", fmt.Errorf("no window manager backend registered")
+	}
+	return nil, "", fmt.Errorf("no window manager backend could start (%s)", strings.Join(reasons, "; "))
+}
+
+var (
+	// Singleton instance of the selected backend
+	instance WindowManager
+	// Name of the backend instance was opened with, reused by Reconnect
+	instanceBackend string
+	// Mutex for singleton
+	mutex sync.Mutex
+)
+
+// Instance returns the window manager of the selected backend, opening it
+// on first use. A failed attempt is not remembered, the next call retries.
+// Returns:
+//
+//	WindowManager: The shared window manager
+//	error: Error naming why no backend could start
+func Instance() (WindowManager, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if instance == nil {
+		wm, name, err := registry.open(registry.selection())
+		if err != nil {
+			return nil, err
+		}
+		instance, instanceBackend = wm, name
+	}
+	return instance, nil
+}
+
+// Reconnect replaces the singleton instance with a new connection of the
+// same backend, e.g. after the X server was restarted. The old connection
+// is closed.
+// Returns:
+//
+//	WindowManager: The new instance
+//	error: Error if the window manager cannot be reached
+func Reconnect() (WindowManager, error) {
+	mutex.Lock()
+	name := instanceBackend
+	mutex.Unlock()
+	if name == "" {
+		name = registry.selection()
+	}
+
+	wm, name, err := registry.open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.Lock()
+	old := instance
+	instance, instanceBackend = wm, name
+	mutex.Unlock()
+
+	if cleaner, ok := old.(interface{ Cleanup() }); ok {
+		cleaner.Cleanup()
+	}
+	return wm, nil
+}
@@ -0,0 +1,85 @@
+package desktop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeBackend registers a backend that opens a MockWindowManager, or fails
+// with probeErr or openErr
+func fakeBackend(r *backendRegistry, name string, priority int, probeErr, openErr error) {
+	r.register(Backend{
+		Name:     name,
+		Priority: priority,
+		Probe:    func() error { return probeErr },
+		Open: func() (WindowManager, error) {
+			if openErr != nil {
+				return nil, openErr
+			}
+			return NewMockWindowManager(), nil
+		},
+	})
+}
+
+func TestBackendAutoSelection(t *testing.T) {
+	r := &backendRegistry{selected: BackendAuto}
+	fakeBackend(r, "x11", 10, nil, nil)
+	fakeBackend(r, "hyprland", 30, fmt.Errorf("HYPRLAND_INSTANCE_SIGNATURE is not set"), nil)
+	fakeBackend(r, "sway", 20, nil, fmt.Errorf("connection refused"))
+
+	if names := strings.Join(r.names(), ","); names != "hyprland,sway,x11" {
+		t.Errorf("Expected backends by priority, got %s", names)
+	}
+
+	wm, name, err := r.open(r.selection())
+	if err != nil || wm == nil {
+		t.Fatalf("Expected x11 to open, got %v", err)
+	}
+	if name != "x11" {
+		t.Errorf("Expected the x11 backend, got %s", name)
+	}
+}
+
+func TestBackendExplicitSelection(t *testing.T) {
+	r := &backendRegistry{selected: BackendAuto}
+	fakeBackend(r, "x11", 10, nil, nil)
+	fakeBackend(r, "sway", 20, nil, nil)
+
+	if err := r.selectBackend("x11"); err != nil {
+		t.Fatalf("selectBackend failed: %v", err)
+	}
+	if _, name, err := r.open(r.selection()); err != nil || name != "x11" {
+		t.Errorf("Expected the selected x11 backend, got %s, %v", name, err)
+	}
+
+	err := r.selectBackend("wayfire")
+	if err == nil || !strings.Contains(err.Error(), "sway, x11") {
+		t.Errorf("Expected an error listing the backends, got %v", err)
+	}
+	if r.selection() != "x11" {
+		t.Errorf("Unknown backend changed the selection to %s", r.selection())
+	}
+}
+
+func TestBackendNoneAvailable(t *testing.T) {
+	r := &backendRegistry{selected: BackendAuto}
+	fakeBackend(r, "x11", 10, fmt.Errorf("DISPLAY is not set"), nil)
+	fakeBackend(r, "sway", 20, nil, fmt.Errorf("connection refused"))
+
+	wm, _, err := r.open(BackendAuto)
+	if wm != nil || err == nil {
+		t.Fatal("Expected an error without a working backend")
+	}
+	for _, reason := range []string{"x11: DISPLAY is not set", "sway: connection refused"} {
+		if !strings.Contains(err.Error(), reason) {
+			t.Errorf("Expected %q in %q", reason, err)
+		}
+	}
+
+	// An explicitly selected backend is not replaced by another one
+	fakeBackend(r, "hyprland", 30, nil, nil)
+	if _, _, err := r.open("sway"); err == nil || strings.Contains(err.Error(), "hyprland") {
+		t.Errorf("Expected only the sway error, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package desktop
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gofi/pkg/shared"
+)
+
+// ErrUnsupported is wrapped by errors of operations the window manager does
+// not support, check with errors.Is
+var ErrUnsupported = errors.New("not supported by the window manager")
+
+// ewmhAtoms lists the _NET_SUPPORTED atoms gofi makes use of
+var ewmhAtoms = append([]string{
+	"_NET_CLIENT_LIST",
+	"_NET_CLIENT_LIST_STACKING",
+	"_NET_ACTIVE_WINDOW",
+	"_NET_NUMBER_OF_DESKTOPS",
+	"_NET_DESKTOP_NAMES",
+	"_NET_CURRENT_DESKTOP",
+	"_NET_WM_DESKTOP",
+	"_NET_CLOSE_WINDOW",
+	"_NET_WM_STATE",
+}, stateAtomNames()...)
+
+// stateAtomNames returns the _NET_WM_STATE_* atoms of all window states
+func stateAtomNames() []string {
+	var names []string
+	for name := range shared.AllWindowStates() {
+		names = append(names, stateAtomName(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Capabilities describes the window manager and which of the EWMH features
+// used by gofi it supports. Backends without EWMH report the features they
+// provide in EWMH terms.
+// Fields:
+//
+//	WindowManager: Name of the window manager, empty if none was detected
+//	Supported: Supported atoms out of those gofi uses
+//	Missing: Atoms gofi uses that the window manager does not support
+type Capabilities struct {
+	WindowManager string   `json:"window_manager"`
+	Supported     []string `json:"supported"`
+	Missing       []string `json:"missing"`
+}
+
+// NewCapabilities sorts the atoms gofi uses into supported and missing ones
+// Args:
+//
+//	windowManager: Name of the window manager
+//	supported: Atoms the window manager supports, e.g. from _NET_SUPPORTED
+//
+// Returns:
+//
+//	Capabilities: The capability set
+func NewCapabilities(windowManager string, supported []string) Capabilities {
+	set := make(map[string]bool, len(supported))
+	for _, atom := range supported {
+		set[atom] = true
+	}
+	caps := Capabilities{WindowManager: windowManager, Supported: []string{}, Missing: []string{}}
+	for _, atom := range ewmhAtoms {
+		if set[atom] {
+			caps.Supported = append(caps.Supported, atom)
+		} else {
+			caps.Missing = append(caps.Missing, atom)
+		}
+	}
+	return caps
+}
+
+// FullCapabilities returns a capability set supporting every atom gofi uses
+// Args:
+//
+//	windowManager: Name of the window manager
+//
+// Returns:
+//
+//	Capabilities: The capability set
+func FullCapabilities(windowManager string) Capabilities {
+	return NewCapabilities(windowManager, ewmhAtoms)
+}
+
+// Has checks if all given atoms are supported
+// Args:
+//
+//	atoms: Atom names, e.g. "_NET_ACTIVE_WINDOW"
+//
+// Returns:
+//
+//	bool: True if every atom is supported
+func (c Capabilities) Has(atoms ...string) bool {
+	for _, atom := range atoms {
+		if !containsAtom(c.Supported, atom) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasState checks if _NET_WM_STATE and the atoms of all given flags are supported
+// Args:
+//
+//	state: Flags to check
+//
+// Returns:
+//
+//	bool: True if the flags can be read and changed
+func (c Capabilities) HasState(state shared.WindowState) bool {
+	return c.RequireState(state) == nil
+}
+
+// Require returns an error wrapping ErrUnsupported naming the atoms that are
+// not supported
+// Args:
+//
+//	atoms: Atom names
+//
+// Returns:
+//
+//	error: Error if any atom is not supported
+func (c Capabilities) Require(atoms ...string) error {
+	var missing []string
+	for _, atom := range atoms {
+		if !containsAtom(c.Supported, atom) {
+			missing = append(missing, atom)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s %w", strings.Join(missing, ", "), ErrUnsupported)
+}
+
+// RequireState is Require for _NET_WM_STATE and the atoms of all given flags
+// Args:
+//
+//	state: Flags to check
+//
+// Returns:
+//
+//	error: Error if a flag cannot be changed
+func (c Capabilities) RequireState(state shared.WindowState) error {
+	atoms := []string{"_NET_WM_STATE"}
+	for _, name := range state.Names() {
+		atoms = append(atoms, stateAtomName(name))
+	}
+	return c.Require(atoms...)
+}
+
+// String describes the window manager and its missing atoms for logs
+func (c Capabilities) String() string {
+	name := c.WindowManager
+	if name == "" {
+		name = "no EWMH window manager"
+	}
+	if len(c.Missing) == 0 {
+		return name + ", all features supported"
+	}
+	return fmt.Sprintf("%s, missing %s", name, strings.Join(c.Missing, " "))
+}
+
+// containsAtom checks if a list of atoms contains an atom
+func containsAtom(atoms []string, atom string) bool {
+	for _, a := range atoms {
+		if a == atom {
+			return true
+		}
+	}
+	return false
+}
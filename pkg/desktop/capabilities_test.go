@@ -0,0 +1,47 @@
+package desktop
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gofi/pkg/shared"
+)
+
+func TestCapabilities(t *testing.T) {
+	caps := NewCapabilities("Openbox", []string{
+		"_NET_CLIENT_LIST", "_NET_ACTIVE_WINDOW", "_NET_WM_STATE",
+		"_NET_WM_STATE_MAXIMIZED_VERT", "_NET_WM_STATE_MAXIMIZED_HORZ", "_OB_THEME",
+	})
+
+	if !caps.Has("_NET_CLIENT_LIST", "_NET_ACTIVE_WINDOW") {
+		t.Error("Expected the client list and active window to be supported")
+	}
+	if caps.Has("_OB_THEME") {
+		t.Error("Atoms gofi does not use should not be listed")
+	}
+	if len(caps.Supported)+len(caps.Missing) != len(ewmhAtoms) {
+		t.Errorf("Expected every atom to be supported or missing, got %d and %d", len(caps.Supported), len(caps.Missing))
+	}
+
+	if !caps.HasState(shared.StateMaximized) {
+		t.Error("Expected maximized to be supported")
+	}
+	err := caps.RequireState(shared.StateMaximized | shared.StateAbove)
+	if !errors.Is(err, ErrUnsupported) || !strings.Contains(err.Error(), "_NET_WM_STATE_ABOVE") {
+		t.Errorf("Expected an unsupported error naming above, got %v", err)
+	}
+	if err := caps.Require("_NET_WM_DESKTOP", "_NET_ACTIVE_WINDOW"); err == nil || strings.Contains(err.Error(), "ACTIVE") {
+		t.Errorf("Expected only _NET_WM_DESKTOP to be reported, got %v", err)
+	}
+
+	if s := caps.String(); !strings.HasPrefix(s, "Openbox, missing _NET_CLIENT_LIST_STACKING") {
+		t.Errorf("Unexpected description: %s", s)
+	}
+	if s := NewCapabilities("", nil).String(); !strings.HasPrefix(s, "no EWMH window manager") {
+		t.Errorf("Unexpected description without window manager: %s", s)
+	}
+	if full := FullCapabilities("mock"); len(full.Missing) != 0 || full.String() != "mock, all features supported" {
+		t.Errorf("Unexpected full capabilities: %+v", full)
+	}
+}
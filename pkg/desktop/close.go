@@ -0,0 +1,88 @@
+package desktop
+
+import (
+	"fmt"
+	"time"
+
+	"gofi/pkg/log"
+)
+
+// DefaultCloseTimeout is how long CloseOrKillWindow waits for a window to
+// close. It covers a full round of pings, so a window hanging while it
+// closes is noticed before the wait ends.
+const DefaultCloseTimeout = 15 * time.Second
+
+// closePollInterval is how often the client list is checked while waiting
+const closePollInterval = 50 * time.Millisecond
+
+// CloseOptions decide when CloseOrKillWindow escalates to killing a window
+// Fields:
+//
+//	Timeout: How long to wait for the window to close
+//	Responding: Reports whether the window still answers pings, nil if pings are not watched
+//	KillOnTimeout: Kill a window still open after the timeout, even if it answers pings
+type CloseOptions struct {
+	Timeout       time.Duration
+	Responding    func(windowID int) bool
+	KillOnTimeout bool
+}
+
+// CloseOrKillWindow asks a window to close and kills it only once it stops
+// answering pings. A window that keeps answering, e.g. because it asks the
+// user to save changes, is left open after the timeout unless KillOnTimeout
+// is set.
+// Args:
+//
+//	wm: Window manager to act on
+//	windowID: ID of the window to close
+//	options: When to kill the window instead
+//
+// Returns:
+//
+//	error: Error if the window could neither be closed nor killed
+func CloseOrKillWindow(wm WindowManager, windowID int, options CloseOptions) error {
+	if err := wm.CloseWindow(windowID); err != nil {
+		log.Warn("Close request for window %d failed, killing it: %v", windowID, err)
+		return wm.KillWindow(windowID)
+	}
+
+	deadline := time.Now().Add(options.Timeout)
+	for {
+		if !isListed(wm, windowID) {
+			return nil
+		}
+		if options.Responding != nil && !options.Responding(windowID) {
+			log.Info("Window %d stopped responding while closing, killing it", windowID)
+			return killClosingWindow(wm, windowID)
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(closePollInterval)
+	}
+
+	if !options.KillOnTimeout {
+		log.Info("Window %d is still open after %s but responding, leaving it open", windowID, options.Timeout)
+		return nil
+	}
+	log.Info("Window %d did not close within %s, killing it", windowID, options.Timeout)
+	return killClosingWindow(wm, windowID)
+}
+
+// killClosingWindow kills a window that did not close when asked to
+func killClosingWindow(wm WindowManager, windowID int) error {
+	if err := wm.KillWindow(windowID); err != nil {
+		return fmt.Errorf("window %d ignored close request: %w", windowID, err)
+	}
+	return nil
+}
+
+// isListed checks whether a window is still a client window
+func isListed(wm WindowManager, windowID int) bool {
+	for _, id := range wm.ClientIDs() {
+		if id == windowID {
+			return true
+		}
+	}
+	return false
+}
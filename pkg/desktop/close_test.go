@@ -0,0 +1,53 @@
+package desktop
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCloseOrKillWindow(t *testing.T) {
+	wm := NewMockWindowManager()
+	responding := func(int) bool { return true }
+
+	// A responsive window closes without being killed
+	if err := CloseOrKillWindow(wm, 1, CloseOptions{Timeout: time.Second, Responding: responding}); err != nil {
+		t.Fatalf("Closing window 1: %v", err)
+	}
+	if kills := wm.Kills(); len(kills) != 0 {
+		t.Errorf("Expected no kills, got %v", kills)
+	}
+
+	// A window staying open but answering pings is left open
+	wm.SetHung(2, true)
+	if err := CloseOrKillWindow(wm, 2, CloseOptions{Timeout: 10 * time.Millisecond, Responding: responding}); err != nil {
+		t.Fatalf("Closing window 2: %v", err)
+	}
+	if kills := wm.Kills(); len(kills) != 0 {
+		t.Errorf("Expected the responding window to stay, got kills %v", kills)
+	}
+
+	// A window that stops answering pings is killed before the timeout
+	stopped := func(int) bool { return false }
+	if err := CloseOrKillWindow(wm, 2, CloseOptions{Timeout: time.Minute, Responding: stopped}); err != nil {
+		t.Fatalf("Closing window 2: %v", err)
+	}
+	if kills := wm.Kills(); len(kills) != 1 || kills[0] != 2 {
+		t.Errorf("Expected window 2 to be killed, got %v", kills)
+	}
+	if ids := wm.ClientIDs(); len(ids) != 1 || ids[0] != 3 {
+		t.Errorf("Expected only window 3 left, got %v", ids)
+	}
+
+	// Without pings only KillOnTimeout escalates
+	wm.SetHung(3, true)
+	if err := CloseOrKillWindow(wm, 3, CloseOptions{Timeout: 10 * time.Millisecond, KillOnTimeout: true}); err != nil {
+		t.Fatalf("Closing window 3: %v", err)
+	}
+	if kills := wm.Kills(); len(kills) != 2 || kills[1] != 3 {
+		t.Errorf("Expected window 3 to be killed, got %v", kills)
+	}
+
+	if err := CloseOrKillWindow(wm, 42, CloseOptions{Timeout: 10 * time.Millisecond}); err == nil {
+		t.Error("Expected error for unknown window")
+	}
+}
@@ -0,0 +1,81 @@
+package desktop
+
+import "fmt"
+
+// EventKind is the kind of a window manager event
+type EventKind int
+
+const (
+	// EventNone means no event, AwaitEvent was cancelled or the connection is gone
+	EventNone EventKind = iota
+	// EventCreate is sent when a top-level window is created
+	EventCreate
+	// EventDestroy is sent when a top-level window is destroyed
+	EventDestroy
+	// EventMap is sent when a top-level window is shown
+	EventMap
+	// EventUnmap is sent when a top-level window is hidden
+	EventUnmap
+	// EventConfigure is sent when a top-level window is moved, resized or restacked
+	EventConfigure
+	// EventProperty is sent when a property of the root or a client window changes
+	EventProperty
+	// EventPong is sent when a client answers a ping, see WindowManager.PingWindow
+	EventPong
+	// EventOther is any other event
+	EventOther
+	// EventOverflow is sent after events were dropped or when the window manager
+	// changed too much to follow, all state should be re-read
+	EventOverflow
+	// EventMonitors is sent when monitors were added, removed or rearranged
+	EventMonitors
+)
+
+// eventKindNames maps each kind to its name for logging
+var eventKindNames = map[EventKind]string{
+	EventNone:      "None",
+	EventCreate:    "Create",
+	EventDestroy:   "Destroy",
+	EventMap:       "Map",
+	EventUnmap:     "Unmap",
+	EventConfigure: "Configure",
+	EventProperty:  "Property",
+	EventPong:      "Pong",
+	EventOther:     "Other",
+	EventOverflow:  "Overflow",
+	EventMonitors:  "Monitors",
+}
+
+// String returns the name of the event kind
+// Returns:
+//
+//	string: Kind name, e.g. "Property"
+func (k EventKind) String() string {
+	if name, ok := eventKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a window manager event
+// Fields:
+//
+//	Kind: What happened
+//	WindowID: Window the event is about, the root window for root properties
+//	Atom: Name of the changed property for EventProperty, e.g. "_NET_WM_NAME"
+type Event struct {
+	Kind     EventKind
+	WindowID int
+	Atom     string
+}
+
+// String returns a short description of the event for logging
+// Returns:
+//
+//	string: e.g. "Property:_NET_ACTIVE_WINDOW(0x1e3)"
+func (e Event) String() string {
+	if e.Kind == EventProperty {
+		return fmt.Sprintf("%s:%s(0x%x)", e.Kind, e.Atom, e.WindowID)
+	}
+	return fmt.Sprintf("%s(0x%x)", e.Kind, e.WindowID)
+}
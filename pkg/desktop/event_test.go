@@ -0,0 +1,20 @@
+package desktop
+
+import "testing"
+
+func TestEventString(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Kind: EventProperty, WindowID: 0x1e3, Atom: "_NET_ACTIVE_WINDOW"}, "Property:_NET_ACTIVE_WINDOW(0x1e3)"},
+		{Event{Kind: EventDestroy, WindowID: 0x42}, "Destroy(0x42)"},
+		{Event{}, "None(0x0)"},
+		{Event{Kind: EventKind(99)}, "EventKind(99)(0x0)"},
+	}
+	for _, tt := range tests {
+		if got := tt.event.String(); got != tt.want {
+			t.Errorf("String() got %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package desktop
+
+import (
+	"fmt"
+	"time"
+
+	"gofi/pkg/shared"
+)
+
+// Session traces are JSON lines written by Recorder and played back by
+// Replay. Every line has a type and the time it was written:
+//
+//	start: Capabilities, desktops and monitors of a new connection
+//	event: An event returned by AwaitEvent
+//	windows: StackingList result, written when it changed
+//	active: ActiveWindowID result, written when it changed
+//	desktop: CurrentDesktop result, written when it changed
+//	stacking: StackingOrder result, written when it changed
+//	monitors: Monitors result, written after an EventMonitors
+//
+// State lines following an event describe the desktop after that event.
+const (
+	traceStart    = "start"
+	traceEvent    = "event"
+	traceWindows  = "windows"
+	traceActive   = "active"
+	traceDesktop  = "desktop"
+	traceStacking = "stacking"
+	traceMonitors = "monitors"
+)
+
+// traceEntry is one line of a session trace, only the fields of its type are set
+type traceEntry struct {
+	Time         time.Time        `json:"time"`
+	Type         string           `json:"type"`
+	Event        *traceEventData  `json:"event,omitempty"`
+	Windows      []*shared.Window `json:"windows,omitempty"`
+	Active       int              `json:"active,omitempty"`
+	Desktop      int              `json:"desktop,omitempty"`
+	Stacking     []int            `json:"stacking,omitempty"`
+	Capabilities *Capabilities    `json:"capabilities,omitempty"`
+	DesktopCount int              `json:"desktop_count,omitempty"`
+	DesktopNames []string         `json:"desktop_names,omitempty"`
+	Monitors     []shared.Monitor `json:"monitors,omitempty"`
+}
+
+// traceEventData is an Event with its kind by name
+type traceEventData struct {
+	Kind     string `json:"kind"`
+	WindowID int    `json:"window,omitempty"`
+	Atom     string `json:"atom,omitempty"`
+}
+
+func newTraceEventData(event Event) *traceEventData {
+	return &traceEventData{Kind: event.Kind.String(), WindowID: event.WindowID, Atom: event.Atom}
+}
+
+// event converts the entry back, failing for unknown kinds
+func (e *traceEventData) event() (Event, error) {
+	for kind, name := range eventKindNames {
+		if name == e.Kind && kind != EventNone {
+			return Event{Kind: kind, WindowID: e.WindowID, Atom: e.Atom}, nil
+		}
+	}
+	return Event{}, fmt.Errorf("unknown event kind %q", e.Kind)
+}
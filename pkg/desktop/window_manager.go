@@ -10,12 +10,12 @@ type WindowManager interface {
 	// InitEvents initializes event handling
 	InitEvents() bool
 
-	// AwaitEvent waits for and handles events with optional abort mechanism
+	// AwaitEvent waits for the next event with optional abort mechanism
 	// Args:
 	//     ctx: Context for cancellation
 	// Returns:
-	//     The event or nil if aborted or error occurred
-	AwaitEvent(ctx context.Context) string
+	//     The event, of kind EventNone if aborted or an error occurred
+	AwaitEvent(ctx context.Context) Event
 
 	// ActiveWindowID gets the ID of the currently active window
 	// Returns:
@@ -24,16 +24,136 @@ type WindowManager interface {
 
 	// StackingList gets information about all windows
 	// Returns:
-	//     List of windows
+	//     List of windows in client list (mapping) order
 	StackingList() []*shared.Window
 
-	// CloseWindow requests the closing of a window
+	// ClientIDs gets the IDs of all client windows, cheaper than StackingList
+	// Returns:
+	//     Window IDs in client list (mapping) order, nil on error
+	ClientIDs() []int
+
+	// StackingOrder gets the IDs of all client windows in stacking order
+	// Returns:
+	//     Window IDs from bottom to top, empty if the window manager does not
+	//     advertise a stacking order
+	StackingOrder() []int
+
+	// WindowInfo gets all details of a single window
+	// Args:
+	//     windowID: ID of the window
+	// Returns:
+	//     The window or nil if it does not exist
+	WindowInfo(windowID int) *shared.Window
+
+	// WindowDesktop gets the desktop of a window
+	// Args:
+	//     windowID: ID of the window
+	// Returns:
+	//     The desktop index, -1 for sticky windows or if unknown
+	WindowDesktop(windowID int) int
+
+	// WindowState gets the _NET_WM_STATE flags of a window
+	// Args:
+	//     windowID: ID of the window
+	// Returns:
+	//     The state flags
+	WindowState(windowID int) shared.WindowState
+
+	// WindowGeometry gets the frame-inclusive geometry of a window
+	// Args:
+	//     windowID: ID of the window
+	// Returns:
+	//     The geometry, empty if unknown
+	WindowGeometry(windowID int) shared.Geometry
+
+	// CloseWindow asks a window to close gracefully, it may refuse or hang
 	// Args:
 	//     windowID: ID of the window to close
 	// Returns:
-	//     Error if the window could not be closed
+	//     Error if the request could not be sent
 	CloseWindow(windowID int) error
 
+	// PingWindow sends a _NET_WM_PING to a window supporting it. The answer
+	// is reported by AwaitEvent as an EventPong for the window.
+	// Args:
+	//     windowID: ID of the window to ping
+	// Returns:
+	//     True if the ping was sent, false if the window does not answer pings
+	PingWindow(windowID int) bool
+
+	// KillWindow forcibly closes a window and its client
+	// Args:
+	//     windowID: ID of the window to kill
+	// Returns:
+	//     Error if the window could not be killed
+	KillWindow(windowID int) error
+
+	// ActivateWindow activates a window, switching desktops if necessary
+	// Args:
+	//     windowID: ID of the window to activate
+	// Returns:
+	//     Error if the window could not be activated
+	ActivateWindow(windowID int) error
+
+	// DesktopCount gets the number of desktops
+	// Returns:
+	//     The number of desktops or 0 if unknown
+	DesktopCount() int
+
+	// DesktopNames gets the names of all desktops, indexed by desktop number
+	// Returns:
+	//     The desktop names, possibly fewer than DesktopCount or nil
+	DesktopNames() []string
+
+	// CurrentDesktop gets the index of the current desktop
+	// Returns:
+	//     The desktop index or -1 if unknown
+	CurrentDesktop() int
+
+	// SwitchDesktop switches to another desktop
+	// Args:
+	//     desktop: Index of the desktop to switch to
+	// Returns:
+	//     Error if the desktop could not be switched
+	SwitchDesktop(desktop int) error
+
+	// Monitors lists the active outputs, e.g. RandR outputs like "DP-1"
+	// Returns:
+	//     The monitors or nil if unknown
+	Monitors() []shared.Monitor
+
+	// MoveWindowToDesktop moves a window to another desktop
+	// Args:
+	//     windowID: ID of the window to move
+	//     desktop: Index of the target desktop
+	// Returns:
+	//     Error if the window could not be moved
+	MoveWindowToDesktop(windowID int, desktop int) error
+
+	// SetWindowState adds or removes _NET_WM_STATE flags of a window
+	// Args:
+	//     windowID: ID of the window
+	//     state: Flags to change, hidden minimizes or restores the window
+	//     enabled: True to add the flags, false to remove them
+	// Returns:
+	//     Error if the state could not be changed
+	SetWindowState(windowID int, state shared.WindowState, enabled bool) error
+
+	// ToggleWindowState toggles _NET_WM_STATE flags of a window
+	// Args:
+	//     windowID: ID of the window
+	//     state: Flags to toggle
+	// Returns:
+	//     Error if the state could not be changed
+	ToggleWindowState(windowID int, state shared.WindowState) error
+
+	// MinimizeWindow iconifies a window
+	// Args:
+	//     windowID: ID of the window to minimize
+	// Returns:
+	//     Error if the window could not be minimized
+	MinimizeWindow(windowID int) error
+
 	// WindowTitle gets the title of a window
 	// Args:
 	//     windowID: ID of the window
@@ -41,6 +161,11 @@ type WindowManager interface {
 	//     The title of the window
 	WindowTitle(windowID int) string
 
+	// Capabilities reports the window manager and the EWMH features it supports
+	// Returns:
+	//     The capability set, features missing in it fail with ErrUnsupported
+	Capabilities() Capabilities
+
 	// WindowClass gets the class and instance of a window
 	// Args:
 	//     windowID: ID of the window
@@ -0,0 +1,382 @@
+package desktop
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// HyprlandWindowManager implements WindowManager with the command and event
+// sockets of Hyprland. Windows are identified by their address and
+// workspaces serve as desktops.
+type HyprlandWindowManager struct {
+	commandSocket string
+	eventSocket   string
+	eventConn     net.Conn // nil before InitEvents
+	events        *ipcEventQueue
+	cache         ipcCache
+	mutex         sync.Mutex // Guards eventConn
+}
+
+func init() {
+	RegisterBackend(Backend{
+		Name:     "hyprland",
+		Priority: 30,
+		Probe: func() error {
+			if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") == "" {
+				return fmt.Errorf("HYPRLAND_INSTANCE_SIGNATURE is not set")
+			}
+			return nil
+		},
+		Open: func() (WindowManager, error) {
+			wm, err := NewHyprlandWindowManager(HyprlandSocketDir())
+			if err != nil {
+				return nil, err
+			}
+			return wm, nil
+		},
+	})
+}
+
+// NewHyprlandWindowManager checks that Hyprland answers on its command socket
+// Args:
+//
+//	socketDir: Socket directory of the instance, usually HyprlandSocketDir()
+//
+// Returns:
+//
+//	*HyprlandWindowManager: New window manager
+//	error: Error if Hyprland cannot be reached
+func NewHyprlandWindowManager(socketDir string) (*HyprlandWindowManager, error) {
+	if socketDir == "" {
+		return nil, fmt.Errorf("no Hyprland instance, HYPRLAND_INSTANCE_SIGNATURE is not set")
+	}
+	wm := &HyprlandWindowManager{
+		commandSocket: filepath.Join(socketDir, hyprCommandSocket),
+		eventSocket:   filepath.Join(socketDir, hyprEventSocket),
+		events:        newIPCEventQueue(),
+	}
+	wm.cache.fetch = wm.fetchState
+	if _, err := hyprRequest(wm.commandSocket, "j/version"); err != nil {
+		return nil, err
+	}
+	return wm, nil
+}
+
+// query sends a j/ request and decodes the JSON reply into result
+func (wm *HyprlandWindowManager) query(request string, result interface{}) error {
+	reply, err := hyprRequest(wm.commandSocket, request)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(reply, result); err != nil {
+		return fmt.Errorf("malformed reply to %s: %w", request, err)
+	}
+	return nil
+}
+
+// fetchState gets clients, active window, workspaces and monitors
+func (wm *HyprlandWindowManager) fetchState() (*ipcState, error) {
+	var clients []hyprClient
+	var active hyprClient
+	var workspaces []hyprWorkspace
+	var monitors []hyprMonitor
+	if err := wm.query("j/clients", &clients); err != nil {
+		return nil, err
+	}
+	if err := wm.query("j/activewindow", &active); err != nil {
+		return nil, err
+	}
+	if err := wm.query("j/workspaces", &workspaces); err != nil {
+		return nil, err
+	}
+	if err := wm.query("j/monitors", &monitors); err != nil {
+		return nil, err
+	}
+	return parseHyprState(clients, active, workspaces, monitors), nil
+}
+
+// dispatch runs dispatchers, e.g. "focuswindow address:0x55d3c6b2a1b0".
+// Several dispatchers are sent as one batch.
+func (wm *HyprlandWindowManager) dispatch(dispatchers ...string) error {
+	request := "dispatch " + dispatchers[0]
+	if len(dispatchers) > 1 {
+		request = "[[BATCH]]dispatch " + strings.Join(dispatchers, "; dispatch ")
+	}
+	reply, err := hyprRequest(wm.commandSocket, request)
+	if err != nil {
+		return err
+	}
+	wm.cache.invalidate()
+	if err := hyprDispatchReply(reply); err != nil {
+		return fmt.Errorf("%q failed: %w", request, err)
+	}
+	return nil
+}
+
+// InitEvents connects to the event socket
+func (wm *HyprlandWindowManager) InitEvents() bool {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	if wm.eventConn != nil {
+		return true
+	}
+
+	conn, err := net.Dial("unix", wm.eventSocket)
+	if err != nil {
+		log.Error("Failed to connect to %s: %v", wm.eventSocket, err)
+		return false
+	}
+	wm.eventConn = conn
+	go wm.readEvents(conn)
+	return true
+}
+
+// readEvents converts event lines until the connection is closed
+func (wm *HyprlandWindowManager) readEvents(conn net.Conn) {
+	defer wm.events.close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		wm.cache.invalidate()
+		for _, event := range convertHyprEvent(scanner.Text()) {
+			wm.events.push(event)
+		}
+	}
+	log.Debug("Hyprland event connection closed: %v", scanner.Err())
+}
+
+// AwaitEvent waits for the next event. EventNone is returned when the
+// context is cancelled or Hyprland went away.
+func (wm *HyprlandWindowManager) AwaitEvent(ctx context.Context) Event {
+	return wm.events.await(ctx)
+}
+
+// ActiveWindowID returns the address of the focused window
+func (wm *HyprlandWindowManager) ActiveWindowID() int {
+	return wm.cache.current().activeID
+}
+
+// StackingList returns all mapped windows
+func (wm *HyprlandWindowManager) StackingList() []*shared.Window {
+	return wm.cache.current().list()
+}
+
+// ClientIDs returns the addresses of all mapped windows
+func (wm *HyprlandWindowManager) ClientIDs() []int {
+	return wm.cache.current().ids()
+}
+
+// StackingOrder is empty, Hyprland does not report one
+func (wm *HyprlandWindowManager) StackingOrder() []int {
+	return nil
+}
+
+// WindowInfo returns a window
+func (wm *HyprlandWindowManager) WindowInfo(windowID int) *shared.Window {
+	return wm.cache.current().window(windowID)
+}
+
+// WindowDesktop returns the desktop of a window, -1 if unknown or on a special workspace
+func (wm *HyprlandWindowManager) WindowDesktop(windowID int) int {
+	if w := wm.WindowInfo(windowID); w != nil {
+		return w.Desktop
+	}
+	return -1
+}
+
+// WindowState returns the state flags of a window
+func (wm *HyprlandWindowManager) WindowState(windowID int) shared.WindowState {
+	if w := wm.WindowInfo(windowID); w != nil {
+		return w.State
+	}
+	return 0
+}
+
+// WindowGeometry returns the geometry of a window
+func (wm *HyprlandWindowManager) WindowGeometry(windowID int) shared.Geometry {
+	if w := wm.WindowInfo(windowID); w != nil {
+		return w.Geometry
+	}
+	return shared.Geometry{}
+}
+
+// WindowTitle returns the title of a window
+func (wm *HyprlandWindowManager) WindowTitle(windowID int) string {
+	if w := wm.WindowInfo(windowID); w != nil {
+		return w.Title
+	}
+	return ""
+}
+
+// WindowClass returns the initial class as instance and the class of a window
+func (wm *HyprlandWindowManager) WindowClass(windowID int) (string, string) {
+	if w := wm.WindowInfo(windowID); w != nil {
+		return w.Instance, w.ClassName
+	}
+	return "", ""
+}
+
+// CloseWindow asks a window to close
+func (wm *HyprlandWindowManager) CloseWindow(windowID int) error {
+	return wm.dispatch("closewindow " + hyprSelector(windowID))
+}
+
+// KillWindow kills a window with killwindow. Only if the dispatcher fails or
+// the window is still there after processKillWait is its process killed,
+// which takes all other windows of the process along.
+func (wm *HyprlandWindowManager) KillWindow(windowID int) error {
+	w := wm.WindowInfo(windowID)
+	if w == nil {
+		return fmt.Errorf("unknown window %d", windowID)
+	}
+	err := wm.dispatch("killwindow " + hyprSelector(windowID))
+	if err == nil && wm.cache.awaitGone(windowID, processKillWait) {
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("window %d is still open after %s", windowID, processKillWait)
+	}
+	if w.PID <= 0 {
+		return err
+	}
+	log.Warn("Killing process %d of window %d: %v", w.PID, windowID, err)
+	return shared.KillProcess(w.PID, processKillWait)
+}
+
+// PingWindow is not supported, Hyprland pings its clients itself
+func (wm *HyprlandWindowManager) PingWindow(windowID int) bool {
+	return false
+}
+
+// ActivateWindow focuses a window, switching to its workspace
+func (wm *HyprlandWindowManager) ActivateWindow(windowID int) error {
+	return wm.dispatch("focuswindow " + hyprSelector(windowID))
+}
+
+// DesktopCount returns the number of workspaces
+func (wm *HyprlandWindowManager) DesktopCount() int {
+	return len(wm.cache.current().workspaces)
+}
+
+// DesktopNames returns the workspace names
+func (wm *HyprlandWindowManager) DesktopNames() []string {
+	return append([]string(nil), wm.cache.current().workspaces...)
+}
+
+// CurrentDesktop returns the desktop of the focused monitor
+func (wm *HyprlandWindowManager) CurrentDesktop() int {
+	return wm.cache.current().current
+}
+
+// workspaceName looks up the workspace of a desktop
+func (wm *HyprlandWindowManager) workspaceName(desktop int) (string, error) {
+	workspaces := wm.cache.current().workspaces
+	if desktop < 0 || desktop >= len(workspaces) {
+		return "", fmt.Errorf("desktop %d out of range (0-%d)", desktop, len(workspaces)-1)
+	}
+	return "name:" + workspaces[desktop], nil
+}
+
+// SwitchDesktop switches to a workspace
+func (wm *HyprlandWindowManager) SwitchDesktop(desktop int) error {
+	name, err := wm.workspaceName(desktop)
+	if err != nil {
+		return err
+	}
+	return wm.dispatch("workspace " + name)
+}
+
+// Monitors returns the monitors
+func (wm *HyprlandWindowManager) Monitors() []shared.Monitor {
+	return append([]shared.Monitor(nil), wm.cache.current().monitors...)
+}
+
+// MoveWindowToDesktop moves a window to a workspace without following it
+func (wm *HyprlandWindowManager) MoveWindowToDesktop(windowID int, desktop int) error {
+	name, err := wm.workspaceName(desktop)
+	if err != nil {
+		return err
+	}
+	return wm.dispatch(fmt.Sprintf("movetoworkspacesilent %s,%s", name, hyprSelector(windowID)))
+}
+
+// SetWindowState changes sticky (pinned), fullscreen and hidden, which moves
+// the window to a special workspace or back to the current one.
+// Other flags are not supported.
+func (wm *HyprlandWindowManager) SetWindowState(windowID int, state shared.WindowState, enabled bool) error {
+	w := wm.WindowInfo(windowID)
+	if w == nil {
+		return fmt.Errorf("unknown window %d", windowID)
+	}
+	if unsupported := state &^ (shared.StateSticky | shared.StateFullscreen | shared.StateHidden); unsupported != 0 {
+		return fmt.Errorf("window state %v %w", unsupported.Names(), ErrUnsupported)
+	}
+
+	// pin and fullscreen toggle, only send them if the state differs
+	selector := hyprSelector(windowID)
+	var dispatchers []string
+	if state&shared.StateSticky != 0 && w.State.Has(shared.StateSticky) != enabled {
+		dispatchers = append(dispatchers, "pin "+selector)
+	}
+	if state&shared.StateFullscreen != 0 && w.State.Has(shared.StateFullscreen) != enabled {
+		// fullscreen only acts on the focused window, the focus goes back
+		// to the previously focused window in the same batch
+		dispatchers = append(dispatchers, "focuswindow "+selector, "fullscreen 0")
+		if active := wm.ActiveWindowID(); active != 0 && active != windowID {
+			dispatchers = append(dispatchers, "focuswindow "+hyprSelector(active))
+		}
+	}
+	if state&shared.StateHidden != 0 && w.State.Has(shared.StateHidden) != enabled {
+		target := hyprMinimized
+		if !enabled {
+			current, err := wm.workspaceName(wm.CurrentDesktop())
+			if err != nil {
+				return err
+			}
+			target = current
+		}
+		dispatchers = append(dispatchers, fmt.Sprintf("movetoworkspacesilent %s,%s", target, selector))
+	}
+	if len(dispatchers) == 0 {
+		return nil
+	}
+	return wm.dispatch(dispatchers...)
+}
+
+// ToggleWindowState toggles sticky, fullscreen or hidden
+func (wm *HyprlandWindowManager) ToggleWindowState(windowID int, state shared.WindowState) error {
+	w := wm.WindowInfo(windowID)
+	if w == nil {
+		return fmt.Errorf("unknown window %d", windowID)
+	}
+	return wm.SetWindowState(windowID, state, !w.State.Has(state))
+}
+
+// MinimizeWindow moves a window to the special workspace "minimized"
+func (wm *HyprlandWindowManager) MinimizeWindow(windowID int) error {
+	return wm.SetWindowState(windowID, shared.StateHidden, true)
+}
+
+// Capabilities reports Hyprland
+func (wm *HyprlandWindowManager) Capabilities() Capabilities {
+	return NewCapabilities("Hyprland", ipcCapabilities)
+}
+
+// Cleanup closes the event connection
+func (wm *HyprlandWindowManager) Cleanup() {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	if wm.eventConn != nil {
+		wm.eventConn.Close()
+	}
+}
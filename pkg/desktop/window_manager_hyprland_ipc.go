@@ -0,0 +1,294 @@
+package desktop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gofi/pkg/shared"
+)
+
+// Socket names below the directory of a Hyprland instance
+const (
+	hyprCommandSocket = ".socket.sock"
+	hyprEventSocket   = ".socket2.sock"
+)
+
+// hyprRequestTimeout bounds one request on the command socket
+const hyprRequestTimeout = 2 * time.Second
+
+// hyprSpecialPrefix starts the names of special (scratchpad) workspaces
+const hyprSpecialPrefix = "special:"
+
+// hyprMinimized is the special workspace MinimizeWindow moves windows to
+const hyprMinimized = "special:minimized"
+
+// HyprlandSocketDir returns the socket directory of the running Hyprland
+// instance. Hyprland 0.40 moved it from /tmp/hypr to $XDG_RUNTIME_DIR/hypr.
+// Returns:
+//
+//	string: Directory, empty if $HYPRLAND_INSTANCE_SIGNATURE is not set
+func HyprlandSocketDir() string {
+	signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if signature == "" {
+		return ""
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		dir := filepath.Join(runtimeDir, "hypr", signature)
+		if _, err := os.Stat(filepath.Join(dir, hyprCommandSocket)); err == nil {
+			return dir
+		}
+	}
+	return filepath.Join("/tmp/hypr", signature)
+}
+
+// hyprRequest sends one request to the command socket and returns the
+// whole reply. Hyprland closes the connection after each reply.
+func hyprRequest(socketPath string, request string) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", socketPath, hyprRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", socketPath, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(hyprRequestTimeout))
+
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return nil, fmt.Errorf("failed to send %q: %w", request, err)
+	}
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reply to %q: %w", request, err)
+	}
+	return reply, nil
+}
+
+// hyprAddress is a window address like "0x55d3c6b2a1b0", used as window ID
+type hyprAddress int
+
+// UnmarshalJSON parses the hex string
+func (a *hyprAddress) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	id, err := parseHyprAddress(s)
+	if err != nil {
+		return err
+	}
+	*a = hyprAddress(id)
+	return nil
+}
+
+// parseHyprAddress parses an address with or without "0x", events omit it
+func parseHyprAddress(s string) (int, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 63)
+	if err != nil {
+		return 0, fmt.Errorf("invalid window address %q", s)
+	}
+	return int(id), nil
+}
+
+// hyprSelector formats a window ID for dispatchers, e.g. "address:0x55d3c6b2a1b0"
+func hyprSelector(windowID int) string {
+	return fmt.Sprintf("address:0x%x", windowID)
+}
+
+// hyprFlag is a boolean Hyprland encodes as bool or number depending on
+// the version, e.g. "fullscreen"
+type hyprFlag bool
+
+// UnmarshalJSON accepts true, false and numbers
+func (f *hyprFlag) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true":
+		*f = true
+	case "false", "null", "0":
+		*f = false
+	default:
+		var n float64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid flag %s", data)
+		}
+		*f = n != 0
+	}
+	return nil
+}
+
+// hyprWorkspaceRef is the workspace of a client or monitor
+type hyprWorkspaceRef struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// hyprClient is an entry of j/clients and the reply of j/activewindow
+type hyprClient struct {
+	Address    hyprAddress      `json:"address"`
+	Mapped     bool             `json:"mapped"`
+	At         [2]int           `json:"at"`
+	Size       [2]int           `json:"size"`
+	Workspace  hyprWorkspaceRef `json:"workspace"`
+	Monitor    int              `json:"monitor"`
+	Class      string           `json:"class"`
+	Title      string           `json:"title"`
+	InitClass  string           `json:"initialClass"`
+	PID        int              `json:"pid"`
+	Pinned     bool             `json:"pinned"`
+	Fullscreen hyprFlag         `json:"fullscreen"`
+}
+
+// hyprWorkspace is an entry of j/workspaces
+type hyprWorkspace struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// hyprMonitor is an entry of j/monitors
+type hyprMonitor struct {
+	ID              int              `json:"id"`
+	Name            string           `json:"name"`
+	X               int              `json:"x"`
+	Y               int              `json:"y"`
+	Width           int              `json:"width"`
+	Height          int              `json:"height"`
+	Focused         bool             `json:"focused"`
+	ActiveWorkspace hyprWorkspaceRef `json:"activeWorkspace"`
+}
+
+// isSpecial checks if a workspace is a special (scratchpad) workspace
+func (w hyprWorkspaceRef) isSpecial() bool {
+	return strings.HasPrefix(w.Name, hyprSpecialPrefix)
+}
+
+// parseHyprState converts the replies of j/clients, j/activewindow,
+// j/workspaces and j/monitors into windows and desktops.
+// Workspaces become desktops ordered by ID, named workspaces (negative IDs)
+// last. Windows on special workspaces are hidden and on no desktop.
+func parseHyprState(clients []hyprClient, active hyprClient, workspaces []hyprWorkspace, monitors []hyprMonitor) *ipcState {
+	state := newIPCState()
+
+	sort.SliceStable(workspaces, func(i, j int) bool {
+		wi, wj := workspaces[i].ID, workspaces[j].ID
+		if (wi < 0) != (wj < 0) {
+			return wi >= 0
+		}
+		if wi < 0 {
+			return wi > wj // Named workspaces count down from -1337
+		}
+		return wi < wj
+	})
+	desktops := make(map[int]int, len(workspaces))
+	for _, ws := range workspaces {
+		if strings.HasPrefix(ws.Name, hyprSpecialPrefix) {
+			continue
+		}
+		desktops[ws.ID] = len(state.workspaces)
+		state.workspaces = append(state.workspaces, ws.Name)
+	}
+
+	outputs := make(map[int]string, len(monitors))
+	for _, m := range monitors {
+		outputs[m.ID] = m.Name
+		state.monitors = append(state.monitors, shared.Monitor{
+			Name:     m.Name,
+			Geometry: shared.Geometry{X: m.X, Y: m.Y, Width: m.Width, Height: m.Height},
+		})
+		if desktop, ok := desktops[m.ActiveWorkspace.ID]; ok && (m.Focused || state.current < 0) {
+			state.current = desktop
+		}
+	}
+
+	for _, c := range clients {
+		if !c.Mapped {
+			continue
+		}
+		w := &shared.Window{
+			ID:        int(c.Address),
+			Title:     c.Title,
+			ClassName: c.Class,
+			Instance:  c.InitClass,
+			Type:      "Normal",
+			Desktop:   -1,
+			PID:       c.PID,
+			Geometry:  shared.Geometry{X: c.At[0], Y: c.At[1], Width: c.Size[0], Height: c.Size[1]},
+			Monitor:   outputs[c.Monitor],
+		}
+		if desktop, ok := desktops[c.Workspace.ID]; ok && !c.Workspace.isSpecial() {
+			w.Desktop = desktop
+		} else {
+			w.State |= shared.StateHidden
+		}
+		if c.Pinned {
+			w.State |= shared.StateSticky
+		}
+		if c.Fullscreen {
+			w.State |= shared.StateFullscreen
+		}
+		state.add(w)
+	}
+	if state.byID[int(active.Address)] != nil {
+		state.activeID = int(active.Address)
+	}
+	return state
+}
+
+// convertHyprEvent maps a line of the event socket, "EVENT>>DATA", onto
+// the EWMH property events the daemon understands
+func convertHyprEvent(line string) []Event {
+	name, data, ok := strings.Cut(line, ">>")
+	if !ok {
+		return nil
+	}
+	address := func() int {
+		field, _, _ := strings.Cut(data, ",")
+		id, err := parseHyprAddress(field)
+		if err != nil {
+			return 0
+		}
+		return id
+	}
+
+	switch name {
+	case "openwindow", "closewindow":
+		return []Event{{Kind: EventProperty, Atom: "_NET_CLIENT_LIST"}}
+	case "activewindow":
+		return []Event{{Kind: EventProperty, Atom: "_NET_ACTIVE_WINDOW"}}
+	case "workspace":
+		return []Event{{Kind: EventProperty, Atom: "_NET_CURRENT_DESKTOP"}}
+	case "windowtitle":
+		return []Event{{Kind: EventProperty, WindowID: address(), Atom: "_NET_WM_NAME"}}
+	case "pin":
+		return []Event{{Kind: EventProperty, WindowID: address(), Atom: "_NET_WM_STATE"}}
+	case "changefloatingmode":
+		return []Event{{Kind: EventConfigure, WindowID: address()}}
+	case "movewindow":
+		// To another workspace, a special workspace or monitor
+		id := address()
+		return []Event{
+			{Kind: EventProperty, WindowID: id, Atom: "_NET_WM_DESKTOP"},
+			{Kind: EventProperty, WindowID: id, Atom: "_NET_WM_STATE"},
+			{Kind: EventConfigure, WindowID: id},
+		}
+	case "createworkspace", "destroyworkspace", "renameworkspace", "moveworkspace", "fullscreen":
+		// Desktops are renumbered, or the event does not name the window
+		return []Event{{Kind: EventOverflow}}
+	}
+	return nil
+}
+
+// hyprDispatchReply checks the reply of a dispatcher, "ok" on success
+func hyprDispatchReply(reply []byte) error {
+	for _, line := range bytes.Split(bytes.TrimSpace(reply), []byte("\n\n")) {
+		if text := string(bytes.TrimSpace(line)); text != "ok" {
+			return fmt.Errorf("%s", text)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package desktop
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gofi/pkg/shared"
+)
+
+// fakeHyprland stands in for the sockets of a Hyprland instance. The command
+// socket answers j/ requests with recorded replies from testdata and
+// acknowledges dispatchers, the event socket replays event lines.
+type fakeHyprland struct {
+	dir         string
+	replies     map[string][]byte
+	requests    []string
+	subscribers []net.Conn
+	mutex       sync.Mutex
+}
+
+// newFakeHyprland serves the recorded replies until the test ends
+func newFakeHyprland(t *testing.T) *fakeHyprland {
+	server := &fakeHyprland{
+		dir:     t.TempDir(),
+		replies: map[string][]byte{"j/version": []byte(`{"tag":"v0.41.2"}`)},
+	}
+	for _, name := range []string{"clients", "activewindow", "workspaces", "monitors"} {
+		reply, err := os.ReadFile(filepath.Join("testdata", "hyprland_"+name+".json"))
+		if err != nil {
+			t.Fatalf("Failed to read recorded reply: %v", err)
+		}
+		server.replies["j/"+name] = reply
+	}
+
+	commands := server.listen(t, hyprCommandSocket)
+	events := server.listen(t, hyprEventSocket)
+	go func() {
+		for {
+			conn, err := commands.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := events.Accept()
+			if err != nil {
+				return
+			}
+			server.mutex.Lock()
+			server.subscribers = append(server.subscribers, conn)
+			server.mutex.Unlock()
+		}
+	}()
+	return server
+}
+
+// listen opens one of the sockets
+func (s *fakeHyprland) listen(t *testing.T, name string) net.Listener {
+	listener, err := net.Listen("unix", filepath.Join(s.dir, name))
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", name, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+// serve answers one request and closes the connection like Hyprland
+func (s *fakeHyprland) serve(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil && err != io.EOF {
+		return
+	}
+	request := string(buf[:n])
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	reply, ok := s.replies[request]
+	if !ok {
+		s.requests = append(s.requests, request)
+		reply = []byte("ok")
+		if strings.HasPrefix(request, "[[BATCH]]") {
+			reply = []byte(strings.Repeat("ok\n\n", strings.Count(request, ";")+1))
+		}
+	}
+	conn.Write(reply)
+}
+
+// setReply replaces the reply to a j/ request
+func (s *fakeHyprland) setReply(request string, reply []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.replies[request] = reply
+}
+
+// emit sends an event line to all event connections
+func (s *fakeHyprland) emit(line string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.subscribers {
+		conn.Write([]byte(line + "\n"))
+	}
+}
+
+// closeEvents closes all event connections, like a quitting Hyprland
+func (s *fakeHyprland) closeEvents() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.subscribers {
+		conn.Close()
+	}
+}
+
+// takeRequests returns and forgets the received dispatch requests
+func (s *fakeHyprland) takeRequests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+func setupHyprlandTest(t *testing.T) (*HyprlandWindowManager, *fakeHyprland) {
+	server := newFakeHyprland(t)
+	wm, err := NewHyprlandWindowManager(server.dir)
+	if err != nil {
+		t.Fatalf("Failed to connect to fake Hyprland: %v", err)
+	}
+	t.Cleanup(wm.Cleanup)
+	return wm, server
+}
+
+func TestHyprlandWindowList(t *testing.T) {
+	wm, _ := setupHyprlandTest(t)
+
+	windows := wm.StackingList()
+	want := []struct {
+		id        int
+		class     string
+		instance  string
+		desktop   int
+		monitor   string
+		pid       int
+		wantState []string
+	}{
+		{0x55d3c6b2a1b0, "foot", "foot", 0, "eDP-1", 2001, nil},
+		{0x55d3c6c8e4f0, "firefox", "firefox", 0, "eDP-1", 2002, []string{"fullscreen"}},
+		{0x55d3c6d01230, "thunderbird", "thunderbird", 2, "HDMI-A-1", 2003, []string{"sticky"}},
+		{0x55d3c6d05670, "code", "code-url-handler", 1, "HDMI-A-1", 2004, nil},
+		{0x55d3c6d09ab0, "org.keepassxc.KeePassXC", "org.keepassxc.KeePassXC", -1, "eDP-1", 2005, []string{"hidden"}},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("Expected %d windows, got %d: %v", len(want), len(windows), windows)
+	}
+	for i, w := range want {
+		got := windows[i]
+		if got.ID != w.id || got.ClassName != w.class || got.Instance != w.instance ||
+			got.Desktop != w.desktop || got.Monitor != w.monitor || got.PID != w.pid {
+			t.Errorf("Window %d: got %+v", i, got)
+		}
+		if names := got.State.Names(); strings.Join(names, ",") != strings.Join(w.wantState, ",") {
+			t.Errorf("Window %s: got state %v, want %v", got.HexID(), names, w.wantState)
+		}
+	}
+	if g := windows[0].Geometry; g != (shared.Geometry{X: 10, Y: 50, Width: 940, Height: 1020}) {
+		t.Errorf("Unexpected geometry: %+v", g)
+	}
+
+	if id := wm.ActiveWindowID(); id != 0x55d3c6b2a1b0 {
+		t.Errorf("Active window: got 0x%x, want 0x55d3c6b2a1b0", id)
+	}
+	if names := wm.DesktopNames(); strings.Join(names, ",") != "1,4,mail" {
+		t.Errorf("Desktop names: got %q", names)
+	}
+	if current := wm.CurrentDesktop(); current != 0 {
+		t.Errorf("Current desktop: got %d, want 0", current)
+	}
+	if monitors := wm.Monitors(); len(monitors) != 2 || monitors[1].Geometry.X != 1920 {
+		t.Errorf("Unexpected monitors: %+v", monitors)
+	}
+}
+
+func TestHyprlandCommands(t *testing.T) {
+	wm, server := setupHyprlandTest(t)
+
+	if err := wm.ActivateWindow(0x55d3c6d05670); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	if err := wm.CloseWindow(0x55d3c6d05670); err != nil {
+		t.Fatalf("CloseWindow failed: %v", err)
+	}
+	if err := wm.MoveWindowToDesktop(0x55d3c6b2a1b0, 2); err != nil {
+		t.Fatalf("MoveWindowToDesktop failed: %v", err)
+	}
+	if err := wm.ToggleWindowState(0x55d3c6c8e4f0, shared.StateFullscreen); err != nil {
+		t.Fatalf("ToggleWindowState failed: %v", err)
+	}
+	if err := wm.SetWindowState(0x55d3c6d01230, shared.StateSticky, true); err != nil {
+		t.Fatalf("SetWindowState failed: %v", err)
+	}
+	if err := wm.SetWindowState(0x55d3c6d09ab0, shared.StateHidden, false); err != nil {
+		t.Fatalf("SetWindowState failed: %v", err)
+	}
+	if err := wm.SwitchDesktop(1); err != nil {
+		t.Fatalf("SwitchDesktop failed: %v", err)
+	}
+
+	want := []string{
+		"dispatch focuswindow address:0x55d3c6d05670",
+		"dispatch closewindow address:0x55d3c6d05670",
+		"dispatch movetoworkspacesilent name:mail,address:0x55d3c6b2a1b0",
+		"[[BATCH]]dispatch focuswindow address:0x55d3c6c8e4f0; dispatch fullscreen 0; dispatch focuswindow address:0x55d3c6b2a1b0",
+		"dispatch movetoworkspacesilent name:1,address:0x55d3c6d09ab0",
+		"dispatch workspace name:4",
+	}
+	requests := server.takeRequests()
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected requests:\n GOT: %q\nWANT: %q", requests, want)
+	}
+
+	if err := wm.SetWindowState(0x55d3c6b2a1b0, shared.StateShaded, true); err == nil {
+		t.Error("Expected error for unsupported state")
+	}
+	server.setReply("dispatch focuswindow address:0x1", []byte("window not found"))
+	if err := wm.ActivateWindow(1); err == nil || !strings.Contains(err.Error(), "window not found") {
+		t.Errorf("Expected the Hyprland error, got %v", err)
+	}
+}
+
+func TestHyprlandKillWindow(t *testing.T) {
+	wm, server := setupHyprlandTest(t)
+
+	// killwindow closes only the window, the next client list drops it
+	if w := wm.WindowInfo(0x55d3c6d05670); w == nil || w.PID != 2004 {
+		t.Fatalf("Unexpected window: %+v", w)
+	}
+	clients := string(server.replies["j/clients"])
+	server.setReply("j/clients", []byte(strings.Replace(clients, "0x55d3c6d05670", "0x55d3c6d0dead", 1)))
+	if err := wm.KillWindow(0x55d3c6d05670); err != nil {
+		t.Fatalf("KillWindow failed: %v", err)
+	}
+	if requests := server.takeRequests(); len(requests) != 1 || requests[0] != "dispatch killwindow address:0x55d3c6d05670" {
+		t.Errorf("Unexpected requests: %q", requests)
+	}
+
+	// A window surviving killwindow takes its process down
+	process := exec.Command("sleep", "60")
+	if err := process.Start(); err != nil {
+		t.Skipf("Cannot start a process to kill: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		process.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() { process.Process.Kill() })
+
+	server.setReply("j/clients", []byte(strings.Replace(clients, `"pid": 2001,`, fmt.Sprintf(`"pid": %d,`, process.Process.Pid), 1)))
+	wm.cache.invalidate()
+	if err := wm.KillWindow(0x55d3c6b2a1b0); err != nil {
+		t.Fatalf("KillWindow failed: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Error("The process of the window was not killed")
+	}
+	if requests := server.takeRequests(); len(requests) != 1 || requests[0] != "dispatch killwindow address:0x55d3c6b2a1b0" {
+		t.Errorf("Unexpected requests: %q", requests)
+	}
+}
+
+func TestHyprlandEvents(t *testing.T) {
+	wm, server := setupHyprlandTest(t)
+	if !wm.InitEvents() {
+		t.Fatal("Failed to initialize events")
+	}
+	if title := wm.WindowTitle(0x55d3c6b2a1b0); title != "~" {
+		t.Fatalf("Title: got %q", title)
+	}
+
+	// Wait for the event connection to be accepted
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		server.mutex.Lock()
+		connected := len(server.subscribers) > 0
+		server.mutex.Unlock()
+		if connected {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	server.mutex.Lock()
+	clients := strings.Replace(string(server.replies["j/clients"]), `"title": "~"`, `"title": "vim"`, 1)
+	server.mutex.Unlock()
+	server.setReply("j/clients", []byte(clients))
+	server.emit("windowtitle>>55d3c6b2a1b0")
+	server.emit("windowtitlev2>>55d3c6b2a1b0,vim")
+	server.emit("openwindow>>55d3c6d0d000,1,foot,foot")
+	server.emit("activewindow>>foot,vim")
+	server.emit("workspace>>2")
+	server.emit("createworkspace>>5")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	want := []Event{
+		{Kind: EventProperty, WindowID: 0x55d3c6b2a1b0, Atom: "_NET_WM_NAME"},
+		{Kind: EventProperty, Atom: "_NET_CLIENT_LIST"},
+		{Kind: EventProperty, Atom: "_NET_ACTIVE_WINDOW"},
+		{Kind: EventProperty, Atom: "_NET_CURRENT_DESKTOP"},
+		{Kind: EventOverflow},
+	}
+	for _, w := range want {
+		if event := wm.AwaitEvent(ctx); event != w {
+			t.Fatalf("Expected %s, got %s", w, event)
+		}
+	}
+	if title := wm.WindowTitle(0x55d3c6b2a1b0); title != "vim" {
+		t.Errorf("Expected the clients to be fetched again, got title %q", title)
+	}
+
+	server.closeEvents()
+	if event := wm.AwaitEvent(ctx); event.Kind != EventNone || ctx.Err() != nil {
+		t.Errorf("Expected no event after Hyprland quit, got %s", event)
+	}
+}
+
+func TestParseHyprAddress(t *testing.T) {
+	for _, s := range []string{"0x55d3c6b2a1b0", "55d3c6b2a1b0"} {
+		if id, err := parseHyprAddress(s); err != nil || id != 0x55d3c6b2a1b0 {
+			t.Errorf("parseHyprAddress(%q): got 0x%x, %v", s, id, err)
+		}
+	}
+	if _, err := parseHyprAddress("window"); err == nil {
+		t.Error("Expected error for an invalid address")
+	}
+	if selector := hyprSelector(0x55d3c6b2a1b0); selector != "address:0x55d3c6b2a1b0" {
+		t.Errorf("hyprSelector: got %q", selector)
+	}
+}
@@ -0,0 +1,176 @@
+package desktop
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// ipcCapabilities are the EWMH equivalents of what the sway and Hyprland
+// backends provide. Neither reports a stacking order.
+var ipcCapabilities = []string{
+	"_NET_CLIENT_LIST",
+	"_NET_ACTIVE_WINDOW",
+	"_NET_NUMBER_OF_DESKTOPS",
+	"_NET_DESKTOP_NAMES",
+	"_NET_CURRENT_DESKTOP",
+	"_NET_WM_DESKTOP",
+	"_NET_CLOSE_WINDOW",
+	"_NET_WM_STATE",
+	"_NET_WM_STATE_STICKY",
+	"_NET_WM_STATE_FULLSCREEN",
+	"_NET_WM_STATE_HIDDEN",
+}
+
+// ipcState is the window list of a compositor speaking a JSON IPC protocol,
+// fetched in one go and never changed afterwards
+type ipcState struct {
+	windows    []*shared.Window
+	byID       map[int]*shared.Window
+	activeID   int
+	workspaces []string // Workspace names indexed by desktop number
+	current    int      // Desktop of the focused workspace, -1 if unknown
+	monitors   []shared.Monitor
+}
+
+// newIPCState creates an empty state
+func newIPCState() *ipcState {
+	return &ipcState{byID: make(map[int]*shared.Window), current: -1}
+}
+
+// add appends a window
+func (s *ipcState) add(w *shared.Window) {
+	s.windows = append(s.windows, w)
+	s.byID[w.ID] = w
+}
+
+// window returns a copy of a window, nil if unknown
+func (s *ipcState) window(windowID int) *shared.Window {
+	if w := s.byID[windowID]; w != nil {
+		copied := *w
+		return &copied
+	}
+	return nil
+}
+
+// list returns copies of all windows
+func (s *ipcState) list() []*shared.Window {
+	windows := make([]*shared.Window, len(s.windows))
+	for i, w := range s.windows {
+		copied := *w
+		windows[i] = &copied
+	}
+	return windows
+}
+
+// ids returns the IDs of all windows
+func (s *ipcState) ids() []int {
+	ids := make([]int, len(s.windows))
+	for i, w := range s.windows {
+		ids[i] = w.ID
+	}
+	return ids
+}
+
+// ipcCache keeps the last fetched state until an event or command
+// invalidates it, so the many small queries of the daemon cost one fetch
+// per change
+type ipcCache struct {
+	fetch func() (*ipcState, error)
+	state *ipcState
+	stale atomic.Bool
+	mutex sync.Mutex
+}
+
+// current returns the cached state, fetching it again if invalidated.
+// A failed fetch yields an empty state.
+func (c *ipcCache) current() *ipcState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.state != nil && !c.stale.Load() {
+		return c.state
+	}
+	// Cleared first, an event arriving during the fetch invalidates it again
+	c.stale.Store(false)
+	state, err := c.fetch()
+	if err != nil {
+		log.Error("Failed to get the window list: %v", err)
+		c.stale.Store(true)
+		return newIPCState()
+	}
+	c.state = state
+	return state
+}
+
+// invalidate makes the next current fetch the state again
+func (c *ipcCache) invalidate() {
+	c.stale.Store(true)
+}
+
+// awaitGone fetches the state until a window is no longer listed.
+// Returns false if the window is still listed after the timeout.
+func (c *ipcCache) awaitGone(windowID int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		c.invalidate()
+		if c.current().window(windowID) == nil {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(closePollInterval)
+	}
+}
+
+// ipcEventQueue hands events from a reader goroutine to AwaitEvent.
+// Like the X event pump it never blocks, events nobody reads are dropped.
+type ipcEventQueue struct {
+	events  chan Event
+	dropped atomic.Int64 // Events dropped since the last await
+}
+
+// newIPCEventQueue creates an empty queue
+func newIPCEventQueue() *ipcEventQueue {
+	return &ipcEventQueue{events: make(chan Event, eventBuffer)}
+}
+
+// push queues an event or drops it if the queue is full
+func (q *ipcEventQueue) push(event Event) {
+	select {
+	case q.events <- event:
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+// close ends the queue, await returns EventNone from then on
+func (q *ipcEventQueue) close() {
+	close(q.events)
+}
+
+// await waits for the next event, see WindowManager.AwaitEvent
+func (q *ipcEventQueue) await(ctx context.Context) Event {
+	if ctx.Err() != nil {
+		return Event{}
+	}
+	if dropped := q.dropped.Swap(0); dropped > 0 {
+		log.Warn("Dropped %d IPC events, the event queue was full", dropped)
+		return Event{Kind: EventOverflow}
+	}
+
+	select {
+	case event, ok := <-q.events:
+		if !ok {
+			return Event{}
+		}
+		return event
+	case <-ctx.Done():
+		return Event{}
+	}
+}
@@ -11,12 +11,23 @@ import (
 // MockWindowManager is a mock implementation of the window manager protocol
 type MockWindowManager struct {
 	mu           sync.Mutex
-	events       chan interface{}
+	events       chan Event
 	eventCount   int
 	eventsInit   bool
 	windows      map[int]*shared.Window
 	activeWindow int
 	windowIDs    []int
+	activations  []int
+	desktopNames []string
+	currentDesk  int
+	monitors     []shared.Monitor
+	stacking     []int
+	hung         map[int]bool
+	busy         map[int]bool
+	kills        []int
+	pings        []int
+	calls        map[string]int
+	caps         Capabilities
 }
 
 // NewMockWindowManager creates a new mock window manager instance
@@ -25,11 +36,17 @@ type MockWindowManager struct {
 //	*MockWindowManager: New mock window manager instance
 func NewMockWindowManager() *MockWindowManager {
 	wm := &MockWindowManager{
-		events:       make(chan interface{}, 10), // Buffered channel for events
+		events:       make(chan Event, 10), // Buffered channel for events
 		eventsInit:   true,
 		windows:      make(map[int]*shared.Window),
 		activeWindow: 1,
-		windowIDs:    []int{1, 2, 3},
+		windowIDs:    make([]int, 0, 3),
+		desktopNames: []string{"main", "work"},
+		currentDesk:  0,
+		hung:         make(map[int]bool),
+		busy:         make(map[int]bool),
+		calls:        make(map[string]int),
+		caps:         FullCapabilities("mock"),
 	}
 
 	// Initialize default windows
@@ -50,7 +67,7 @@ func NewMockWindowManager() *MockWindowManager {
 // Args:
 //
 //	event: Event to enqueue
-func (wm *MockWindowManager) EnqueueEvent(event interface{}) {
+func (wm *MockWindowManager) EnqueueEvent(event Event) {
 	wm.events <- event
 }
 
@@ -65,44 +82,23 @@ func (wm *MockWindowManager) InitEvents() bool {
 	return true
 }
 
-// AwaitEvent waits for and handles events with optional abort mechanism
+// AwaitEvent waits for the next enqueued event or cancellation
 // Args:
 //
 //	ctx: Context for cancellation
 //
 // Returns:
 //
-//	string: The event name (if a string was enqueued) or "" if aborted, error occurred, or non-string event
-func (wm *MockWindowManager) AwaitEvent(ctx context.Context) string {
+//	Event: The enqueued event, or an EventNone event if cancelled
+func (wm *MockWindowManager) AwaitEvent(ctx context.Context) Event {
 	select {
 	case <-ctx.Done():
-		return "" // Return empty string on cancellation
-	default:
-		// Non-blocking check for context done before acquiring lock
-		select {
-		case <-ctx.Done():
-			return ""
-		default:
-		}
-
+		return Event{}
+	case event := <-wm.events:
 		wm.mu.Lock()
-		defer wm.mu.Unlock()
-
-		// Check for events
-		select {
-		case event := <-wm.events:
-			wm.eventCount++
-			// Return event name if it's a string, otherwise empty string
-			if eventName, ok := event.(string); ok {
-				return eventName
-			}
-			// Log if a non-string event was dequeued in the mock?
-			// log.Warn("MockWindowManager dequeued non-string event: %T", event)
-			return "" // Return empty string for non-string types
-		default:
-			// No event available
-			return "" // Return empty string if no event
-		}
+		wm.eventCount++
+		wm.mu.Unlock()
+		return event
 	}
 }
 
@@ -119,18 +115,106 @@ func (wm *MockWindowManager) ActiveWindowID() int {
 // StackingList gets information about all windows
 // Returns:
 //
-//	[]*shared.Window: List of windows
+//	[]*shared.Window: Copies of all windows
 func (wm *MockWindowManager) StackingList() []*shared.Window {
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
+	wm.calls["StackingList"]++
 
+	// Copies, like every scan of the real WM returns new windows
 	windows := make([]*shared.Window, len(wm.windowIDs))
 	for i, id := range wm.windowIDs {
-		windows[i] = wm.windows[id]
+		window := *wm.windows[id]
+		windows[i] = &window
 	}
 	return windows
 }
 
+// ClientIDs gets the IDs of all mock windows
+// Returns:
+//
+//	[]int: Window IDs in list order
+func (wm *MockWindowManager) ClientIDs() []int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.calls["ClientIDs"]++
+	return append([]int(nil), wm.windowIDs...)
+}
+
+// StackingOrder gets the mock stacking order
+// Returns:
+//
+//	[]int: Window IDs from bottom to top as set with SetStackingOrder, nil by default
+func (wm *MockWindowManager) StackingOrder() []int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]int(nil), wm.stacking...)
+}
+
+// SetStackingOrder replaces the mock stacking order for testing.
+// Args:
+//
+//	windowIDs: Window IDs from bottom to top
+func (wm *MockWindowManager) SetStackingOrder(windowIDs []int) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.stacking = append([]int(nil), windowIDs...)
+}
+
+// WindowInfo gets a copy of a mock window
+// Args:
+//
+//	windowID: Window ID
+//
+// Returns:
+//
+//	*shared.Window: Copy of the window or nil if not found
+func (wm *MockWindowManager) WindowInfo(windowID int) *shared.Window {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.calls["WindowInfo"]++
+	window, ok := wm.windows[windowID]
+	if !ok {
+		return nil
+	}
+	info := *window
+	return &info
+}
+
+// WindowState gets the state flags of a mock window
+// Args:
+//
+//	windowID: Window ID
+//
+// Returns:
+//
+//	shared.WindowState: State flags, 0 if not found
+func (wm *MockWindowManager) WindowState(windowID int) shared.WindowState {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if window := wm.windows[windowID]; window != nil {
+		return window.State
+	}
+	return 0
+}
+
+// WindowGeometry gets the geometry of a mock window
+// Args:
+//
+//	windowID: Window ID
+//
+// Returns:
+//
+//	shared.Geometry: Geometry, empty if not found
+func (wm *MockWindowManager) WindowGeometry(windowID int) shared.Geometry {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if window := wm.windows[windowID]; window != nil {
+		return window.Geometry
+	}
+	return shared.Geometry{}
+}
+
 // WindowTitle gets the title of a window
 // Args:
 //
@@ -142,6 +226,7 @@ func (wm *MockWindowManager) StackingList() []*shared.Window {
 func (wm *MockWindowManager) WindowTitle(windowID int) string {
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
+	wm.calls["WindowTitle"]++
 	window := wm.windows[windowID]
 	if window != nil {
 		return window.Title
@@ -235,6 +320,22 @@ func (wm *MockWindowManager) AddWindow(window *shared.Window) {
 	wm.windowIDs = append([]int{window.ID}, wm.windowIDs...)
 }
 
+// SetWindowTitle changes the title of a window for testing.
+// The window is replaced by a renamed copy, like a rescan of the real WM would.
+// Args:
+//
+//	windowID: Window ID
+//	title: New title
+func (wm *MockWindowManager) SetWindowTitle(windowID int, title string) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if window, ok := wm.windows[windowID]; ok {
+		renamed := *window
+		renamed.Title = title
+		wm.windows[windowID] = &renamed
+	}
+}
+
 // RemoveWindow removes a window for testing
 // Args:
 //
@@ -263,24 +364,319 @@ func (wm *MockWindowManager) RemoveWindow(windowID int) {
 }
 
 // CloseWindow simulates closing a window by removing it from the mock state.
+// Windows marked with SetHung stay open.
 // Returns an error if the windowID does not exist.
 func (wm *MockWindowManager) CloseWindow(windowID int) error {
 	wm.mu.Lock()
 	_, exists := wm.windows[windowID]
+	ignored := wm.hung[windowID] || wm.busy[windowID]
 	wm.mu.Unlock() // Unlock before potentially returning error or calling RemoveWindow (which locks again)
 
 	if !exists {
 		return fmt.Errorf("mock window %d not found, cannot close", windowID)
 	}
+	if ignored {
+		return nil
+	}
 
 	// Use the existing RemoveWindow logic which handles maps, slices, and active window update
 	wm.RemoveWindow(windowID)
-	// Optionally, enqueue a DestroyNotify event here if needed for testing downstream consumers
-	// wm.EnqueueEvent(fmt.Sprintf("DestroyNotify:%d", windowID)) // Example event
 	return nil
 }
 
-// addWindow adds a window to the internal map
+// KillWindow simulates killing a window, removing it even if it ignores close requests.
+// Returns an error if the windowID does not exist.
+func (wm *MockWindowManager) KillWindow(windowID int) error {
+	wm.mu.Lock()
+	_, exists := wm.windows[windowID]
+	if exists {
+		wm.kills = append(wm.kills, windowID)
+	}
+	wm.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("mock window %d not found, cannot kill", windowID)
+	}
+	wm.RemoveWindow(windowID)
+	return nil
+}
+
+// SetHung makes a window behave like a hung client, it ignores CloseWindow
+// and does not answer pings.
+// Args:
+//
+//	windowID: Window ID
+//	hung: True to stop the window from reacting
+func (wm *MockWindowManager) SetHung(windowID int, hung bool) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.hung[windowID] = hung
+}
+
+// SetBusy makes a window ignore CloseWindow while it still answers pings,
+// like an application asking the user to save changes.
+// Args:
+//
+//	windowID: Window ID
+//	busy: True to keep the window open when asked to close
+func (wm *MockWindowManager) SetBusy(windowID int, busy bool) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.busy[windowID] = busy
+}
+
+// PingWindow records a ping. Windows that are not hung answer right away
+// with an EventPong, dropped if the event queue is full.
+// Args:
+//
+//	windowID: Window ID
+//
+// Returns:
+//
+//	bool: True if the window exists
+func (wm *MockWindowManager) PingWindow(windowID int) bool {
+	wm.mu.Lock()
+	_, exists := wm.windows[windowID]
+	hung := wm.hung[windowID]
+	if exists {
+		wm.pings = append(wm.pings, windowID)
+	}
+	wm.mu.Unlock()
+
+	if exists && !hung {
+		select {
+		case wm.events <- Event{Kind: EventPong, WindowID: windowID}:
+		default:
+		}
+	}
+	return exists
+}
+
+// Pings returns the IDs of all windows pinged so far, oldest first
+// Returns:
+//
+//	[]int: Pinged window IDs
+func (wm *MockWindowManager) Pings() []int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]int(nil), wm.pings...)
+}
+
+// Kills returns the IDs of all windows killed so far, oldest first
+// Returns:
+//
+//	[]int: Killed window IDs
+func (wm *MockWindowManager) Kills() []int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]int(nil), wm.kills...)
+}
+
+// ActivateWindow simulates activating a window and records the activation.
+// Returns an error if the windowID does not exist.
+func (wm *MockWindowManager) ActivateWindow(windowID int) error {
+	wm.mu.Lock()
+	window, exists := wm.windows[windowID]
+	if exists {
+		wm.activations = append(wm.activations, windowID)
+		if window.Desktop >= 0 {
+			wm.currentDesk = window.Desktop
+		}
+	}
+	wm.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("mock window %d not found, cannot activate", windowID)
+	}
+	wm.SetActiveWindow(windowID)
+	return nil
+}
+
+// CallCount returns how often a query method was called, for testing how
+// much traffic an update causes. Counted are StackingList, ClientIDs,
+// WindowInfo and WindowTitle.
+// Args:
+//
+//	method: Method name
+//
+// Returns:
+//
+//	int: Number of calls so far
+func (wm *MockWindowManager) CallCount(method string) int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.calls[method]
+}
+
+// Activations returns the IDs of all windows activated so far, oldest first
+// Returns:
+//
+//	[]int: Activated window IDs
+func (wm *MockWindowManager) Activations() []int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]int(nil), wm.activations...)
+}
+
+// DesktopCount gets the number of mock desktops
+// Returns:
+//
+//	int: Number of desktops
+func (wm *MockWindowManager) DesktopCount() int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return len(wm.desktopNames)
+}
+
+// DesktopNames gets the names of the mock desktops
+// Returns:
+//
+//	[]string: Desktop names indexed by desktop number
+func (wm *MockWindowManager) DesktopNames() []string {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]string(nil), wm.desktopNames...)
+}
+
+// CurrentDesktop gets the current mock desktop
+// Returns:
+//
+//	int: Current desktop index
+func (wm *MockWindowManager) CurrentDesktop() int {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.currentDesk
+}
+
+// SwitchDesktop simulates switching desktops.
+// Returns an error if the desktop does not exist.
+func (wm *MockWindowManager) SwitchDesktop(desktop int) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if err := wm.caps.Require("_NET_CURRENT_DESKTOP"); err != nil {
+		return err
+	}
+	if desktop < 0 || desktop >= len(wm.desktopNames) {
+		return fmt.Errorf("mock desktop %d out of range", desktop)
+	}
+	wm.currentDesk = desktop
+	return nil
+}
+
+// Monitors gets the mock monitors
+// Returns:
+//
+//	[]shared.Monitor: Monitors set with SetMonitors, nil by default
+func (wm *MockWindowManager) Monitors() []shared.Monitor {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]shared.Monitor(nil), wm.monitors...)
+}
+
+// SetMonitors replaces the mock monitors for testing.
+// Windows keep their Monitor field, set it when adding them.
+// Args:
+//
+//	monitors: Monitors to report
+func (wm *MockWindowManager) SetMonitors(monitors []shared.Monitor) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.monitors = monitors
+}
+
+// MoveWindowToDesktop simulates moving a window to another desktop.
+// The window is replaced by a moved copy, like a rescan of the real WM would.
+// Returns an error if the window or desktop does not exist.
+func (wm *MockWindowManager) MoveWindowToDesktop(windowID int, desktop int) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if err := wm.caps.Require("_NET_WM_DESKTOP"); err != nil {
+		return err
+	}
+	window, ok := wm.windows[windowID]
+	if !ok {
+		return fmt.Errorf("mock window %d not found, cannot move", windowID)
+	}
+	if desktop < 0 || desktop >= len(wm.desktopNames) {
+		return fmt.Errorf("mock desktop %d out of range", desktop)
+	}
+	moved := *window
+	moved.Desktop = desktop
+	wm.windows[windowID] = &moved
+	return nil
+}
+
+// SetWindowState simulates adding or removing state flags of a window.
+// Returns an error if the windowID does not exist.
+func (wm *MockWindowManager) SetWindowState(windowID int, state shared.WindowState, enabled bool) error {
+	return wm.updateState(windowID, func(current shared.WindowState) shared.WindowState {
+		if enabled {
+			return current | state
+		}
+		return current &^ state
+	})
+}
+
+// ToggleWindowState simulates toggling state flags of a window.
+// Returns an error if the windowID does not exist.
+func (wm *MockWindowManager) ToggleWindowState(windowID int, state shared.WindowState) error {
+	return wm.updateState(windowID, func(current shared.WindowState) shared.WindowState {
+		return current ^ state
+	})
+}
+
+// MinimizeWindow simulates iconifying a window by setting its hidden flag.
+// Returns an error if the windowID does not exist.
+func (wm *MockWindowManager) MinimizeWindow(windowID int) error {
+	return wm.SetWindowState(windowID, shared.StateHidden, true)
+}
+
+// Capabilities gets the mock capabilities
+// Returns:
+//
+//	Capabilities: Every feature by default, see SetCapabilities
+func (wm *MockWindowManager) Capabilities() Capabilities {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.caps
+}
+
+// SetCapabilities replaces the mock capabilities for testing.
+// Desktop switching and moving fail if their atoms are missing.
+// Args:
+//
+//	caps: New capabilities
+func (wm *MockWindowManager) SetCapabilities(caps Capabilities) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.caps = caps
+}
+
+// updateState applies a state change to a mock window
+func (wm *MockWindowManager) updateState(windowID int, change func(shared.WindowState) shared.WindowState) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	window, ok := wm.windows[windowID]
+	if !ok {
+		return fmt.Errorf("mock window %d not found, cannot change state", windowID)
+	}
+	changed := *window
+	changed.State = change(window.State)
+	wm.windows[windowID] = &changed
+	return nil
+}
+
+// SetDesktopNames replaces the mock desktops for testing
+// Args:
+//
+//	names: Desktop names, one per desktop
+func (wm *MockWindowManager) SetDesktopNames(names []string) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.desktopNames = names
+}
+
+// addWindow adds a window to the internal map, keeping creation order
 // Args:
 //
 //	window: Window to add
@@ -288,5 +684,5 @@ func (wm *MockWindowManager) addWindow(window *shared.Window) {
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
 	wm.windows[window.ID] = window
-	wm.windowIDs = append([]int{window.ID}, wm.windowIDs...)
+	wm.windowIDs = append(wm.windowIDs, window.ID)
 }
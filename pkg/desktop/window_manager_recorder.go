@@ -0,0 +1,162 @@
+package desktop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// Recorder wraps a WindowManager and writes a session trace of its events
+// and state for Replay. After every event the window list, active window,
+// current desktop and stacking order are read and written if they changed,
+// and the monitors after EventMonitors, so the trace follows the desktop
+// although the daemon only re-reads what an event touched. Results of
+// StackingList and ActiveWindowID calls are written the same way. All other
+// methods are passed through.
+type Recorder struct {
+	WindowManager
+	encoder *json.Encoder
+	last    map[string][]byte // Last written state entry by type, without time
+	failed  bool              // Set after a write error, recording stopped
+	mutex   sync.Mutex
+}
+
+// TraceWriter is the destination of a session trace. Every entry is a
+// single locked write, so the recorders of several connections, e.g. before
+// and after reconnecting, can share it without mixing their lines.
+type TraceWriter struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+// NewTraceWriter creates a TraceWriter
+// Args:
+//
+//	w: Destination of the trace, e.g. a file
+//
+// Returns:
+//
+//	*TraceWriter: Writer to share between recorders
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{w: w}
+}
+
+// Write writes one encoded trace entry
+func (t *TraceWriter) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.w.Write(p)
+}
+
+// NewRecorder starts a trace with the capabilities, desktops, monitors and
+// the current state of a window manager
+// Args:
+//
+//	wm: Window manager to record
+//	trace: Destination of the trace, several recorders may share it
+//
+// Returns:
+//
+//	*Recorder: The recording window manager
+func NewRecorder(wm WindowManager, trace *TraceWriter) *Recorder {
+	r := &Recorder{
+		WindowManager: wm,
+		// Encode writes each entry with a single Write
+		encoder: json.NewEncoder(trace),
+		last:    make(map[string][]byte),
+	}
+	caps := wm.Capabilities()
+	r.write(traceEntry{
+		Type:         traceStart,
+		Capabilities: &caps,
+		DesktopCount: wm.DesktopCount(),
+		DesktopNames: wm.DesktopNames(),
+		Monitors:     wm.Monitors(),
+	})
+	r.recordState()
+	return r
+}
+
+// AwaitEvent waits for the next event and records it with the state after it
+func (r *Recorder) AwaitEvent(ctx context.Context) Event {
+	event := r.WindowManager.AwaitEvent(ctx)
+	if event.Kind == EventNone {
+		return event
+	}
+	r.write(traceEntry{Type: traceEvent, Event: newTraceEventData(event)})
+	if event.Kind == EventMonitors {
+		r.write(traceEntry{Type: traceMonitors, Monitors: r.WindowManager.Monitors()})
+	}
+	r.recordState()
+	return event
+}
+
+// StackingList returns the windows of the wrapped window manager and records them
+func (r *Recorder) StackingList() []*shared.Window {
+	windows := r.WindowManager.StackingList()
+	r.recordWindows(windows)
+	return windows
+}
+
+// ActiveWindowID returns the active window of the wrapped window manager and records it
+func (r *Recorder) ActiveWindowID() int {
+	activeID := r.WindowManager.ActiveWindowID()
+	r.writeChanged(traceEntry{Type: traceActive, Active: activeID})
+	return activeID
+}
+
+// recordState reads and records the state of the wrapped window manager
+func (r *Recorder) recordState() {
+	r.recordWindows(r.WindowManager.StackingList())
+	r.writeChanged(traceEntry{Type: traceActive, Active: r.WindowManager.ActiveWindowID()})
+	r.writeChanged(traceEntry{Type: traceDesktop, Desktop: r.WindowManager.CurrentDesktop()})
+	r.writeChanged(traceEntry{Type: traceStacking, Stacking: r.WindowManager.StackingOrder()})
+}
+
+// recordWindows records a window list, nil means the list could not be read
+func (r *Recorder) recordWindows(windows []*shared.Window) {
+	if windows != nil {
+		r.writeChanged(traceEntry{Type: traceWindows, Windows: windows})
+	}
+}
+
+// writeChanged writes a state entry unless it equals the last one of its type
+func (r *Recorder) writeChanged(entry traceEntry) {
+	key, err := json.Marshal(entry)
+	if err != nil {
+		log.Error("Failed to encode %s trace entry: %v", entry.Type, err)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if bytes.Equal(key, r.last[entry.Type]) {
+		return
+	}
+	r.last[entry.Type] = key
+	r.writeLocked(entry)
+}
+
+func (r *Recorder) write(entry traceEntry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.writeLocked(entry)
+}
+
+// writeLocked timestamps and writes an entry, the mutex must be held
+func (r *Recorder) writeLocked(entry traceEntry) {
+	if r.failed {
+		return
+	}
+	entry.Time = time.Now()
+	if err := r.encoder.Encode(entry); err != nil {
+		log.Error("Failed to write session trace, recording stopped: %v", err)
+		r.failed = true
+	}
+}
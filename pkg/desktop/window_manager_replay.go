@@ -0,0 +1,363 @@
+package desktop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"gofi/pkg/shared"
+)
+
+// Replay is a WindowManager playing back a session trace written by a
+// Recorder. AwaitEvent hands out the recorded events in order without
+// waiting, queries answer with the state recorded after the last event
+// handed out. Once all events are consumed AwaitEvent returns EventNone,
+// like for a closed connection. Actions succeed without any effect, their
+// outcome is part of the trace.
+type Replay struct {
+	entries      []traceEntry
+	next         int // Index of the next event or start entry
+	windows      []*shared.Window
+	activeID     int
+	current      int
+	stacking     []int
+	caps         Capabilities
+	desktopCount int
+	desktopNames []string
+	monitors     []shared.Monitor
+	mutex        sync.Mutex
+}
+
+// NewReplay reads a session trace and sets up the state it starts with
+// Args:
+//
+//	r: Trace as written by a Recorder
+//
+// Returns:
+//
+//	*Replay: Window manager positioned before the first event
+//	error: Error if the trace is malformed
+func NewReplay(r io.Reader) (*Replay, error) {
+	decoder := json.NewDecoder(r)
+	var entries []traceEntry
+	for line := 1; ; line++ {
+		var entry traceEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("trace entry %d: %w", line, err)
+		}
+		if err := validateTraceEntry(entry); err != nil {
+			return nil, fmt.Errorf("trace entry %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 || entries[0].Type != traceStart {
+		return nil, fmt.Errorf("trace does not begin with a %s entry", traceStart)
+	}
+
+	replay := &Replay{entries: entries, current: -1}
+	replay.apply(entries[0])
+	replay.next = 1
+	replay.applyState()
+	return replay, nil
+}
+
+// OpenReplay reads a session trace from a file
+// Args:
+//
+//	path: Path of the trace file
+//
+// Returns:
+//
+//	*Replay: Window manager positioned before the first event
+//	error: Error if the file cannot be read or is malformed
+func OpenReplay(path string) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	replay, err := NewReplay(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return replay, nil
+}
+
+// validateTraceEntry checks the type of an entry and the kind of events
+func validateTraceEntry(entry traceEntry) error {
+	switch entry.Type {
+	case traceStart:
+		if entry.Capabilities == nil {
+			return fmt.Errorf("%s entry without capabilities", traceStart)
+		}
+	case traceEvent:
+		if entry.Event == nil {
+			return fmt.Errorf("%s entry without event", traceEvent)
+		}
+		if _, err := entry.Event.event(); err != nil {
+			return err
+		}
+	case traceWindows, traceActive, traceDesktop, traceStacking, traceMonitors:
+	default:
+		return fmt.Errorf("unknown entry type %q", entry.Type)
+	}
+	return nil
+}
+
+// apply takes over the state of an entry
+func (r *Replay) apply(entry traceEntry) {
+	switch entry.Type {
+	case traceStart:
+		r.caps = *entry.Capabilities
+		r.desktopCount = entry.DesktopCount
+		r.desktopNames = entry.DesktopNames
+		r.monitors = entry.Monitors
+	case traceWindows:
+		r.windows = entry.Windows
+	case traceActive:
+		r.activeID = entry.Active
+	case traceDesktop:
+		r.current = entry.Desktop
+	case traceStacking:
+		r.stacking = entry.Stacking
+	case traceMonitors:
+		r.monitors = entry.Monitors
+	}
+}
+
+// applyState applies the state entries up to the next event or start entry
+func (r *Replay) applyState() {
+	for r.next < len(r.entries) {
+		entry := r.entries[r.next]
+		if entry.Type == traceEvent || entry.Type == traceStart {
+			return
+		}
+		r.apply(entry)
+		r.next++
+	}
+}
+
+// InitEvents does nothing, the events are in the trace
+func (r *Replay) InitEvents() bool {
+	return true
+}
+
+// AwaitEvent returns the next recorded event and moves on to the state
+// after it. A reconnect in the trace is reported as EventOverflow, all
+// state has to be re-read. EventNone is returned at the end of the trace
+// or if the context is cancelled.
+func (r *Replay) AwaitEvent(ctx context.Context) Event {
+	if ctx.Err() != nil {
+		return Event{}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.next >= len(r.entries) {
+		return Event{}
+	}
+	entry := r.entries[r.next]
+	r.next++
+	r.apply(entry)
+	r.applyState()
+
+	if entry.Type == traceStart {
+		return Event{Kind: EventOverflow}
+	}
+	event, _ := entry.Event.event() // Checked by NewReplay
+	return event
+}
+
+// Ended reports whether all events were handed out
+func (r *Replay) Ended() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.next >= len(r.entries)
+}
+
+// ActiveWindowID returns the recorded active window
+func (r *Replay) ActiveWindowID() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.activeID
+}
+
+// StackingList returns copies of the recorded windows
+func (r *Replay) StackingList() []*shared.Window {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	windows := make([]*shared.Window, 0, len(r.windows))
+	for _, w := range r.windows {
+		copied := *w
+		windows = append(windows, &copied)
+	}
+	return windows
+}
+
+// ClientIDs returns the IDs of the recorded windows
+func (r *Replay) ClientIDs() []int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ids := make([]int, 0, len(r.windows))
+	for _, w := range r.windows {
+		ids = append(ids, w.ID)
+	}
+	return ids
+}
+
+// StackingOrder returns the recorded stacking order
+func (r *Replay) StackingOrder() []int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]int(nil), r.stacking...)
+}
+
+// window returns a copy of a recorded window, nil if it is not listed
+func (r *Replay) window(windowID int) *shared.Window {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, w := range r.windows {
+		if w.ID == windowID {
+			copied := *w
+			return &copied
+		}
+	}
+	return nil
+}
+
+// WindowInfo returns a recorded window
+func (r *Replay) WindowInfo(windowID int) *shared.Window {
+	return r.window(windowID)
+}
+
+// WindowDesktop returns the desktop of a recorded window, -1 if unknown
+func (r *Replay) WindowDesktop(windowID int) int {
+	if w := r.window(windowID); w != nil {
+		return w.Desktop
+	}
+	return -1
+}
+
+// WindowState returns the state flags of a recorded window
+func (r *Replay) WindowState(windowID int) shared.WindowState {
+	if w := r.window(windowID); w != nil {
+		return w.State
+	}
+	return 0
+}
+
+// WindowGeometry returns the geometry of a recorded window
+func (r *Replay) WindowGeometry(windowID int) shared.Geometry {
+	if w := r.window(windowID); w != nil {
+		return w.Geometry
+	}
+	return shared.Geometry{}
+}
+
+// WindowTitle returns the title of a recorded window
+func (r *Replay) WindowTitle(windowID int) string {
+	if w := r.window(windowID); w != nil {
+		return w.Title
+	}
+	return ""
+}
+
+// WindowClass returns the instance and class of a recorded window
+func (r *Replay) WindowClass(windowID int) (string, string) {
+	if w := r.window(windowID); w != nil {
+		return w.Instance, w.ClassName
+	}
+	return "", ""
+}
+
+// CloseWindow does nothing, a recorded close shows in the following state
+func (r *Replay) CloseWindow(windowID int) error {
+	return nil
+}
+
+// PingWindow is not supported, recorded pongs are replayed as events
+func (r *Replay) PingWindow(windowID int) bool {
+	return false
+}
+
+// KillWindow does nothing
+func (r *Replay) KillWindow(windowID int) error {
+	return nil
+}
+
+// ActivateWindow does nothing
+func (r *Replay) ActivateWindow(windowID int) error {
+	return nil
+}
+
+// DesktopCount returns the recorded number of desktops
+func (r *Replay) DesktopCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.desktopCount
+}
+
+// DesktopNames returns the recorded desktop names
+func (r *Replay) DesktopNames() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.desktopNames...)
+}
+
+// CurrentDesktop returns the recorded current desktop
+func (r *Replay) CurrentDesktop() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.current
+}
+
+// SwitchDesktop does nothing
+func (r *Replay) SwitchDesktop(desktop int) error {
+	return nil
+}
+
+// Monitors returns the recorded monitors
+func (r *Replay) Monitors() []shared.Monitor {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]shared.Monitor(nil), r.monitors...)
+}
+
+// MoveWindowToDesktop does nothing
+func (r *Replay) MoveWindowToDesktop(windowID int, desktop int) error {
+	return nil
+}
+
+// SetWindowState does nothing
+func (r *Replay) SetWindowState(windowID int, state shared.WindowState, enabled bool) error {
+	return nil
+}
+
+// ToggleWindowState does nothing
+func (r *Replay) ToggleWindowState(windowID int, state shared.WindowState) error {
+	return nil
+}
+
+// MinimizeWindow does nothing
+func (r *Replay) MinimizeWindow(windowID int) error {
+	return nil
+}
+
+// Capabilities returns the recorded capabilities
+func (r *Replay) Capabilities() Capabilities {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.caps
+}
@@ -0,0 +1,168 @@
+package desktop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"gofi/pkg/shared"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	mock := NewMockWindowManager()
+	var trace bytes.Buffer
+	recorder := NewRecorder(mock, NewTraceWriter(&trace))
+	ctx := context.Background()
+
+	// A new window opens and gets the focus, another window changes its title
+	mock.AddWindow(shared.NewWindow(4, "Mail", "thunderbird", "Normal", "thunderbird", 1, 88))
+	mock.EnqueueEvent(Event{Kind: EventProperty, WindowID: 1, Atom: "_NET_CLIENT_LIST"})
+	recorder.AwaitEvent(ctx)
+	mock.SetActiveWindow(4)
+	mock.EnqueueEvent(Event{Kind: EventProperty, WindowID: 1, Atom: "_NET_ACTIVE_WINDOW"})
+	recorder.AwaitEvent(ctx)
+	mock.SetWindowTitle(2, "Browser - News")
+	mock.EnqueueEvent(Event{Kind: EventProperty, WindowID: 2, Atom: "_NET_WM_NAME"})
+	recorder.AwaitEvent(ctx)
+	mock.EnqueueEvent(Event{Kind: EventPong, WindowID: 2})
+	recorder.AwaitEvent(ctx)
+
+	// start and the initial state, 4 events and 3 state changes, the pong changed nothing
+	if lines := strings.Count(trace.String(), "\n"); lines != 5+4+3 {
+		t.Errorf("Expected 12 trace lines, got %d:\n%s", lines, trace.String())
+	}
+
+	replay, err := NewReplay(&trace)
+	if err != nil {
+		t.Fatalf("NewReplay failed: %v", err)
+	}
+	if caps := replay.Capabilities(); caps.WindowManager != "mock" {
+		t.Errorf("Expected the mock capabilities, got %s", caps)
+	}
+	if names := replay.DesktopNames(); !slices.Equal(names, []string{"main", "work"}) {
+		t.Errorf("Expected the mock desktop names, got %v", names)
+	}
+	if ids := replay.ClientIDs(); !slices.Equal(ids, []int{1, 2, 3}) || replay.ActiveWindowID() != 1 {
+		t.Errorf("Expected windows [1 2 3] with 1 active, got %v with %d", ids, replay.ActiveWindowID())
+	}
+
+	steps := []struct {
+		event    Event
+		clients  []int
+		activeID int
+	}{
+		{Event{Kind: EventProperty, WindowID: 1, Atom: "_NET_CLIENT_LIST"}, []int{4, 1, 2, 3}, 1},
+		{Event{Kind: EventProperty, WindowID: 1, Atom: "_NET_ACTIVE_WINDOW"}, []int{4, 1, 2, 3}, 4},
+		{Event{Kind: EventProperty, WindowID: 2, Atom: "_NET_WM_NAME"}, []int{4, 1, 2, 3}, 4},
+		{Event{Kind: EventPong, WindowID: 2}, []int{4, 1, 2, 3}, 4},
+	}
+	for i, step := range steps {
+		if event := replay.AwaitEvent(ctx); event != step.event {
+			t.Fatalf("Step %d: expected %s, got %s", i, step.event, event)
+		}
+		if ids := replay.ClientIDs(); !slices.Equal(ids, step.clients) {
+			t.Errorf("Step %d: expected windows %v, got %v", i, step.clients, ids)
+		}
+		if activeID := replay.ActiveWindowID(); activeID != step.activeID {
+			t.Errorf("Step %d: expected window %d to be active, got %d", i, step.activeID, activeID)
+		}
+	}
+	if title := replay.WindowTitle(2); title != "Browser - News" {
+		t.Errorf("Expected the new title, got %q", title)
+	}
+	if desktop := replay.WindowDesktop(4); desktop != 1 {
+		t.Errorf("Expected window 4 on desktop 1, got %d", desktop)
+	}
+
+	if event := replay.AwaitEvent(ctx); event.Kind != EventNone || !replay.Ended() {
+		t.Errorf("Expected the end of the session, got %s", event)
+	}
+}
+
+func TestReplayReconnect(t *testing.T) {
+	var buffer bytes.Buffer
+	trace := NewTraceWriter(&buffer)
+	NewRecorder(NewMockWindowManager(), trace)
+	second := NewMockWindowManager()
+	second.RemoveWindow(3)
+	NewRecorder(second, trace)
+
+	replay, err := NewReplay(&buffer)
+	if err != nil {
+		t.Fatalf("NewReplay failed: %v", err)
+	}
+	if event := replay.AwaitEvent(context.Background()); event.Kind != EventOverflow {
+		t.Errorf("Expected a reconnect to be replayed as overflow, got %s", event)
+	}
+	if ids := replay.ClientIDs(); !slices.Equal(ids, []int{1, 2}) {
+		t.Errorf("Expected the windows of the new connection, got %v", ids)
+	}
+}
+
+func TestRecordersShareTrace(t *testing.T) {
+	var buffer bytes.Buffer
+	trace := NewTraceWriter(&buffer)
+
+	// A stale connection still records while the new one starts
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		mock := NewMockWindowManager()
+		recorder := NewRecorder(mock, trace)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				mock.SetWindowTitle(2, fmt.Sprintf("Browser %d", j))
+				mock.EnqueueEvent(Event{Kind: EventProperty, WindowID: 2, Atom: "_NET_WM_NAME"})
+				recorder.AwaitEvent(context.Background())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := NewReplay(&buffer); err != nil {
+		t.Errorf("Lines of the recorders got mixed: %v", err)
+	}
+}
+
+func TestReplayMalformedTrace(t *testing.T) {
+	tests := map[string]string{
+		"empty":         "",
+		"no start":      `{"type":"active","active":1}`,
+		"unknown type":  `{"type":"start","capabilities":{}}` + "\n" + `{"type":"focus"}`,
+		"unknown event": `{"type":"start","capabilities":{}}` + "\n" + `{"type":"event","event":{"kind":"Teleport"}}`,
+		"broken json":   `{"type":"start"`,
+	}
+	for name, trace := range tests {
+		if _, err := NewReplay(strings.NewReader(trace)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestReplayMonitorChange(t *testing.T) {
+	mock := NewMockWindowManager()
+	var trace bytes.Buffer
+	recorder := NewRecorder(mock, NewTraceWriter(&trace))
+	mock.SetMonitors([]shared.Monitor{{Name: "HDMI-1", Geometry: shared.Geometry{Width: 1920, Height: 1080}}})
+	mock.EnqueueEvent(Event{Kind: EventMonitors})
+	recorder.AwaitEvent(context.Background())
+
+	replay, err := NewReplay(&trace)
+	if err != nil {
+		t.Fatalf("NewReplay failed: %v", err)
+	}
+	if monitors := replay.Monitors(); len(monitors) != 0 {
+		t.Errorf("Expected no monitors before the change, got %v", monitors)
+	}
+	if event := replay.AwaitEvent(context.Background()); event.Kind != EventMonitors {
+		t.Fatalf("Expected the monitor change, got %s", event)
+	}
+	if monitors := replay.Monitors(); len(monitors) != 1 || monitors[0].Name != "HDMI-1" {
+		t.Errorf("Expected the new monitor, got %v", monitors)
+	}
+}
@@ -0,0 +1,430 @@
+package desktop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// SwayWindowManager implements WindowManager with the IPC protocol shared by
+// sway and i3. Windows are identified by their container ID (con_id) and
+// workspaces serve as desktops. The window list is parsed from GET_TREE.
+type SwayWindowManager struct {
+	socketPath string
+	conn       *swayConn // Commands and queries
+	eventConn  *swayConn // Subscribed to events, nil before InitEvents
+	events     *ipcEventQueue
+	cache      ipcCache
+	mutex      sync.Mutex // Guards eventConn
+}
+
+func init() {
+	RegisterBackend(Backend{
+		Name:     "sway",
+		Priority: 20,
+		Probe: func() error {
+			if SwaySocketPath() == "" {
+				return fmt.Errorf("neither SWAYSOCK nor I3SOCK is set")
+			}
+			return nil
+		},
+		Open: func() (WindowManager, error) {
+			wm, err := NewSwayWindowManager(SwaySocketPath())
+			if err != nil {
+				return nil, err
+			}
+			return wm, nil
+		},
+	})
+}
+
+// NewSwayWindowManager connects to the IPC socket of sway or i3
+// Args:
+//
+//	socketPath: IPC socket, usually SwaySocketPath()
+//
+// Returns:
+//
+//	*SwayWindowManager: New window manager
+//	error: Error if the socket cannot be reached
+func NewSwayWindowManager(socketPath string) (*SwayWindowManager, error) {
+	if socketPath == "" {
+		return nil, fmt.Errorf("no sway or i3 IPC socket, neither SWAYSOCK nor I3SOCK is set")
+	}
+	conn, err := dialSway(socketPath)
+	if err != nil {
+		return nil, err
+	}
+	wm := &SwayWindowManager{
+		socketPath: socketPath,
+		conn:       conn,
+		events:     newIPCEventQueue(),
+	}
+	wm.cache.fetch = wm.fetchTree
+	return wm, nil
+}
+
+// fetchTree gets and parses the tree
+func (wm *SwayWindowManager) fetchTree() (*ipcState, error) {
+	var root swayNode
+	if err := wm.conn.request(swayGetTree, nil, &root); err != nil {
+		return nil, err
+	}
+	return parseSwayTree(&root), nil
+}
+
+// InitEvents subscribes to window, workspace and shutdown events on a
+// second connection, replies and events cannot share one.
+func (wm *SwayWindowManager) InitEvents() bool {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	if wm.eventConn != nil {
+		return true
+	}
+
+	conn, err := dialSway(wm.socketPath)
+	if err != nil {
+		log.Error("Failed to open event connection: %v", err)
+		return false
+	}
+	var result swayCommandResult
+	payload := []byte(`["window","workspace","shutdown"]`)
+	if err := conn.request(swaySubscribe, payload, &result); err != nil || !result.Success {
+		log.Error("Failed to subscribe to events: %v %s", err, result.Error)
+		conn.Close()
+		return false
+	}
+	wm.eventConn = conn
+	go wm.readEvents(conn)
+	return true
+}
+
+// readEvents converts events until the connection is closed
+func (wm *SwayWindowManager) readEvents(conn *swayConn) {
+	defer wm.events.close()
+	for {
+		msgType, payload, err := readSwayMessage(conn.conn)
+		if err != nil {
+			log.Debug("Sway event connection closed: %v", err)
+			return
+		}
+		if msgType == swayEventShutdown {
+			log.Info("Window manager is shutting down")
+			return
+		}
+		wm.cache.invalidate()
+		for _, event := range convertSwayEvent(msgType, payload) {
+			wm.events.push(event)
+		}
+	}
+}
+
+// convertSwayEvent maps an IPC event onto the EWMH property events the
+// daemon understands
+func convertSwayEvent(msgType uint32, payload []byte) []Event {
+	var event swayEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Warn("Malformed IPC event %d: %v", msgType, err)
+		return []Event{{Kind: EventOverflow}}
+	}
+
+	if msgType == swayEventWorkspace {
+		switch event.Change {
+		case "init", "empty", "rename", "move", "reload":
+			// Desktops are renumbered, every window may have moved
+			return []Event{{Kind: EventOverflow}}
+		case "focus":
+			return []Event{{Kind: EventProperty, Atom: "_NET_CURRENT_DESKTOP"}}
+		}
+		return nil
+	}
+	if msgType != swayEventWindow || event.Container == nil {
+		return nil
+	}
+
+	id := event.Container.ID
+	switch event.Change {
+	case "new", "close":
+		return []Event{{Kind: EventProperty, Atom: "_NET_CLIENT_LIST"}}
+	case "focus":
+		return []Event{{Kind: EventProperty, Atom: "_NET_ACTIVE_WINDOW"}}
+	case "title":
+		return []Event{{Kind: EventProperty, WindowID: id, Atom: "_NET_WM_NAME"}}
+	case "fullscreen_mode", "urgent":
+		return []Event{{Kind: EventProperty, WindowID: id, Atom: "_NET_WM_STATE"}}
+	case "floating":
+		return []Event{{Kind: EventConfigure, WindowID: id}}
+	case "move":
+		// To another workspace, output or the scratchpad
+		return []Event{
+			{Kind: EventProperty, WindowID: id, Atom: "_NET_WM_DESKTOP"},
+			{Kind: EventProperty, WindowID: id, Atom: "_NET_WM_STATE"},
+			{Kind: EventConfigure, WindowID: id},
+		}
+	}
+	return nil
+}
+
+// AwaitEvent waits for the next event. EventNone is returned when the
+// context is cancelled or the window manager went away.
+func (wm *SwayWindowManager) AwaitEvent(ctx context.Context) Event {
+	return wm.events.await(ctx)
+}
+
+// current returns the cached window list
+func (wm *SwayWindowManager) current() *ipcState {
+	return wm.cache.current()
+}
+
+// window returns a copy of a window of the current tree, nil if unknown
+func (wm *SwayWindowManager) window(windowID int) *shared.Window {
+	return wm.current().window(windowID)
+}
+
+// ActiveWindowID returns the container ID of the focused window
+func (wm *SwayWindowManager) ActiveWindowID() int {
+	return wm.current().activeID
+}
+
+// StackingList returns all windows in tree order
+func (wm *SwayWindowManager) StackingList() []*shared.Window {
+	return wm.current().list()
+}
+
+// ClientIDs returns the container IDs of all windows in tree order
+func (wm *SwayWindowManager) ClientIDs() []int {
+	return wm.current().ids()
+}
+
+// StackingOrder is empty, tiling window managers have no global stacking order
+func (wm *SwayWindowManager) StackingOrder() []int {
+	return nil
+}
+
+// WindowInfo returns a window of the current tree
+func (wm *SwayWindowManager) WindowInfo(windowID int) *shared.Window {
+	return wm.window(windowID)
+}
+
+// WindowDesktop returns the desktop of a window, -1 if unknown or in the scratchpad
+func (wm *SwayWindowManager) WindowDesktop(windowID int) int {
+	if w := wm.window(windowID); w != nil {
+		return w.Desktop
+	}
+	return -1
+}
+
+// WindowState returns the state flags of a window
+func (wm *SwayWindowManager) WindowState(windowID int) shared.WindowState {
+	if w := wm.window(windowID); w != nil {
+		return w.State
+	}
+	return 0
+}
+
+// WindowGeometry returns the geometry of a window
+func (wm *SwayWindowManager) WindowGeometry(windowID int) shared.Geometry {
+	if w := wm.window(windowID); w != nil {
+		return w.Geometry
+	}
+	return shared.Geometry{}
+}
+
+// WindowTitle returns the title of a window
+func (wm *SwayWindowManager) WindowTitle(windowID int) string {
+	if w := wm.window(windowID); w != nil {
+		return w.Title
+	}
+	return ""
+}
+
+// WindowClass returns the instance and class of a window, the app_id for
+// Wayland clients
+func (wm *SwayWindowManager) WindowClass(windowID int) (string, string) {
+	if w := wm.window(windowID); w != nil {
+		return w.Instance, w.ClassName
+	}
+	return "", ""
+}
+
+// command runs a command, e.g. "[con_id=12] focus", and fails if the
+// window manager rejects it
+func (wm *SwayWindowManager) command(format string, args ...interface{}) error {
+	command := fmt.Sprintf(format, args...)
+	var results []swayCommandResult
+	if err := wm.conn.request(swayRunCommand, []byte(command), &results); err != nil {
+		return err
+	}
+	wm.cache.invalidate()
+	for _, result := range results {
+		if !result.Success {
+			return fmt.Errorf("command %q failed: %s", command, result.Error)
+		}
+	}
+	return nil
+}
+
+// CloseWindow asks a window to close
+func (wm *SwayWindowManager) CloseWindow(windowID int) error {
+	return wm.command("[con_id=%d] kill", windowID)
+}
+
+// KillWindow kills a window with the kill command of its container. Only if
+// the command fails or the window is still there after processKillWait is
+// its process killed, which takes all other windows of the process along.
+func (wm *SwayWindowManager) KillWindow(windowID int) error {
+	w := wm.window(windowID)
+	if w == nil {
+		return fmt.Errorf("unknown window %d", windowID)
+	}
+	err := wm.command("[con_id=%d] kill", windowID)
+	if err == nil && wm.cache.awaitGone(windowID, processKillWait) {
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("window %d is still open after %s", windowID, processKillWait)
+	}
+	if w.PID <= 0 {
+		return err
+	}
+	log.Warn("Killing process %d of window %d: %v", w.PID, windowID, err)
+	return shared.KillProcess(w.PID, processKillWait)
+}
+
+// PingWindow is not supported, the compositor pings its clients itself
+func (wm *SwayWindowManager) PingWindow(windowID int) bool {
+	return false
+}
+
+// ActivateWindow focuses a window, switching to its workspace
+func (wm *SwayWindowManager) ActivateWindow(windowID int) error {
+	return wm.command("[con_id=%d] focus", windowID)
+}
+
+// DesktopCount returns the number of workspaces
+func (wm *SwayWindowManager) DesktopCount() int {
+	return len(wm.current().workspaces)
+}
+
+// DesktopNames returns the workspace names
+func (wm *SwayWindowManager) DesktopNames() []string {
+	return append([]string(nil), wm.current().workspaces...)
+}
+
+// CurrentDesktop returns the desktop of the focused workspace
+func (wm *SwayWindowManager) CurrentDesktop() int {
+	return wm.current().current
+}
+
+// workspaceName looks up the workspace of a desktop
+func (wm *SwayWindowManager) workspaceName(desktop int) (string, error) {
+	workspaces := wm.current().workspaces
+	if desktop < 0 || desktop >= len(workspaces) {
+		return "", fmt.Errorf("desktop %d out of range (0-%d)", desktop, len(workspaces)-1)
+	}
+	return workspaces[desktop], nil
+}
+
+// SwitchDesktop switches to a workspace
+func (wm *SwayWindowManager) SwitchDesktop(desktop int) error {
+	name, err := wm.workspaceName(desktop)
+	if err != nil {
+		return err
+	}
+	return wm.command("workspace %s", swayQuote(name))
+}
+
+// Monitors returns the outputs
+func (wm *SwayWindowManager) Monitors() []shared.Monitor {
+	return append([]shared.Monitor(nil), wm.current().monitors...)
+}
+
+// MoveWindowToDesktop moves a window to a workspace
+func (wm *SwayWindowManager) MoveWindowToDesktop(windowID int, desktop int) error {
+	name, err := wm.workspaceName(desktop)
+	if err != nil {
+		return err
+	}
+	return wm.command("[con_id=%d] move container to workspace %s", windowID, swayQuote(name))
+}
+
+// swayStateCommands maps the supported state flags to their command
+var swayStateCommands = []struct {
+	flag    shared.WindowState
+	command string
+}{
+	{shared.StateFullscreen, "fullscreen"},
+	{shared.StateSticky, "sticky"},
+}
+
+// SetWindowState changes fullscreen, sticky and hidden, which moves the
+// window to the scratchpad or shows it again. Other flags are not supported.
+func (wm *SwayWindowManager) SetWindowState(windowID int, state shared.WindowState, enabled bool) error {
+	mode := "disable"
+	if enabled {
+		mode = "enable"
+	}
+	var commands []string
+	for _, sc := range swayStateCommands {
+		if state&sc.flag != 0 {
+			commands = append(commands, sc.command+" "+mode)
+			state &^= sc.flag
+		}
+	}
+	if state&shared.StateHidden != 0 {
+		if enabled {
+			commands = append(commands, "move scratchpad")
+		} else {
+			commands = append(commands, "scratchpad show")
+		}
+		state &^= shared.StateHidden
+	}
+	if state != 0 {
+		return fmt.Errorf("window state %v %w", state.Names(), ErrUnsupported)
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	return wm.command("[con_id=%d] %s", windowID, strings.Join(commands, ", "))
+}
+
+// ToggleWindowState toggles fullscreen, sticky or hidden
+func (wm *SwayWindowManager) ToggleWindowState(windowID int, state shared.WindowState) error {
+	w := wm.window(windowID)
+	if w == nil {
+		return fmt.Errorf("unknown window %d", windowID)
+	}
+	return wm.SetWindowState(windowID, state, !w.State.Has(state))
+}
+
+// MinimizeWindow moves a window to the scratchpad
+func (wm *SwayWindowManager) MinimizeWindow(windowID int) error {
+	return wm.SetWindowState(windowID, shared.StateHidden, true)
+}
+
+// Capabilities reports sway, or i3 if its socket is in use
+func (wm *SwayWindowManager) Capabilities() Capabilities {
+	name := "sway"
+	// sway names its socket sway-ipc.*, i3 uses ipc-socket.* below an i3 directory
+	if !strings.Contains(filepath.Base(wm.socketPath), "sway") {
+		name = "i3"
+	}
+	return NewCapabilities(name, ipcCapabilities)
+}
+
+// Cleanup closes both IPC connections
+func (wm *SwayWindowManager) Cleanup() {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	wm.conn.Close()
+	if wm.eventConn != nil {
+		wm.eventConn.Close()
+	}
+}
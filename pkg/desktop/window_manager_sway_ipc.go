@@ -0,0 +1,297 @@
+package desktop
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gofi/pkg/shared"
+)
+
+// i3/sway IPC message types, see i3's ipc documentation
+const (
+	swayRunCommand uint32 = 0
+	swaySubscribe  uint32 = 2
+	swayGetTree    uint32 = 4
+
+	// Events have the highest bit set
+	swayEventFlag      uint32 = 1 << 31
+	swayEventWorkspace        = swayEventFlag | 0
+	swayEventWindow           = swayEventFlag | 3
+	swayEventShutdown         = swayEventFlag | 6
+)
+
+// swayMagic starts every IPC message
+const swayMagic = "i3-ipc"
+
+// swayHeaderSize is the magic string followed by payload length and type
+const swayHeaderSize = len(swayMagic) + 8
+
+// swayMaxPayload guards against reading garbage as a huge message
+const swayMaxPayload = 64 << 20
+
+// scratchpadWorkspace is the hidden workspace holding scratchpad windows
+const scratchpadWorkspace = "__i3_scratch"
+
+// SwaySocketPath returns the IPC socket of the running sway or i3
+// Returns:
+//
+//	string: Path from $SWAYSOCK or $I3SOCK, empty if neither is set
+func SwaySocketPath() string {
+	if path := os.Getenv("SWAYSOCK"); path != "" {
+		return path
+	}
+	return os.Getenv("I3SOCK")
+}
+
+// writeSwayMessage writes one IPC message.
+// i3 and sway use the host byte order, gofi only runs on little endian machines.
+func writeSwayMessage(w io.Writer, msgType uint32, payload []byte) error {
+	msg := make([]byte, swayHeaderSize, swayHeaderSize+len(payload))
+	copy(msg, swayMagic)
+	binary.LittleEndian.PutUint32(msg[len(swayMagic):], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(msg[len(swayMagic)+4:], msgType)
+	_, err := w.Write(append(msg, payload...))
+	return err
+}
+
+// readSwayMessage reads one IPC message, a reply or an event
+func readSwayMessage(r io.Reader) (uint32, []byte, error) {
+	header := make([]byte, swayHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if string(header[:len(swayMagic)]) != swayMagic {
+		return 0, nil, fmt.Errorf("invalid IPC magic %q", header[:len(swayMagic)])
+	}
+	length := binary.LittleEndian.Uint32(header[len(swayMagic):])
+	msgType := binary.LittleEndian.Uint32(header[len(swayMagic)+4:])
+	if length > swayMaxPayload {
+		return 0, nil, fmt.Errorf("IPC message of %d bytes is too large", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return msgType, payload, nil
+}
+
+// swayConn is a request/reply connection to the IPC socket
+type swayConn struct {
+	conn  net.Conn
+	mutex sync.Mutex
+}
+
+// dialSway connects to the IPC socket
+func dialSway(socketPath string) (*swayConn, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", socketPath, err)
+	}
+	return &swayConn{conn: conn}, nil
+}
+
+// request sends a message and decodes the reply into result
+func (c *swayConn) request(msgType uint32, payload []byte, result interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := writeSwayMessage(c.conn, msgType, payload); err != nil {
+		return fmt.Errorf("failed to send IPC message %d: %w", msgType, err)
+	}
+	replyType, reply, err := readSwayMessage(c.conn)
+	if err != nil {
+		return fmt.Errorf("failed to read IPC reply %d: %w", msgType, err)
+	}
+	if replyType != msgType {
+		return fmt.Errorf("unexpected IPC reply type %d to %d", replyType, msgType)
+	}
+	if err := json.Unmarshal(reply, result); err != nil {
+		return fmt.Errorf("malformed IPC reply %d: %w", msgType, err)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (c *swayConn) Close() error {
+	return c.conn.Close()
+}
+
+// swayCommandResult is the reply to one command of RUN_COMMAND
+type swayCommandResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// swayNode is a node of the GET_TREE reply: root, output, workspace or container
+type swayNode struct {
+	ID               int              `json:"id"`
+	Type             string           `json:"type"`
+	Name             string           `json:"name"`
+	Num              int              `json:"num"`
+	Focused          bool             `json:"focused"`
+	Urgent           bool             `json:"urgent"`
+	Sticky           bool             `json:"sticky"`
+	FullscreenMode   int              `json:"fullscreen_mode"`
+	PID              int              `json:"pid"`
+	AppID            *string          `json:"app_id"` // sway, Wayland clients
+	Window           *int             `json:"window"` // X11 window of i3 or Xwayland clients
+	WindowType       string           `json:"window_type"`
+	WindowProperties *swayWindowProps `json:"window_properties"`
+	Rect             shared.Geometry  `json:"rect"`
+	Nodes            []*swayNode      `json:"nodes"`
+	FloatingNodes    []*swayNode      `json:"floating_nodes"`
+}
+
+// swayWindowProps holds the X11 properties of i3 and Xwayland windows
+type swayWindowProps struct {
+	Class    string `json:"class"`
+	Instance string `json:"instance"`
+	Title    string `json:"title"`
+}
+
+// isWindow checks if a node is a client window rather than a split container
+func (n *swayNode) isWindow() bool {
+	if n.Type != "con" && n.Type != "floating_con" {
+		return false
+	}
+	if len(n.Nodes) > 0 || len(n.FloatingNodes) > 0 {
+		return false
+	}
+	return n.Window != nil || n.AppID != nil || n.PID > 0
+}
+
+// children returns tiled and floating child nodes
+func (n *swayNode) children() []*swayNode {
+	return append(append([]*swayNode(nil), n.Nodes...), n.FloatingNodes...)
+}
+
+// swayEvent is the payload of window and workspace events
+type swayEvent struct {
+	Change    string    `json:"change"`
+	Container *swayNode `json:"container"`
+}
+
+// swayWorkspace is a workspace node with the output showing it
+type swayWorkspace struct {
+	node   *swayNode
+	output string
+}
+
+// parseSwayTree converts a tree into windows and desktops.
+// Workspaces become desktops ordered by number, named workspaces last.
+// Scratchpad windows are hidden and on no desktop.
+func parseSwayTree(root *swayNode) *ipcState {
+	state := newIPCState()
+
+	var workspaces []swayWorkspace
+	var scratchpad *swayNode
+	for _, output := range root.Nodes {
+		if output.Type != "output" {
+			continue
+		}
+		if !strings.HasPrefix(output.Name, "__") {
+			state.monitors = append(state.monitors, shared.Monitor{Name: output.Name, Geometry: output.Rect})
+		}
+		for _, ws := range output.Nodes {
+			switch {
+			case ws.Type != "workspace":
+			case ws.Name == scratchpadWorkspace:
+				scratchpad = ws
+			default:
+				workspaces = append(workspaces, swayWorkspace{ws, output.Name})
+			}
+		}
+	}
+	sort.SliceStable(workspaces, func(i, j int) bool {
+		ni, nj := workspaces[i].node.Num, workspaces[j].node.Num
+		if (ni < 0) != (nj < 0) {
+			return ni >= 0
+		}
+		return ni < nj
+	})
+
+	for desktop, ws := range workspaces {
+		state.workspaces = append(state.workspaces, ws.node.Name)
+		if ws.node.Focused {
+			state.current = desktop
+		}
+		if collectSwayWindows(state, ws.node, desktop, ws.output) {
+			state.current = desktop
+		}
+	}
+	if scratchpad != nil {
+		collectSwayWindows(state, scratchpad, -1, "")
+	}
+	return state
+}
+
+// collectSwayWindows adds the windows below a node.
+// Returns true if the focused window is among them.
+func collectSwayWindows(s *ipcState, node *swayNode, desktop int, output string) bool {
+	focused := false
+	for _, child := range node.children() {
+		if !child.isWindow() {
+			focused = collectSwayWindows(s, child, desktop, output) || focused
+			continue
+		}
+		w := convertSwayNode(child, desktop, output)
+		if child.Focused {
+			s.activeID = child.ID
+			focused = true
+		}
+		s.add(w)
+	}
+	return focused
+}
+
+// convertSwayNode converts a window node to a shared.Window
+func convertSwayNode(node *swayNode, desktop int, output string) *shared.Window {
+	w := &shared.Window{
+		ID:       node.ID,
+		Title:    node.Name,
+		Type:     "Normal",
+		Desktop:  desktop,
+		PID:      node.PID,
+		Geometry: node.Rect,
+		Monitor:  output,
+	}
+	if node.AppID != nil {
+		w.ClassName = *node.AppID
+		w.Instance = *node.AppID
+	}
+	if props := node.WindowProperties; props != nil {
+		w.ClassName = props.Class
+		w.Instance = props.Instance
+	}
+	switch node.WindowType {
+	case "", "normal", "unknown":
+	default:
+		w.Type = "Special"
+	}
+
+	if node.Sticky {
+		w.State |= shared.StateSticky
+	}
+	if node.FullscreenMode > 0 {
+		w.State |= shared.StateFullscreen
+	}
+	if node.Urgent {
+		w.State |= shared.StateDemandsAttention
+	}
+	if desktop < 0 {
+		w.State |= shared.StateHidden
+	}
+	return w
+}
+
+// swayQuote quotes a command argument such as a workspace name
+func swayQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
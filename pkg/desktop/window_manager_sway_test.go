@@ -0,0 +1,305 @@
+package desktop
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gofi/pkg/shared"
+)
+
+// fakeSwayServer stands in for the IPC socket of sway. It answers GET_TREE
+// with a recorded tree, acknowledges commands and replays events to
+// subscribed connections.
+type fakeSwayServer struct {
+	path        string
+	listener    net.Listener
+	tree        []byte
+	commands    []string
+	subscribers []net.Conn
+	mutex       sync.Mutex
+}
+
+// newFakeSwayServer serves the recorded tree from testdata until the test ends
+func newFakeSwayServer(t *testing.T, treeFile string) *fakeSwayServer {
+	tree, err := os.ReadFile(filepath.Join("testdata", treeFile))
+	if err != nil {
+		t.Fatalf("Failed to read recorded tree: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "sway.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", path, err)
+	}
+	server := &fakeSwayServer{path: path, listener: listener, tree: tree}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// serve answers the requests of one connection
+func (s *fakeSwayServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msgType, payload, err := readSwayMessage(conn)
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		var reply []byte
+		switch msgType {
+		case swayGetTree:
+			reply = s.tree
+		case swayRunCommand:
+			s.commands = append(s.commands, string(payload))
+			reply = []byte(`[{"success":true}]`)
+		case swaySubscribe:
+			s.subscribers = append(s.subscribers, conn)
+			reply = []byte(`{"success":true}`)
+		default:
+			reply = []byte(`{"success":false,"error":"unsupported"}`)
+		}
+		writeSwayMessage(conn, msgType, reply)
+		s.mutex.Unlock()
+	}
+}
+
+// setTree replaces the tree returned from now on
+func (s *fakeSwayServer) setTree(tree []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tree = tree
+}
+
+// emit sends an event to all subscribers
+func (s *fakeSwayServer) emit(msgType uint32, payload string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.subscribers {
+		writeSwayMessage(conn, msgType, []byte(payload))
+	}
+}
+
+// takeCommands returns and forgets the received commands
+func (s *fakeSwayServer) takeCommands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	commands := s.commands
+	s.commands = nil
+	return commands
+}
+
+func setupSwayTest(t *testing.T) (*SwayWindowManager, *fakeSwayServer) {
+	server := newFakeSwayServer(t, "sway_tree.json")
+	wm, err := NewSwayWindowManager(server.path)
+	if err != nil {
+		t.Fatalf("Failed to connect to fake sway: %v", err)
+	}
+	t.Cleanup(wm.Cleanup)
+	return wm, server
+}
+
+func TestSwayWindowList(t *testing.T) {
+	wm, _ := setupSwayTest(t)
+
+	windows := wm.StackingList()
+	want := []struct {
+		id        int
+		class     string
+		instance  string
+		typeStr   string
+		desktop   int
+		monitor   string
+		pid       int
+		wantState []string
+	}{
+		{4, "foot", "foot", "Normal", 0, "eDP-1", 1004, nil},
+		{5, "firefox", "Navigator", "Normal", 0, "eDP-1", 1005, []string{"fullscreen"}},
+		{9, "pavucontrol", "pavucontrol", "Normal", 1, "HDMI-A-1", 1009, []string{"sticky"}},
+		{10, "firefox", "Navigator", "Special", 1, "HDMI-A-1", 1005, nil},
+		{7, "thunderbird", "thunderbird", "Normal", 2, "eDP-1", 1007, []string{"demands_attention"}},
+		{12, "org.keepassxc.KeePassXC", "org.keepassxc.KeePassXC", "Normal", -1, "", 1012, []string{"hidden"}},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("Expected %d windows, got %d: %v", len(want), len(windows), windows)
+	}
+	for i, w := range want {
+		got := windows[i]
+		if got.ID != w.id || got.ClassName != w.class || got.Instance != w.instance || got.Type != w.typeStr ||
+			got.Desktop != w.desktop || got.Monitor != w.monitor || got.PID != w.pid {
+			t.Errorf("Window %d: got %+v", i, got)
+		}
+		if names := got.State.Names(); strings.Join(names, ",") != strings.Join(w.wantState, ",") {
+			t.Errorf("Window %d: got state %v, want %v", got.ID, names, w.wantState)
+		}
+	}
+
+	if id := wm.ActiveWindowID(); id != 4 {
+		t.Errorf("Active window: got %d, want 4", id)
+	}
+	if names := wm.DesktopNames(); strings.Join(names, ",") != "1,2,mail" {
+		t.Errorf("Desktop names: got %q", names)
+	}
+	if current := wm.CurrentDesktop(); current != 0 {
+		t.Errorf("Current desktop: got %d, want 0", current)
+	}
+	if monitors := wm.Monitors(); len(monitors) != 2 || monitors[1].Name != "HDMI-A-1" || monitors[1].Geometry.X != 1920 {
+		t.Errorf("Unexpected monitors: %+v", monitors)
+	}
+	if title := wm.WindowTitle(7); title != "Inbox - Thunderbird" {
+		t.Errorf("Title of window 7: got %q", title)
+	}
+}
+
+func TestSwayCommands(t *testing.T) {
+	wm, server := setupSwayTest(t)
+
+	if err := wm.ActivateWindow(5); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	if err := wm.CloseWindow(5); err != nil {
+		t.Fatalf("CloseWindow failed: %v", err)
+	}
+	if err := wm.MoveWindowToDesktop(4, 2); err != nil {
+		t.Fatalf("MoveWindowToDesktop failed: %v", err)
+	}
+	if err := wm.ToggleWindowState(5, shared.StateFullscreen); err != nil {
+		t.Fatalf("ToggleWindowState failed: %v", err)
+	}
+	if err := wm.MinimizeWindow(4); err != nil {
+		t.Fatalf("MinimizeWindow failed: %v", err)
+	}
+	if err := wm.SwitchDesktop(1); err != nil {
+		t.Fatalf("SwitchDesktop failed: %v", err)
+	}
+
+	want := []string{
+		"[con_id=5] focus",
+		"[con_id=5] kill",
+		`[con_id=4] move container to workspace "mail"`,
+		"[con_id=5] fullscreen disable",
+		"[con_id=4] move scratchpad",
+		`workspace "2"`,
+	}
+	commands := server.takeCommands()
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected commands:\n GOT: %q\nWANT: %q", commands, want)
+	}
+
+	if err := wm.SwitchDesktop(3); err == nil {
+		t.Error("Expected error switching to unknown desktop")
+	}
+	if err := wm.SetWindowState(4, shared.StateMaximized, true); err == nil {
+		t.Error("Expected error for unsupported state")
+	}
+	if commands := server.takeCommands(); len(commands) != 0 {
+		t.Errorf("Expected no commands for rejected requests, got %q", commands)
+	}
+}
+
+func TestSwayKillWindow(t *testing.T) {
+	wm, server := setupSwayTest(t)
+
+	// Windows 5 and 10 belong to process 1005, the kill command closes
+	// only window 5. The next tree no longer lists it.
+	if w := wm.WindowInfo(5); w == nil || w.PID != 1005 {
+		t.Fatalf("Unexpected window 5: %+v", w)
+	}
+	server.setTree([]byte(strings.Replace(string(server.tree), `"id": 5,`, `"id": 55,`, 1)))
+	if err := wm.KillWindow(5); err != nil {
+		t.Fatalf("KillWindow failed: %v", err)
+	}
+	if commands := server.takeCommands(); len(commands) != 1 || commands[0] != "[con_id=5] kill" {
+		t.Errorf("Unexpected commands: %q", commands)
+	}
+
+	// A window surviving the kill command takes its process down
+	process := exec.Command("sleep", "60")
+	if err := process.Start(); err != nil {
+		t.Skipf("Cannot start a process to kill: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		process.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() { process.Process.Kill() })
+
+	server.setTree([]byte(strings.Replace(string(server.tree), `"pid": 1004,`, fmt.Sprintf(`"pid": %d,`, process.Process.Pid), 1)))
+	wm.cache.invalidate()
+	if err := wm.KillWindow(4); err != nil {
+		t.Fatalf("KillWindow failed: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Error("The process of window 4 was not killed")
+	}
+	if commands := server.takeCommands(); len(commands) != 1 || commands[0] != "[con_id=4] kill" {
+		t.Errorf("Unexpected commands: %q", commands)
+	}
+}
+
+func TestSwayEvents(t *testing.T) {
+	wm, server := setupSwayTest(t)
+	if !wm.InitEvents() {
+		t.Fatal("Failed to initialize events")
+	}
+	if title := wm.WindowTitle(4); title != "~" {
+		t.Fatalf("Title of window 4: got %q", title)
+	}
+
+	server.setTree([]byte(strings.Replace(string(server.tree), `"name": "~"`, `"name": "vim"`, 1)))
+	server.emit(swayEventWindow, `{"change":"title","container":{"id":4,"type":"con","name":"vim"}}`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	event := wm.AwaitEvent(ctx)
+	if event.Kind != EventProperty || event.Atom != "_NET_WM_NAME" || event.WindowID != 4 {
+		t.Fatalf("Unexpected event: %s", event)
+	}
+	if title := wm.WindowTitle(4); title != "vim" {
+		t.Errorf("Expected the tree to be fetched again, got title %q", title)
+	}
+
+	server.emit(swayEventWorkspace, `{"change":"focus","current":{"id":30,"type":"workspace","name":"2"}}`)
+	if event := wm.AwaitEvent(ctx); event.Kind != EventProperty || event.Atom != "_NET_CURRENT_DESKTOP" {
+		t.Errorf("Expected a current desktop change, got %s", event)
+	}
+
+	server.emit(swayEventWorkspace, `{"change":"init","current":{"id":40,"type":"workspace","name":"3"}}`)
+	if event := wm.AwaitEvent(ctx); event.Kind != EventOverflow {
+		t.Errorf("Expected a full rescan after a new workspace, got %s", event)
+	}
+
+	server.emit(swayEventShutdown, `{"change":"exit"}`)
+	if event := wm.AwaitEvent(ctx); event.Kind != EventNone || ctx.Err() != nil {
+		t.Errorf("Expected no event after shutdown, got %s", event)
+	}
+}
+
+func TestNewSwayWindowManagerWithoutSocket(t *testing.T) {
+	if _, err := NewSwayWindowManager(""); err == nil {
+		t.Error("Expected error without a socket path")
+	}
+	if _, err := NewSwayWindowManager(filepath.Join(t.TempDir(), "missing.sock")); err == nil {
+		t.Error("Expected error for a missing socket")
+	}
+}
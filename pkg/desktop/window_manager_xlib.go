@@ -5,11 +5,12 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
-	"io"
+	"os"
 	"strings"
 	"sync"
 
 	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
 	"github.com/BurntSushi/xgb/xproto"
 
 	"gofi/pkg/log"
@@ -19,17 +20,56 @@ import (
 // XLibWindowManager provides X11 window management adhering to clean code principles.
 type XLibWindowManager struct {
 	display *xgb.Conn
+	// Held by every call using display, closed by Cleanup
+	guard connGuard
 	// Cache atoms for efficiency
 	atomCache map[string]xproto.Atom
 	atomMutex sync.RWMutex
+	// Separate connection used only to obtain server timestamps
+	timeConn   *xgb.Conn
+	timeWindow xproto.Window
+	timeMutex  sync.Mutex
+	// Client windows selected for property change events
+	watched     map[xproto.Window]bool
+	pingable    map[xproto.Window]bool // Whether watched windows support _NET_WM_PING
+	watchEvents bool
+	watchMutex  sync.Mutex
+	// Reads all events of display, see AwaitEvent
+	pump *eventPump
+	// RandR is initialized on first use of Monitors
+	randrOnce sync.Once
+	randrErr  error
+	// Monitors as of the last RandR query, until RandR reports a change
+	monitors      []shared.Monitor
+	monitorsValid bool
+	monitorMutex  sync.Mutex
+	// Capabilities of the running window manager, nil until detected
+	caps      *Capabilities
+	capsMutex sync.Mutex
 }
 
-var (
-	// Singleton instance
-	instance *XLibWindowManager
-	// Mutex for singleton
-	mutex sync.Mutex
-)
+func init() {
+	RegisterBackend(Backend{
+		Name:     "x11",
+		Priority: 10,
+		Probe: func() error {
+			if os.Getenv("DISPLAY") == "" {
+				return fmt.Errorf("DISPLAY is not set")
+			}
+			return nil
+		},
+		Open: func() (WindowManager, error) {
+			if os.Getenv("WAYLAND_DISPLAY") != "" {
+				log.Warn("Running on Wayland through Xwayland, only X11 windows are listed")
+			}
+			wm, err := NewXLibWindowManager()
+			if err != nil {
+				return nil, err
+			}
+			return wm, nil
+		},
+	})
+}
 
 // NewXLibWindowManagerClean establishes a connection to the X server and creates a new manager.
 // Returns a new manager instance or an error if the connection fails.
@@ -41,31 +81,18 @@ func NewXLibWindowManager() (*XLibWindowManager, error) {
 	return &XLibWindowManager{
 		display:   display,
 		atomCache: make(map[string]xproto.Atom),
+		pump:      startEventPump(display),
 	}, nil
 }
 
-// Instance returns the singleton instance of the window manager
-// Returns:
-//
-//	*XLibWindowManager: The singleton instance
-func Instance() *XLibWindowManager {
-	mutex.Lock()
-	defer mutex.Unlock()
-	if instance == nil {
-		var err error
-		instance, err = NewXLibWindowManager()
-		if err != nil {
-			log.Error("Failed to create window manager: %v", err)
-			return nil
-		}
-	}
-	return instance
-}
-
 // InitEvents subscribes to necessary X server events on the root window.
 // It requests notifications for property changes and substructure modifications.
 // Returns true on success, false on failure.
 func (wm *XLibWindowManager) InitEvents() bool {
+	if !wm.guard.acquire() {
+		return false
+	}
+	defer wm.guard.release()
 	root := xproto.Setup(wm.display).DefaultScreen(wm.display).Root
 	mask := xproto.EventMaskPropertyChange | xproto.EventMaskSubstructureNotify
 	cookie := xproto.ChangeWindowAttributesChecked(wm.display, root, xproto.CwEventMask, []uint32{uint32(mask)})
@@ -75,103 +102,107 @@ func (wm *XLibWindowManager) InitEvents() bool {
 		return false
 	}
 	log.Debug("Successfully set event mask on root window")
+	wm.selectMonitorEvents(root)
+
+	wm.watchMutex.Lock()
+	wm.watchEvents = true
+	wm.watched = make(map[xproto.Window]bool)
+	wm.pingable = make(map[xproto.Window]bool)
+	wm.watchMutex.Unlock()
 	return true
 }
 
-// AwaitEvent waits for the next relevant X event or context cancellation.
-// It returns a string identifier for the event type (e.g., "MapNotify", "PropertyNotify:_NET_ACTIVE_WINDOW")
-// or an empty string if the context is cancelled or an error occurs.
-func (wm *XLibWindowManager) AwaitEvent(ctx context.Context) string {
-	eventChan := make(chan interface{}, 1)
-	go wm.waitForXEvent(eventChan) // Use method receiver
+// AwaitEvent waits for the next X event or context cancellation.
+// Events are read by a single pump goroutine, see pumpEvents, so a cancelled
+// call leaves the connection usable for requests and later calls.
+// It returns the event converted to an Event, an EventOverflow event if
+// events were dropped, or an Event of kind EventNone if the context is
+// cancelled or the connection is closed.
+func (wm *XLibWindowManager) AwaitEvent(ctx context.Context) Event {
+	if ctx.Err() != nil {
+		return Event{}
+	}
+	if dropped := wm.pump.takeDropped(); dropped > 0 {
+		log.Warn("Dropped %d X events, the event queue was full", dropped)
+		return Event{Kind: EventOverflow}
+	}
 
 	select {
-	case result := <-eventChan:
+	case result, ok := <-wm.pump.events:
+		if !ok {
+			log.Debug("X server connection closed")
+			wm.guard.lost()
+			return Event{}
+		}
+		if !wm.guard.acquire() {
+			return Event{}
+		}
+		defer wm.guard.release()
 		return wm.processXEventResult(result)
 	case <-ctx.Done():
-		return wm.handleAwaitCancellation(ctx)
+		log.Debug("AwaitEvent aborted by context: %v", ctx.Err())
+		return Event{}
 	}
 }
 
-// waitForXEvent listens for the next event from the X server.
-// It sends the event or an error through the provided channel.
-func (wm *XLibWindowManager) waitForXEvent(eventChan chan<- interface{}) {
-	event, err := wm.display.WaitForEvent()
-	if err != nil {
-		eventChan <- err // Send error (including potential EOF)
-		return
-	}
-	if event != nil {
-		eventChan <- event // Send valid event
-	}
-	// If event is nil but err is nil, it's an unusual case, maybe ignore?
-	// For now, sending nothing effectively stalls the receiver, which might be okay
-	// if it only happens on graceful shutdown scenarios not producing EOF.
-}
-
-// processXEventResult analyzes the result from waitForXEvent.
-// It returns the corresponding event string identifier or an empty string on error/EOF.
-func (wm *XLibWindowManager) processXEventResult(result interface{}) string {
+// processXEventResult converts an event or X error delivered by the pump.
+func (wm *XLibWindowManager) processXEventResult(result interface{}) Event {
 	switch event := result.(type) {
-	case error:
-		if event != io.EOF {
-			log.Error("Error received from X server connection: %v", event)
-		} else {
-			log.Debug("EOF received from X server connection (closed cleanly)")
-		}
-		return "" // Error or clean close
+	case xgb.Error:
+		// Protocol errors of unchecked requests, e.g. for a window that just vanished
+		log.Debug("X protocol error: %v", event)
+		return Event{Kind: EventOther}
 	default:
-		return wm.formatEventString(event) // Format valid event
+		return wm.convertEvent(event) // Convert valid event
 	}
 }
 
-// formatEventString creates a structured string identifier for a given X event.
-func (wm *XLibWindowManager) formatEventString(event interface{}) string {
-	var eventName string
+// convertEvent converts an X event to an Event.
+// xgb delivers events as values, not pointers.
+func (wm *XLibWindowManager) convertEvent(event interface{}) Event {
+	if converted, ok := wm.convertFallbackEvent(event); ok {
+		return converted
+	}
 	switch ev := event.(type) {
-	case *xproto.PropertyNotifyEvent:
-		atomName := wm.getAtomNameCached(ev.Atom) // Use cached atom name lookup
-		if atomName == "_NET_ACTIVE_WINDOW" {
-			eventName = "PropertyNotify:_NET_ACTIVE_WINDOW"
-		} else if atomName != "" {
-			eventName = fmt.Sprintf("PropertyNotify:%s", atomName) // More specific
-		} else {
-			eventName = "PropertyNotify:Other" // Fallback
+	case xproto.PropertyNotifyEvent:
+		atom := wm.getAtomNameCached(ev.Atom)
+		if atom == "_NET_SUPPORTING_WM_CHECK" || atom == "_NET_SUPPORTED" {
+			// The window manager was replaced or changed its features
+			wm.invalidateCapabilities()
 		}
+		return Event{Kind: EventProperty, WindowID: int(ev.Window), Atom: atom}
+	case xproto.CreateNotifyEvent:
+		return Event{Kind: EventCreate, WindowID: int(ev.Window)}
+	case xproto.DestroyNotifyEvent:
+		return Event{Kind: EventDestroy, WindowID: int(ev.Window)}
+	case xproto.MapNotifyEvent:
+		return Event{Kind: EventMap, WindowID: int(ev.Window)}
+	case xproto.UnmapNotifyEvent:
+		return Event{Kind: EventUnmap, WindowID: int(ev.Window)}
+	case xproto.ConfigureNotifyEvent:
+		return Event{Kind: EventConfigure, WindowID: int(ev.Window)}
+	case xproto.ClientMessageEvent:
+		return wm.convertClientMessage(ev)
+	case randr.ScreenChangeNotifyEvent, randr.NotifyEvent:
+		return wm.convertMonitorChange()
 	default:
-		eventName = wm.getSimplifiedTypeName(ev) // Generic fallback
+		log.Debug("Received other X event: %T", ev)
+		return Event{Kind: EventOther}
 	}
-	// log.Debug("Formatted X event: %s", eventName) // Optional: Debug log here
-	return eventName
-}
-
-// getSimplifiedTypeName extracts the base type name from a potentially prefixed type.
-func (wm *XLibWindowManager) getSimplifiedTypeName(v interface{}) string {
-	typeName := fmt.Sprintf("%T", v)
-	if parts := strings.Split(typeName, "."); len(parts) > 1 {
-		return parts[len(parts)-1] // Strip package prefix
-	}
-	return typeName
-}
-
-// handleAwaitCancellation handles the cancellation of AwaitEvent via context.
-// It logs the cancellation and attempts to close the display connection.
-// Returns an empty string.
-func (wm *XLibWindowManager) handleAwaitCancellation(ctx context.Context) string {
-	log.Debug("AwaitEvent aborted by context: %v", ctx.Err())
-	// Closing the display connection is crucial to unblock waitForXEvent.
-	// Assuming this manager instance owns the connection.
-	if wm.display != nil {
-		wm.display.Close()
-		wm.display = nil // Prevent double close
-	}
-	return ""
 }
 
 // ActiveWindowID queries the X server for the ID of the currently active window.
-// It uses the _NET_ACTIVE_WINDOW property on the root window.
+// It uses the _NET_ACTIVE_WINDOW property on the root window, or the input
+// focus if the window manager does not support it.
 // Returns the window ID, or 0 if none is found or an error occurs.
 func (wm *XLibWindowManager) ActiveWindowID() int {
+	if !wm.guard.acquire() {
+		return 0
+	}
+	defer wm.guard.release()
+	if wm.fallbackFocus() {
+		return wm.focusedClient()
+	}
 	root := wm.getRootWindow()
 	if root == 0 {
 		return 0
@@ -209,81 +240,170 @@ func (wm *XLibWindowManager) ActiveWindowID() int {
 // It uses the _NET_CLIENT_LIST property on the root window.
 // Returns a slice of Window pointers, or nil on error.
 func (wm *XLibWindowManager) StackingList() []*shared.Window {
+	if !wm.guard.acquire() {
+		return nil
+	}
+	defer wm.guard.release()
+	clients := wm.ClientIDs()
+	if clients == nil {
+		return nil
+	}
+
+	windows := wm.collectWindows(clients)
+	monitors := wm.Monitors()
+	listed := make([]xproto.Window, 0, len(windows))
+	for _, windowInfo := range windows {
+		windowInfo.Monitor = shared.MonitorFor(windowInfo.Geometry, monitors)
+		listed = append(listed, xproto.Window(windowInfo.ID))
+	}
+	wm.watchWindows(listed)
+	return windows
+}
+
+// ClientIDs reads the IDs of all client windows from _NET_CLIENT_LIST.
+// A single round trip, unlike StackingList. Windows no longer listed stop
+// being watched. Without _NET_CLIENT_LIST the window tree is walked instead.
+// Returns the IDs in client list order, or stacking order for the window
+// tree, or nil on error.
+func (wm *XLibWindowManager) ClientIDs() []int {
+	if !wm.guard.acquire() {
+		return nil
+	}
+	defer wm.guard.release()
+	var clients []int
+	if wm.fallbackClients() {
+		clients = wm.discoverClients()
+	} else {
+		clients = wm.getWindowListProperty("_NET_CLIENT_LIST")
+	}
+	if clients != nil {
+		wm.forgetUnlisted(clients)
+	}
+	return clients
+}
+
+// StackingOrder reads the client windows from _NET_CLIENT_LIST_STACKING.
+// Without a client list the window tree gives the order instead.
+// Returns the IDs from bottom to top, empty if the window manager does not
+// maintain the property.
+func (wm *XLibWindowManager) StackingOrder() []int {
+	if !wm.guard.acquire() {
+		return nil
+	}
+	defer wm.guard.release()
+	if wm.fallbackClients() {
+		return wm.discoverClients()
+	}
+	if !wm.Capabilities().Has("_NET_CLIENT_LIST_STACKING") {
+		return nil
+	}
+	return wm.getWindowListProperty("_NET_CLIENT_LIST_STACKING")
+}
+
+// getWindowListProperty reads a list of window IDs from a root window property.
+// Returns nil if the property is missing or cannot be read.
+func (wm *XLibWindowManager) getWindowListProperty(name string) []int {
 	root := wm.getRootWindow()
 	if root == 0 {
 		return nil
 	}
 
-	clientListAtom := wm.getAtomCached("_NET_CLIENT_LIST")
-	if clientListAtom == 0 {
+	listAtom := wm.getAtomCached(name)
+	if listAtom == 0 {
 		return nil
 	}
 
-	prop, err := xproto.GetProperty(
-		wm.display, false, root, clientListAtom,
-		xproto.AtomWindow, 0, 1024, // Request up to 1024 window IDs
-	).Reply()
-
+	// Read 1024 window IDs at a time, more are followed up
+	value, err := wm.getPropertyAll(root, listAtom, xproto.AtomWindow, 1024)
 	if err != nil {
-		log.Error("Failed to get _NET_CLIENT_LIST property: %v", err)
+		log.Error("Failed to get %s property: %v", name, err)
 		return nil
 	}
 
-	// Reply.Value contains a list of 32-bit (4-byte) window IDs
-	numWindows := int(prop.ValueLen)
-	windows := make([]*shared.Window, 0, numWindows)
-	valueBytes := prop.Value
-
-	for i := 0; i < numWindows; i++ {
-		start := i * 4
-		if start+4 > len(valueBytes) {
-			log.Warn("Insufficient data in _NET_CLIENT_LIST reply")
-			break // Avoid panic
-		}
-		windowID := xproto.Window(binary.LittleEndian.Uint32(valueBytes[start : start+4]))
-		if windowID == 0 {
+	// The value is a list of 32-bit (4-byte) window IDs
+	values := bytesToUint32s(value)
+	windows := make([]int, 0, len(values))
+	for _, value := range values {
+		if value == 0 {
 			continue // Skip null window IDs
 		}
-
-		windowInfo := wm.createWindowInfo(windowID)
-		if windowInfo != nil {
-			windows = append(windows, windowInfo)
-		}
+		windows = append(windows, int(value))
 	}
 	return windows
 }
 
-// createWindowInfo gathers details (ID, Title, Type, Class) for a given window ID.
-// Returns a Window struct pointer, or nil if essential info is missing or window is invalid.
-func (wm *XLibWindowManager) createWindowInfo(windowID xproto.Window) *shared.Window {
-	if !wm.isValidWindow(windowID) {
-		// log.Debug("Skipping invalid window ID %d during info creation", windowID)
+// WindowInfo gathers all details of a single client window and watches it
+// for property changes.
+// Returns the window, or nil if it is invalid.
+func (wm *XLibWindowManager) WindowInfo(windowID int) *shared.Window {
+	if !wm.guard.acquire() {
+		return nil
+	}
+	defer wm.guard.release()
+	window := xproto.Window(windowID)
+	windowInfo := wm.createWindowInfo(window)
+	if windowInfo == nil {
 		return nil
 	}
+	windowInfo.Monitor = shared.MonitorFor(windowInfo.Geometry, wm.Monitors())
+	wm.watchWindows([]xproto.Window{window})
+	return windowInfo
+}
 
-	title := wm.getWindowName(windowID)
-	// We might decide later that windows without titles are not interesting
-	// if title == "" {
-	// 	log.Debug("Window %d has no usable title, skipping", windowID)
-	// 	return nil
-	// }
+// watchWindows selects property and structure events on client windows, so
+// title, state and geometry changes are reported by AwaitEvent.
+// Does nothing before InitEvents. Windows already watched are skipped, the
+// requests for the others are pipelined.
+func (wm *XLibWindowManager) watchWindows(windows []xproto.Window) {
+	wm.watchMutex.Lock()
+	defer wm.watchMutex.Unlock()
+	if !wm.watchEvents {
+		return
+	}
 
-	windowType := wm.getWindowType(windowID)
-	instance, class := wm.getWindowClass(windowID)
-	desktop := wm.getWindowDesktop(windowID) // Get desktop number
-	pid := wm.getWindowPID(windowID)         // Get process ID
+	mask := []uint32{xproto.EventMaskPropertyChange | xproto.EventMaskStructureNotify}
+	if wm.fallbackFocus() {
+		mask[0] |= xproto.EventMaskFocusChange
+	}
+	cookies := make(map[xproto.Window]xproto.ChangeWindowAttributesCookie)
+	for _, window := range windows {
+		if !wm.watched[window] {
+			cookies[window] = xproto.ChangeWindowAttributesChecked(wm.display, window, xproto.CwEventMask, mask)
+		}
+	}
+	for window, cookie := range cookies {
+		if err := cookie.Check(); err != nil {
+			log.Debug("Failed to watch window %d: %v", window, err)
+			continue
+		}
+		wm.watched[window] = true
+	}
+}
+
+// forgetUnlisted drops windows that are no longer client windows from the watched set
+func (wm *XLibWindowManager) forgetUnlisted(clients []int) {
+	wm.watchMutex.Lock()
+	defer wm.watchMutex.Unlock()
 
-	return &shared.Window{
-		ID:        int(windowID),
-		Title:     title,
-		Type:      windowType, // "Normal" or "Special" (or others based on EWMH)
-		Instance:  instance,
-		ClassName: class,
-		Desktop:   desktop, // Assign the fetched desktop number
-		PID:       pid,     // Assign the fetched process ID
+	listed := make(map[xproto.Window]bool, len(clients))
+	for _, id := range clients {
+		listed[xproto.Window(id)] = true
+	}
+	for window := range wm.watched {
+		if !listed[window] {
+			delete(wm.watched, window)
+			delete(wm.pingable, window)
+		}
 	}
 }
 
+// createWindowInfo gathers details (ID, Title, Type, Class) for a given window ID.
+// All requests are sent before the first reply is awaited, see requestWindow.
+// Returns a Window struct pointer, or nil if essential info is missing or window is invalid.
+func (wm *XLibWindowManager) createWindowInfo(windowID xproto.Window) *shared.Window {
+	return wm.collectWindow(wm.requestWindow(windowID))
+}
+
 // getWindowName attempts to retrieve the window title (_NET_WM_NAME or WM_NAME).
 // Returns the title string or an empty string if not found or invalid UTF-8.
 func (wm *XLibWindowManager) getWindowName(windowID xproto.Window) string {
@@ -312,25 +432,16 @@ func (wm *XLibWindowManager) getWindowName(windowID xproto.Window) string {
 	return ""
 }
 
-// getWindowType determines if a window is "Normal" or "Special" based on _NET_WM_WINDOW_TYPE.
+// windowTypeFromReply determines if a window is "Normal" or "Special" based on
+// its _NET_WM_WINDOW_TYPE reply.
 // Returns "Normal" or "Special". Defaults to "Normal" if type property is absent.
-func (wm *XLibWindowManager) getWindowType(windowID xproto.Window) string {
-	typeAtom := wm.getAtomCached("_NET_WM_WINDOW_TYPE")
+func (wm *XLibWindowManager) windowTypeFromReply(windowID xproto.Window, prop *xproto.GetPropertyReply) string {
 	normalAtom := wm.getAtomCached("_NET_WM_WINDOW_TYPE_NORMAL")
 
 	// Default to Normal if property is missing
 	propTypeDefault := "Normal"
 
-	if typeAtom == 0 {
-		return propTypeDefault // Cannot check type atom
-	}
-
-	prop, err := xproto.GetProperty(
-		wm.display, false, windowID, typeAtom,
-		xproto.AtomAtom, 0, 64, // Request multiple atoms (usually just one or a few)
-	).Reply()
-
-	if err != nil || prop == nil || prop.Format != 32 || prop.ValueLen == 0 {
+	if prop == nil || prop.Format != 32 || prop.ValueLen == 0 {
 		// Error, or property not set, or wrong format
 		return propTypeDefault
 	}
@@ -371,6 +482,12 @@ func (wm *XLibWindowManager) getWindowType(windowID xproto.Window) string {
 func (wm *XLibWindowManager) getWindowClass(windowID xproto.Window) (string, string) {
 	// WM_CLASS is type STRING, contains two null-terminated strings.
 	classBytes := wm.getWindowPropertyBytes(windowID, "WM_CLASS", xproto.AtomString)
+	return splitWindowClass(windowID, classBytes)
+}
+
+// splitWindowClass splits a WM_CLASS value into instance and class.
+// Both are empty if the value is missing.
+func splitWindowClass(windowID xproto.Window, classBytes []byte) (string, string) {
 	if classBytes == nil {
 		return "", ""
 	}
@@ -531,6 +648,12 @@ func (wm *XLibWindowManager) getWindowDesktop(windowID xproto.Window) int {
 
 	// Property type is CARDINAL (32-bit unsigned integer)
 	propBytes := wm.getWindowPropertyBytes(windowID, "_NET_WM_DESKTOP", xproto.AtomCardinal)
+	return desktopFromBytes(propBytes)
+}
+
+// desktopFromBytes decodes a _NET_WM_DESKTOP value.
+// Returns the desktop number or -1 if sticky or missing.
+func desktopFromBytes(propBytes []byte) int {
 	if propBytes == nil || len(propBytes) < 4 {
 		// Property not set or invalid length
 		// Some WMs might omit it for sticky windows, though spec says use 0xFFFFFFFF
@@ -547,16 +670,9 @@ func (wm *XLibWindowManager) getWindowDesktop(windowID xproto.Window) int {
 	return int(desktopID)
 }
 
-// getWindowPID retrieves the process ID (_NET_WM_PID) for a window.
-// Returns the PID, or 0 if the property is not set or an error occurs.
-func (wm *XLibWindowManager) getWindowPID(windowID xproto.Window) int {
-	pidAtom := wm.getAtomCached("_NET_WM_PID")
-	if pidAtom == 0 {
-		return 0 // Cannot determine PID without atom
-	}
-
-	// Property type is CARDINAL (32-bit unsigned integer)
-	propBytes := wm.getWindowPropertyBytes(windowID, "_NET_WM_PID", xproto.AtomCardinal)
+// pidFromBytes decodes a _NET_WM_PID value.
+// Returns the PID or 0 if missing.
+func pidFromBytes(propBytes []byte) int {
 	if propBytes == nil || len(propBytes) < 4 {
 		// Property not set or invalid length
 		return 0
@@ -571,101 +687,63 @@ func (wm *XLibWindowManager) getWindowPID(windowID xproto.Window) int {
 // WindowTitle gets the title of a window by ID.
 // Delegates to the internal getWindowName helper.
 func (wm *XLibWindowManager) WindowTitle(windowID int) string {
+	if !wm.guard.acquire() {
+		return ""
+	}
+	defer wm.guard.release()
 	// getWindowName handles invalid IDs internally
 	return wm.getWindowName(xproto.Window(windowID))
 }
 
-// WindowClass gets the class and instance name of a window by ID.
-// Delegates to the internal getWindowClass helper.
-func (wm *XLibWindowManager) WindowClass(windowID int) (string, string) {
-	// getWindowClass handles invalid IDs internally
-	return wm.getWindowClass(xproto.Window(windowID))
+// WindowDesktop gets the desktop of a window
+// Returns the desktop index, or -1 for sticky windows or if unknown.
+func (wm *XLibWindowManager) WindowDesktop(windowID int) int {
+	if !wm.guard.acquire() {
+		return -1
+	}
+	defer wm.guard.release()
+	return wm.getWindowDesktop(xproto.Window(windowID))
 }
 
-// CloseWindow sends a _NET_CLOSE_WINDOW client message to request graceful closure.
-// Args:
-//
-//	windowID: The ID of the window to close.
-//
-// Returns:
-//
-//	error: An error if the message could not be sent.
-func (wm *XLibWindowManager) CloseWindow(windowID int) error {
-	if !wm.isValidWindow(xproto.Window(windowID)) {
-		return fmt.Errorf("cannot close invalid window ID %d", windowID)
+// WindowState gets the _NET_WM_STATE flags of a window
+func (wm *XLibWindowManager) WindowState(windowID int) shared.WindowState {
+	if !wm.guard.acquire() {
+		return 0
 	}
+	defer wm.guard.release()
+	return wm.getWindowState(xproto.Window(windowID))
+}
 
-	closeAtom := wm.getAtomCached("_NET_CLOSE_WINDOW")
-	if closeAtom == 0 {
-		return fmt.Errorf("could not get _NET_CLOSE_WINDOW atom")
+// WindowGeometry gets the frame-inclusive geometry of a window
+func (wm *XLibWindowManager) WindowGeometry(windowID int) shared.Geometry {
+	if !wm.guard.acquire() {
+		return shared.Geometry{}
 	}
+	defer wm.guard.release()
+	return wm.getWindowGeometry(xproto.Window(windowID))
+}
 
-	root := wm.getRootWindow()
-	if root == 0 {
-		return fmt.Errorf("could not get root window")
-	}
-
-	// EWMH spec for _NET_CLOSE_WINDOW:
-	// window = the respective client window
-	// message_type = _NET_CLOSE_WINDOW
-	// format = 32
-	// data.l[0] = timestamp
-	// data.l[1] = source indication (1 for normal apps)
-	// data.l[2-4] = 0
-	// We need a timestamp. Using CurrentTime is often problematic.
-	// Fetching a property might work, but let's try 0 (most WMs allow it).
-	// Source indication 1 is typical for application requests.
-
-	evData := [20]byte{} // 5 * 32-bit = 20 bytes
-	// data.l[0] - timestamp (using 0 for now)
-	binary.LittleEndian.PutUint32(evData[0:4], 0)
-	// data.l[1] - source indication
-	binary.LittleEndian.PutUint32(evData[4:8], 1)
-	// data.l[2-4] are already 0
-
-	// Convert byte data to uint32 slice for the event data union
-	dataUint32 := make([]uint32, 5)
-	for i := 0; i < 5; i++ {
-		dataUint32[i] = binary.LittleEndian.Uint32(evData[i*4 : (i+1)*4])
-	}
-
-	cm := xproto.ClientMessageEvent{
-		Format: 32,
-		Window: xproto.Window(windowID),
-		Type:   closeAtom,
-		Data:   xproto.ClientMessageDataUnionData32New(dataUint32),
-	}
-
-	// Send the event to the root window, as window managers listen there
-	// for these types of messages on behalf of client windows.
-	// Masks determine which clients receive the event. SubstructureNotify
-	// and SubstructureRedirect cover most WM scenarios.
-	cookie := xproto.SendEventChecked(
-		wm.display,
-		false, // propagate = false
-		root,  // destination = root window
-		uint32(xproto.EventMaskSubstructureRedirect|xproto.EventMaskSubstructureNotify),
-		string(cm.Bytes()),
-	)
-
-	err := cookie.Check()
-	if err != nil {
-		log.Error("Failed to send _NET_CLOSE_WINDOW event for window %d: %v", windowID, err)
-		return fmt.Errorf("failed to send close event: %w", err)
+// WindowClass gets the class and instance name of a window by ID.
+// Delegates to the internal getWindowClass helper.
+func (wm *XLibWindowManager) WindowClass(windowID int) (string, string) {
+	if !wm.guard.acquire() {
+		return "", ""
 	}
-
-	log.Debug("Sent _NET_CLOSE_WINDOW event for window %d", windowID)
-	return nil
+	defer wm.guard.release()
+	// getWindowClass handles invalid IDs internally
+	return wm.getWindowClass(xproto.Window(windowID))
 }
 
 // Cleanup closes the connection to the X server.
+// It waits for running calls, later calls return an error or zero value.
+// The display stays set, so a caller still holding the manager after a
+// reconnect never sees a nil connection.
 func (wm *XLibWindowManager) Cleanup() {
-	wm.atomMutex.Lock() // Ensure no atom operations are ongoing
-	defer wm.atomMutex.Unlock()
-
-	if wm.display != nil {
+	if wm.pump != nil && wm.pump.closed() {
+		wm.guard.lost() // xgb closed the connection itself
+	} else if wm.guard.close() {
 		log.Debug("Closing X server connection")
 		wm.display.Close()
-		wm.display = nil // Prevent further use
 	}
+	wm.closeTimestampConn()
 }
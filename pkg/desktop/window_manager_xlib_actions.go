@@ -0,0 +1,262 @@
+package desktop
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/log"
+)
+
+// EWMH source indication values for client messages
+const (
+	sourceApplication = 1 // Request coming from a normal application
+	sourcePager       = 2 // Request coming from a pager or switcher like gofi
+)
+
+// timestampAtom is changed on the timestamp window to obtain the server time
+const timestampAtom = "_GOFI_TIMESTAMP"
+
+// serverTimeTimeout bounds the wait for the PropertyNotify carrying the
+// server time, actions fall back to CurrentTime afterwards
+const serverTimeTimeout = 300 * time.Millisecond
+
+// ActivateWindow asks the window manager to activate a window.
+// Switches to the window's desktop first if it lives on another one.
+// Args:
+//
+//	windowID: The ID of the window to activate.
+//
+// Returns:
+//
+//	error: An error if the window is invalid or a message could not be sent.
+func (wm *XLibWindowManager) ActivateWindow(windowID int) error {
+	if !wm.guard.acquire() {
+		return errDisplayClosed
+	}
+	defer wm.guard.release()
+	window := xproto.Window(windowID)
+	if !wm.isValidWindow(window) {
+		return fmt.Errorf("cannot activate invalid window ID %d", windowID)
+	}
+	if wm.fallbackFocus() {
+		return wm.activateFallback(window)
+	}
+
+	timestamp := wm.serverTime()
+	if err := wm.switchToWindowDesktop(window, timestamp); err != nil {
+		return err
+	}
+
+	activeAtom := wm.getAtomCached("_NET_ACTIVE_WINDOW")
+	if activeAtom == 0 {
+		return fmt.Errorf("could not get _NET_ACTIVE_WINDOW atom")
+	}
+
+	// EWMH spec for _NET_ACTIVE_WINDOW:
+	// data.l[0] = source indication
+	// data.l[1] = timestamp
+	// data.l[2] = requestor's currently active window, 0 if none
+	current := uint32(wm.ActiveWindowID())
+	if err := wm.sendClientMessage(window, activeAtom, sourcePager, uint32(timestamp), current); err != nil {
+		return fmt.Errorf("failed to send activate event: %w", err)
+	}
+
+	log.Debug("Sent _NET_ACTIVE_WINDOW event for window %d", windowID)
+	return nil
+}
+
+// switchToWindowDesktop switches _NET_CURRENT_DESKTOP to the window's desktop
+// if it is not shown on the current one. Sticky windows never cause a switch.
+func (wm *XLibWindowManager) switchToWindowDesktop(window xproto.Window, timestamp xproto.Timestamp) error {
+	desktop := wm.getWindowDesktop(window)
+	current := wm.getCurrentDesktop()
+	if desktop < 0 || current < 0 || desktop == current || !wm.Capabilities().Has("_NET_CURRENT_DESKTOP") {
+		return nil
+	}
+
+	log.Debug("Window %d is on desktop %d, switching from %d", window, desktop, current)
+	return wm.switchDesktop(desktop, timestamp)
+}
+
+// switchDesktop sends the _NET_CURRENT_DESKTOP client message
+func (wm *XLibWindowManager) switchDesktop(desktop int, timestamp xproto.Timestamp) error {
+	currentAtom := wm.getAtomCached("_NET_CURRENT_DESKTOP")
+	if currentAtom == 0 {
+		return fmt.Errorf("could not get _NET_CURRENT_DESKTOP atom")
+	}
+
+	// EWMH spec for _NET_CURRENT_DESKTOP:
+	// data.l[0] = new desktop index
+	// data.l[1] = timestamp
+	root := wm.getRootWindow()
+	if err := wm.sendClientMessage(root, currentAtom, uint32(desktop), uint32(timestamp)); err != nil {
+		return fmt.Errorf("failed to switch to desktop %d: %w", desktop, err)
+	}
+	return nil
+}
+
+// getCurrentDesktop reads _NET_CURRENT_DESKTOP from the root window.
+// Returns the desktop index or -1 if unknown.
+func (wm *XLibWindowManager) getCurrentDesktop() int {
+	values := wm.getRootCardinals("_NET_CURRENT_DESKTOP")
+	if len(values) == 0 {
+		return -1
+	}
+	return int(values[0])
+}
+
+// getRootCardinals reads a CARDINAL list property from the root window.
+// Returns nil if the property is missing.
+func (wm *XLibWindowManager) getRootCardinals(propName string) []uint32 {
+	root := wm.getRootWindow()
+	if root == 0 {
+		return nil
+	}
+	return bytesToUint32s(wm.getWindowPropertyBytes(root, propName, xproto.AtomCardinal))
+}
+
+// sendClientMessage sends a 32-bit format client message about window to the root window.
+// Unused data fields are zero.
+func (wm *XLibWindowManager) sendClientMessage(window xproto.Window, messageType xproto.Atom, data ...uint32) error {
+	root := wm.getRootWindow()
+	if root == 0 {
+		return fmt.Errorf("could not get root window")
+	}
+
+	fields := make([]uint32, 5)
+	copy(fields, data)
+	cm := xproto.ClientMessageEvent{
+		Format: 32,
+		Window: window,
+		Type:   messageType,
+		Data:   xproto.ClientMessageDataUnionData32New(fields),
+	}
+
+	// Window managers listen on the root window for these messages on behalf
+	// of client windows. SubstructureNotify and SubstructureRedirect cover most WMs.
+	mask := uint32(xproto.EventMaskSubstructureRedirect | xproto.EventMaskSubstructureNotify)
+	return xproto.SendEventChecked(wm.display, false, root, mask, string(cm.Bytes())).Check()
+}
+
+// serverTime obtains a current X server timestamp.
+// A property is appended on a private window of a separate connection and the
+// time of the resulting PropertyNotify is used. This keeps the event stream of
+// the main connection untouched.
+// Returns the timestamp, or CurrentTime if it could not be obtained within
+// serverTimeTimeout.
+func (wm *XLibWindowManager) serverTime() xproto.Timestamp {
+	wm.timeMutex.Lock()
+	defer wm.timeMutex.Unlock()
+
+	if err := wm.openTimestampConn(); err != nil {
+		log.Warn("Falling back to CurrentTime: %v", err)
+		return xproto.TimeCurrentTime
+	}
+
+	atom := wm.getAtomCached(timestampAtom)
+	xproto.ChangeProperty(wm.timeConn, xproto.PropModeAppend, wm.timeWindow,
+		atom, xproto.AtomString, 8, 0, nil)
+
+	// A connection closed on a timeout ends the wait of the goroutine, unless
+	// the server does not answer at all
+	result := make(chan xproto.Timestamp, 1)
+	go awaitTimestamp(wm.timeConn, wm.timeWindow, result)
+	select {
+	case timestamp := <-result:
+		if timestamp == xproto.TimeCurrentTime {
+			// xgb closes the connection itself after a read error
+			wm.timeConn = nil
+			wm.timeWindow = 0
+		}
+		return timestamp
+	case <-time.After(serverTimeTimeout):
+		log.Warn("Falling back to CurrentTime: no server time within %s", serverTimeTimeout)
+		wm.closeTimestampConnLocked()
+		return xproto.TimeCurrentTime
+	}
+}
+
+// awaitTimestamp waits for the PropertyNotify of the timestamp window and
+// sends its time, or CurrentTime if the connection is closed first
+func awaitTimestamp(conn *xgb.Conn, window xproto.Window, result chan<- xproto.Timestamp) {
+	for {
+		event, err := conn.WaitForEvent()
+		if event == nil {
+			if err != nil {
+				log.Warn("Falling back to CurrentTime: %v", err)
+			}
+			result <- xproto.TimeCurrentTime
+			return
+		}
+		if notify, ok := event.(xproto.PropertyNotifyEvent); ok && notify.Window == window {
+			result <- notify.Time
+			return
+		}
+	}
+}
+
+// openTimestampConn lazily creates the timestamp connection and its window.
+// Must be called with timeMutex held.
+func (wm *XLibWindowManager) openTimestampConn() error {
+	if wm.timeConn != nil {
+		return nil
+	}
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return fmt.Errorf("failed to open timestamp connection: %w", err)
+	}
+
+	window, err := createTimestampWindow(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	wm.timeConn = conn
+	wm.timeWindow = window
+	return nil
+}
+
+// createTimestampWindow creates an unmapped input-only window listening for property changes
+func createTimestampWindow(conn *xgb.Conn) (xproto.Window, error) {
+	window, err := xproto.NewWindowId(conn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate timestamp window: %w", err)
+	}
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	err = xproto.CreateWindowChecked(conn, 0, window, screen.Root,
+		-1, -1, 1, 1, 0, xproto.WindowClassInputOnly, screen.RootVisual,
+		xproto.CwEventMask, []uint32{xproto.EventMaskPropertyChange}).Check()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create timestamp window: %w", err)
+	}
+	return window, nil
+}
+
+// closeTimestampConn closes the timestamp connection if open
+func (wm *XLibWindowManager) closeTimestampConn() {
+	wm.timeMutex.Lock()
+	defer wm.timeMutex.Unlock()
+	wm.closeTimestampConnLocked()
+}
+
+// closeTimestampConnLocked closes the timestamp connection, timeMutex must be held
+func (wm *XLibWindowManager) closeTimestampConnLocked() {
+	if wm.timeConn != nil {
+		wm.timeConn.Close()
+		wm.timeConn = nil
+		wm.timeWindow = 0
+	}
+}
+
+// bytesToUint32s decodes a little endian 32-bit property value
+func bytesToUint32s(data []byte) []uint32 {
+	values := make([]uint32, 0, len(data)/4)
+	for i := 0; i+4 <= len(data); i += 4 {
+		values = append(values, binary.LittleEndian.Uint32(data[i:i+4]))
+	}
+	return values
+}
@@ -0,0 +1,160 @@
+package desktop
+
+import (
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/shared"
+)
+
+// batchSize limits the windows with requests in flight at once.
+// xgb forces a round trip when its queue of 1000 cookies fills up.
+const batchSize = 64
+
+// propertyLength is the length in 32-bit units requested for window properties
+const propertyLength = 1024 * 1024 / 4
+
+// windowRequests holds the cookies of all requests describing one window.
+// Sending every request before awaiting the first reply costs one round trip
+// per batch instead of one per property.
+type windowRequests struct {
+	window     xproto.Window
+	attributes xproto.GetWindowAttributesCookie
+	netName    xproto.GetPropertyCookie
+	name       xproto.GetPropertyCookie
+	windowType xproto.GetPropertyCookie
+	class      xproto.GetPropertyCookie
+	desktop    xproto.GetPropertyCookie
+	pid        xproto.GetPropertyCookie
+	machine    xproto.GetPropertyCookie
+	state      xproto.GetPropertyCookie
+	extents    xproto.GetPropertyCookie
+	geometry   xproto.GetGeometryCookie
+	position   xproto.TranslateCoordinatesCookie
+}
+
+// requestWindow sends all requests describing a window without waiting for replies
+func (wm *XLibWindowManager) requestWindow(window xproto.Window) *windowRequests {
+	root := wm.getRootWindow()
+	property := func(name string, propType xproto.Atom, length uint32) xproto.GetPropertyCookie {
+		return xproto.GetProperty(wm.display, false, window, wm.getAtomCached(name), propType, 0, length)
+	}
+
+	return &windowRequests{
+		window:     window,
+		attributes: xproto.GetWindowAttributes(wm.display, window),
+		netName:    property("_NET_WM_NAME", wm.getAtomCached("UTF8_STRING"), propertyLength),
+		name:       property("WM_NAME", xproto.AtomString, propertyLength),
+		windowType: property("_NET_WM_WINDOW_TYPE", xproto.AtomAtom, 64),
+		class:      property("WM_CLASS", xproto.AtomString, propertyLength),
+		desktop:    property("_NET_WM_DESKTOP", xproto.AtomCardinal, 1),
+		pid:        property("_NET_WM_PID", xproto.AtomCardinal, 1),
+		machine:    property("WM_CLIENT_MACHINE", xproto.AtomString, 64),
+		state:      property("_NET_WM_STATE", xproto.AtomAtom, propertyLength),
+		extents:    property("_NET_FRAME_EXTENTS", xproto.AtomCardinal, 4),
+		geometry:   xproto.GetGeometry(wm.display, xproto.Drawable(window)),
+		position:   xproto.TranslateCoordinates(wm.display, window, root, 0, 0),
+	}
+}
+
+// collectWindow awaits the replies of requestWindow and builds the window.
+// Every reply is read, even for windows that turned out to be invalid.
+// Returns nil if the window does not exist.
+func (wm *XLibWindowManager) collectWindow(r *windowRequests) *shared.Window {
+	_, attributesErr := r.attributes.Reply()
+	netName := propertyValue(r.netName)
+	name := propertyValue(r.name)
+	windowType, typeErr := r.windowType.Reply()
+	class := propertyValue(r.class)
+	desktop := propertyValue(r.desktop)
+	pid := propertyValue(r.pid)
+	machine := propertyValue(r.machine)
+	state := propertyValue(r.state)
+	extents := propertyValue(r.extents)
+	geometry, geometryErr := r.geometry.Reply()
+	position, positionErr := r.position.Reply()
+
+	if attributesErr != nil {
+		return nil
+	}
+
+	// Prefer _NET_WM_NAME (UTF8) over WM_NAME
+	title := string(netName)
+	if netName == nil {
+		title = string(name)
+	}
+	if typeErr != nil {
+		windowType = nil
+	}
+	instance, className := splitWindowClass(r.window, class)
+	// A PID is only meaningful for clients on this machine
+	processID := pidFromBytes(pid)
+	if !isLocalMachine(machine) {
+		processID = 0
+	}
+	var frame shared.Geometry
+	if geometryErr == nil && positionErr == nil {
+		frame = frameGeometry(geometry, position, extents)
+	}
+
+	return &shared.Window{
+		ID:        int(r.window),
+		Title:     title,
+		Type:      wm.windowTypeFromReply(r.window, windowType),
+		Instance:  instance,
+		ClassName: className,
+		Desktop:   desktopFromBytes(desktop),
+		PID:       processID,
+		State:     wm.stateFromBytes(state),
+		Geometry:  frame,
+	}
+}
+
+// collectWindows describes many windows, pipelining the requests in batches.
+// Invalid windows are left out.
+func (wm *XLibWindowManager) collectWindows(windowIDs []int) []*shared.Window {
+	windows := make([]*shared.Window, 0, len(windowIDs))
+	for start := 0; start < len(windowIDs); start += batchSize {
+		end := min(start+batchSize, len(windowIDs))
+
+		requests := make([]*windowRequests, 0, end-start)
+		for _, id := range windowIDs[start:end] {
+			requests = append(requests, wm.requestWindow(xproto.Window(id)))
+		}
+		for _, r := range requests {
+			if window := wm.collectWindow(r); window != nil {
+				windows = append(windows, window)
+			}
+		}
+	}
+	return windows
+}
+
+// propertyValue awaits a GetProperty reply.
+// Returns the value, or nil if the property is missing or the request failed.
+func propertyValue(cookie xproto.GetPropertyCookie) []byte {
+	reply, err := cookie.Reply()
+	if err != nil || reply == nil || reply.ValueLen == 0 {
+		return nil
+	}
+	return reply.Value
+}
+
+// getPropertyAll reads a complete 32-bit list property, following BytesAfter
+// for values longer than a single request returns.
+// Returns the value, nil if the property is missing, or the error of a failed request.
+func (wm *XLibWindowManager) getPropertyAll(window xproto.Window, atom, propType xproto.Atom, chunk uint32) ([]byte, error) {
+	var value []byte
+	offset := uint32(0)
+	for {
+		reply, err := xproto.GetProperty(wm.display, false, window, atom, propType, offset, chunk).Reply()
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, reply.Value...)
+		if reply.BytesAfter == 0 || len(reply.Value) == 0 {
+			return value, nil
+		}
+		// Offsets are counted in 32-bit units
+		offset += uint32(len(reply.Value) / 4)
+	}
+}
@@ -0,0 +1,154 @@
+package desktop
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/desktop/xtest"
+	"gofi/pkg/shared"
+)
+
+// benchmarkClients is the number of client windows listed by the benchmarks,
+// each client holds one of the connections Xvfb allows
+const benchmarkClients = 100
+
+func TestPropertyDecoders(t *testing.T) {
+	cardinal := func(v uint32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, v)
+	}
+
+	if got := desktopFromBytes(cardinal(2)); got != 2 {
+		t.Errorf("desktopFromBytes: got %d, want 2", got)
+	}
+	if got := desktopFromBytes(cardinal(0xFFFFFFFF)); got != -1 {
+		t.Errorf("desktopFromBytes sticky: got %d, want -1", got)
+	}
+	if got := desktopFromBytes(nil); got != -1 {
+		t.Errorf("desktopFromBytes missing: got %d, want -1", got)
+	}
+	if got := pidFromBytes(cardinal(4242)); got != 4242 {
+		t.Errorf("pidFromBytes: got %d, want 4242", got)
+	}
+
+	hostname, _ := os.Hostname()
+	if !isLocalMachine(nil) || !isLocalMachine([]byte(hostname+"\x00")) {
+		t.Error("isLocalMachine: expected missing and own host name to be local")
+	}
+	if isLocalMachine([]byte("elsewhere.invalid")) {
+		t.Error("isLocalMachine: expected other host to be remote")
+	}
+
+	instance, class := splitWindowClass(1, []byte("navigator\x00Firefox\x00"))
+	if instance != "navigator" || class != "Firefox" {
+		t.Errorf("splitWindowClass: got %q/%q", instance, class)
+	}
+
+	extents := append(append(cardinal(1), cardinal(2)...), append(cardinal(20), cardinal(3)...)...)
+	left, right, top, bottom := frameExtentsFromBytes(extents)
+	if left != 1 || right != 2 || top != 20 || bottom != 3 {
+		t.Errorf("frameExtentsFromBytes: got %d %d %d %d", left, right, top, bottom)
+	}
+}
+
+// setupBenchmarkClients starts Xvfb with the fake window manager and opens
+// client windows with titles, classes and PIDs.
+// Skips if Xvfb is not installed.
+func setupBenchmarkClients(b *testing.B, count int) *XLibWindowManager {
+	wm, server := setupXvfbTest(b)
+	for i := 0; i < count; i++ {
+		xtest.NewClient(b, server, xtest.ClientOptions{
+			Title: fmt.Sprintf("client %d", i), Instance: "bench", Class: "Bench", PID: 1000 + i,
+		})
+	}
+	xtest.WaitFor(b, "all clients to be listed", func() bool {
+		return len(wm.ClientIDs()) == count
+	})
+	return wm
+}
+
+// sequentialWindowInfo describes a window like collectWindow, but awaits
+// every reply before sending the next request: one round trip per property
+func sequentialWindowInfo(wm *XLibWindowManager, window xproto.Window) *shared.Window {
+	if _, err := xproto.GetWindowAttributes(wm.display, window).Reply(); err != nil {
+		return nil
+	}
+	property := func(name string, propType xproto.Atom, length uint32) []byte {
+		return propertyValue(xproto.GetProperty(wm.display, false, window, wm.getAtomCached(name), propType, 0, length))
+	}
+
+	netName := property("_NET_WM_NAME", wm.getAtomCached("UTF8_STRING"), propertyLength)
+	title := string(netName)
+	if netName == nil {
+		title = string(property("WM_NAME", xproto.AtomString, propertyLength))
+	}
+	windowType, err := xproto.GetProperty(wm.display, false, window,
+		wm.getAtomCached("_NET_WM_WINDOW_TYPE"), xproto.AtomAtom, 0, 64).Reply()
+	if err != nil {
+		windowType = nil
+	}
+	instance, className := splitWindowClass(window, property("WM_CLASS", xproto.AtomString, propertyLength))
+	processID := pidFromBytes(property("_NET_WM_PID", xproto.AtomCardinal, 1))
+	if !isLocalMachine(property("WM_CLIENT_MACHINE", xproto.AtomString, 64)) {
+		processID = 0
+	}
+	desktop := desktopFromBytes(property("_NET_WM_DESKTOP", xproto.AtomCardinal, 1))
+	state := wm.stateFromBytes(property("_NET_WM_STATE", xproto.AtomAtom, propertyLength))
+	extents := property("_NET_FRAME_EXTENTS", xproto.AtomCardinal, 4)
+
+	var frame shared.Geometry
+	geometry, geometryErr := xproto.GetGeometry(wm.display, xproto.Drawable(window)).Reply()
+	position, positionErr := xproto.TranslateCoordinates(wm.display, window, wm.getRootWindow(), 0, 0).Reply()
+	if geometryErr == nil && positionErr == nil {
+		frame = frameGeometry(geometry, position, extents)
+	}
+
+	return &shared.Window{
+		ID:        int(window),
+		Title:     title,
+		Type:      wm.windowTypeFromReply(window, windowType),
+		Instance:  instance,
+		ClassName: className,
+		Desktop:   desktop,
+		PID:       processID,
+		State:     state,
+		Geometry:  frame,
+	}
+}
+
+// BenchmarkStackingList lists all windows with pipelined requests
+func BenchmarkStackingList(b *testing.B) {
+	wm := setupBenchmarkClients(b, benchmarkClients)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if got := len(wm.StackingList()); got != benchmarkClients {
+			b.Fatalf("Got %d windows, want %d", got, benchmarkClients)
+		}
+	}
+}
+
+// BenchmarkWindowInfoSequential lists all windows with one round trip per
+// property, as the baseline for BenchmarkStackingList
+func BenchmarkWindowInfoSequential(b *testing.B) {
+	wm := setupBenchmarkClients(b, benchmarkClients)
+	ids := wm.ClientIDs()
+	pipelined := wm.collectWindows(ids)
+	for i, id := range ids {
+		if sequential := sequentialWindowInfo(wm, xproto.Window(id)); sequential == nil || *sequential != *pipelined[i] {
+			b.Fatalf("Window %d: sequential %v differs from pipelined %v", id, sequential, pipelined[i])
+		}
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, id := range wm.ClientIDs() {
+			if sequentialWindowInfo(wm, xproto.Window(id)) == nil {
+				b.Fatalf("Window %d not found", id)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package desktop
+
+import (
+	"encoding/binary"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/log"
+)
+
+// Capabilities reports the window manager named by _NET_SUPPORTING_WM_CHECK
+// and which of the atoms gofi uses it lists in _NET_SUPPORTED.
+// Detected on first use and again after the window manager was replaced.
+func (wm *XLibWindowManager) Capabilities() Capabilities {
+	wm.capsMutex.Lock()
+	defer wm.capsMutex.Unlock()
+
+	if wm.caps == nil {
+		if !wm.guard.acquire() {
+			return NewCapabilities("", nil)
+		}
+		defer wm.guard.release()
+		caps := wm.detectCapabilities()
+		log.Debug("Detected window manager: %s", caps)
+		wm.caps = &caps
+	}
+	return *wm.caps
+}
+
+// invalidateCapabilities makes the next Capabilities call detect them again
+func (wm *XLibWindowManager) invalidateCapabilities() {
+	wm.capsMutex.Lock()
+	defer wm.capsMutex.Unlock()
+	wm.caps = nil
+}
+
+// detectCapabilities reads the supporting WM check window and _NET_SUPPORTED.
+// Without a valid check window no EWMH window manager is running and every
+// atom counts as missing, _NET_SUPPORTED may be left over from an earlier one.
+func (wm *XLibWindowManager) detectCapabilities() Capabilities {
+	root := wm.getRootWindow()
+	if root == 0 {
+		return NewCapabilities("", nil)
+	}
+
+	check := windowFromBytes(wm.getWindowPropertyBytes(root, "_NET_SUPPORTING_WM_CHECK", xproto.AtomWindow))
+	if check == 0 {
+		return NewCapabilities("", nil)
+	}
+	// The check window refers to itself, otherwise the property is stale
+	if windowFromBytes(wm.getWindowPropertyBytes(check, "_NET_SUPPORTING_WM_CHECK", xproto.AtomWindow)) != check {
+		log.Debug("Ignoring stale _NET_SUPPORTING_WM_CHECK window %d", check)
+		return NewCapabilities("", nil)
+	}
+
+	name := "unknown"
+	if utf8Atom := wm.getAtomCached("UTF8_STRING"); utf8Atom != 0 {
+		if data := wm.getWindowPropertyBytes(check, "_NET_WM_NAME", utf8Atom); len(data) > 0 {
+			name = string(data)
+		}
+	}
+	return NewCapabilities(name, wm.supportedAtoms(root))
+}
+
+// supportedAtoms returns the atoms out of those gofi uses that are listed
+// in _NET_SUPPORTED. Only known atoms are compared, so no atom names have to
+// be looked up.
+func (wm *XLibWindowManager) supportedAtoms(root xproto.Window) []string {
+	supportedAtom := wm.getAtomCached("_NET_SUPPORTED")
+	if supportedAtom == 0 {
+		return nil
+	}
+	value, err := wm.getPropertyAll(root, supportedAtom, xproto.AtomAtom, 1024)
+	if err != nil {
+		log.Error("Failed to get _NET_SUPPORTED property: %v", err)
+		return nil
+	}
+
+	listed := make(map[xproto.Atom]bool)
+	for _, atom := range bytesToUint32s(value) {
+		listed[xproto.Atom(atom)] = true
+	}
+	var supported []string
+	for _, name := range ewmhAtoms {
+		if atom := wm.getAtomCached(name); atom != 0 && listed[atom] {
+			supported = append(supported, name)
+		}
+	}
+	return supported
+}
+
+// windowFromBytes decodes a WINDOW property value.
+// Returns the window or 0 if missing.
+func windowFromBytes(data []byte) xproto.Window {
+	if len(data) < 4 {
+		return 0
+	}
+	return xproto.Window(binary.LittleEndian.Uint32(data))
+}
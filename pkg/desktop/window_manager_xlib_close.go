@@ -0,0 +1,151 @@
+package desktop
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// processKillWait is how long a process gets to exit after SIGTERM
+const processKillWait = 500 * time.Millisecond
+
+// CloseWindow asks a window to close gracefully.
+// Windows taking part in the ICCCM WM_DELETE_WINDOW protocol get the message
+// directly, which works without a window manager. Others are closed through
+// a _NET_CLOSE_WINDOW request to the window manager.
+// Args:
+//
+//	windowID: The ID of the window to close.
+//
+// Returns:
+//
+//	error: An error if the message could not be sent.
+func (wm *XLibWindowManager) CloseWindow(windowID int) error {
+	if !wm.guard.acquire() {
+		return errDisplayClosed
+	}
+	defer wm.guard.release()
+	window := xproto.Window(windowID)
+	if !wm.isValidWindow(window) {
+		return fmt.Errorf("cannot close invalid window ID %d", windowID)
+	}
+
+	if wm.supportsProtocol(window, "WM_DELETE_WINDOW") {
+		if err := wm.sendDeleteWindow(window); err != nil {
+			return fmt.Errorf("failed to send WM_DELETE_WINDOW: %w", err)
+		}
+		log.Debug("Sent WM_DELETE_WINDOW to window %d", windowID)
+		return nil
+	}
+
+	if err := wm.Capabilities().Require("_NET_CLOSE_WINDOW"); err != nil {
+		return fmt.Errorf("cannot close window %d without WM_DELETE_WINDOW: %w", windowID, err)
+	}
+	closeAtom := wm.getAtomCached("_NET_CLOSE_WINDOW")
+	if closeAtom == 0 {
+		return fmt.Errorf("could not get _NET_CLOSE_WINDOW atom")
+	}
+
+	// EWMH spec for _NET_CLOSE_WINDOW:
+	// data.l[0] = timestamp
+	// data.l[1] = source indication
+	if err := wm.sendClientMessage(window, closeAtom, uint32(wm.serverTime()), sourcePager); err != nil {
+		log.Error("Failed to send _NET_CLOSE_WINDOW event for window %d: %v", windowID, err)
+		return fmt.Errorf("failed to send close event: %w", err)
+	}
+
+	log.Debug("Sent _NET_CLOSE_WINDOW event for window %d", windowID)
+	return nil
+}
+
+// KillWindow forcibly closes a window without asking it first.
+// The client's X connection is closed with XKillClient. If that fails, the
+// process from _NET_WM_PID is signalled, as long as it runs on this machine.
+// Args:
+//
+//	windowID: The ID of the window to kill.
+//
+// Returns:
+//
+//	error: An error if neither the connection nor the process could be killed.
+func (wm *XLibWindowManager) KillWindow(windowID int) error {
+	if !wm.guard.acquire() {
+		return errDisplayClosed
+	}
+	defer wm.guard.release()
+	window := xproto.Window(windowID)
+	if !wm.isValidWindow(window) {
+		return fmt.Errorf("cannot kill invalid window ID %d", windowID)
+	}
+
+	// Read the PID first, the properties are gone with the connection
+	pid := pidFromBytes(wm.getWindowPropertyBytes(window, "_NET_WM_PID", xproto.AtomCardinal))
+	local := isLocalMachine(wm.getWindowPropertyBytes(window, "WM_CLIENT_MACHINE", xproto.AtomString))
+
+	err := xproto.KillClientChecked(wm.display, uint32(window)).Check()
+	if err == nil {
+		log.Debug("Killed X client of window %d", windowID)
+		return nil
+	}
+	log.Warn("XKillClient failed for window %d: %v", windowID, err)
+
+	if pid <= 0 || !local {
+		return fmt.Errorf("failed to kill window %d: %w", windowID, err)
+	}
+	if err := shared.KillProcess(pid, processKillWait); err != nil {
+		return fmt.Errorf("failed to kill process %d of window %d: %w", pid, windowID, err)
+	}
+	return nil
+}
+
+// supportsProtocol checks whether a window lists an ICCCM protocol in WM_PROTOCOLS
+func (wm *XLibWindowManager) supportsProtocol(window xproto.Window, protocol string) bool {
+	protocolAtom := wm.getAtomCached(protocol)
+	if protocolAtom == 0 {
+		return false
+	}
+	protocols := bytesToUint32s(wm.getWindowPropertyBytes(window, "WM_PROTOCOLS", xproto.AtomAtom))
+	for _, atom := range protocols {
+		if xproto.Atom(atom) == protocolAtom {
+			return true
+		}
+	}
+	return false
+}
+
+// sendDeleteWindow sends the ICCCM WM_DELETE_WINDOW client message to the window itself
+func (wm *XLibWindowManager) sendDeleteWindow(window xproto.Window) error {
+	protocolsAtom := wm.getAtomCached("WM_PROTOCOLS")
+	deleteAtom := wm.getAtomCached("WM_DELETE_WINDOW")
+	if protocolsAtom == 0 || deleteAtom == 0 {
+		return fmt.Errorf("could not get WM_PROTOCOLS atoms")
+	}
+
+	// ICCCM: data.l[0] = protocol atom, data.l[1] = timestamp
+	cm := xproto.ClientMessageEvent{
+		Format: 32,
+		Window: window,
+		Type:   protocolsAtom,
+		Data: xproto.ClientMessageDataUnionData32New([]uint32{
+			uint32(deleteAtom), uint32(wm.serverTime()), 0, 0, 0,
+		}),
+	}
+	return xproto.SendEventChecked(wm.display, false, window, xproto.EventMaskNoEvent, string(cm.Bytes())).Check()
+}
+
+// isLocalMachine checks a WM_CLIENT_MACHINE value against the local host name.
+// Windows without the property are assumed to be local.
+func isLocalMachine(value []byte) bool {
+	machine := strings.TrimRight(string(value), "\x00")
+	if machine == "" {
+		return true
+	}
+	hostname, err := os.Hostname()
+	return err == nil && machine == hostname
+}
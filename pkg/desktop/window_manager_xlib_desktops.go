@@ -0,0 +1,133 @@
+package desktop
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/log"
+)
+
+// DesktopCount reads _NET_NUMBER_OF_DESKTOPS from the root window.
+// Returns the number of desktops, or 0 if the WM does not report it.
+func (wm *XLibWindowManager) DesktopCount() int {
+	if !wm.guard.acquire() {
+		return 0
+	}
+	defer wm.guard.release()
+	values := wm.getRootCardinals("_NET_NUMBER_OF_DESKTOPS")
+	if len(values) == 0 {
+		return 0
+	}
+	return int(values[0])
+}
+
+// DesktopNames reads _NET_DESKTOP_NAMES from the root window.
+// The property is a list of null-terminated UTF-8 strings.
+// Returns the names indexed by desktop number, or nil if not set.
+func (wm *XLibWindowManager) DesktopNames() []string {
+	if !wm.guard.acquire() {
+		return nil
+	}
+	defer wm.guard.release()
+	root := wm.getRootWindow()
+	utf8Atom := wm.getAtomCached("UTF8_STRING")
+	if root == 0 || utf8Atom == 0 {
+		return nil
+	}
+
+	data := wm.getWindowPropertyBytes(root, "_NET_DESKTOP_NAMES", utf8Atom)
+	return splitNullTerminated(data)
+}
+
+// CurrentDesktop reads _NET_CURRENT_DESKTOP from the root window.
+// Returns the desktop index, or -1 if unknown.
+func (wm *XLibWindowManager) CurrentDesktop() int {
+	if !wm.guard.acquire() {
+		return -1
+	}
+	defer wm.guard.release()
+	return wm.getCurrentDesktop()
+}
+
+// SwitchDesktop sends a _NET_CURRENT_DESKTOP client message to switch desktops.
+// Args:
+//
+//	desktop: Index of the desktop to switch to.
+//
+// Returns:
+//
+//	error: An error if the index is out of range or the message could not be sent.
+func (wm *XLibWindowManager) SwitchDesktop(desktop int) error {
+	if !wm.guard.acquire() {
+		return errDisplayClosed
+	}
+	defer wm.guard.release()
+	if err := wm.Capabilities().Require("_NET_CURRENT_DESKTOP"); err != nil {
+		return fmt.Errorf("cannot switch desktops: %w", err)
+	}
+	if count := wm.DesktopCount(); desktop < 0 || (count > 0 && desktop >= count) {
+		return fmt.Errorf("desktop %d out of range (%d desktops)", desktop, count)
+	}
+	if err := wm.switchDesktop(desktop, wm.serverTime()); err != nil {
+		return err
+	}
+	log.Debug("Switched to desktop %d", desktop)
+	return nil
+}
+
+// MoveWindowToDesktop sends a _NET_WM_DESKTOP client message to move a window.
+// Args:
+//
+//	windowID: The ID of the window to move.
+//	desktop: Index of the target desktop.
+//
+// Returns:
+//
+//	error: An error if the window or index is invalid or the message could not be sent.
+func (wm *XLibWindowManager) MoveWindowToDesktop(windowID int, desktop int) error {
+	if !wm.guard.acquire() {
+		return errDisplayClosed
+	}
+	defer wm.guard.release()
+	window := xproto.Window(windowID)
+	if !wm.isValidWindow(window) {
+		return fmt.Errorf("cannot move invalid window ID %d", windowID)
+	}
+	if err := wm.Capabilities().Require("_NET_WM_DESKTOP"); err != nil {
+		return fmt.Errorf("cannot move window %d: %w", windowID, err)
+	}
+	if count := wm.DesktopCount(); desktop < 0 || (count > 0 && desktop >= count) {
+		return fmt.Errorf("desktop %d out of range (%d desktops)", desktop, count)
+	}
+
+	desktopAtom := wm.getAtomCached("_NET_WM_DESKTOP")
+	if desktopAtom == 0 {
+		return fmt.Errorf("could not get _NET_WM_DESKTOP atom")
+	}
+
+	// EWMH spec for _NET_WM_DESKTOP:
+	// data.l[0] = new desktop
+	// data.l[1] = source indication
+	if err := wm.sendClientMessage(window, desktopAtom, uint32(desktop), sourcePager); err != nil {
+		return fmt.Errorf("failed to move window %d to desktop %d: %w", windowID, desktop, err)
+	}
+	log.Debug("Moved window %d to desktop %d", windowID, desktop)
+	return nil
+}
+
+// splitNullTerminated splits a list of null-terminated strings.
+// A missing terminator after the last string is tolerated.
+func splitNullTerminated(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	data = bytes.TrimSuffix(data, []byte{0})
+	parts := bytes.Split(data, []byte{0})
+	names := make([]string, len(parts))
+	for i, part := range parts {
+		names[i] = string(part)
+	}
+	return names
+}
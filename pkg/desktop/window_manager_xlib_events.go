@@ -0,0 +1,72 @@
+package desktop
+
+import (
+	"sync/atomic"
+
+	"github.com/BurntSushi/xgb"
+)
+
+// eventBuffer is the number of X events queued for AwaitEvent.
+// Further events are dropped and reported as EventOverflow.
+const eventBuffer = 1024
+
+// eventSource is the part of xgb.Conn the pump reads from
+type eventSource interface {
+	WaitForEvent() (xgb.Event, xgb.Error)
+}
+
+// eventPump reads all events of a connection in one long-lived goroutine.
+// The connection must never stall on unread events: xgb stops reading
+// replies once its own event queue is full, so requests would block too.
+type eventPump struct {
+	events  chan interface{} // xgb.Event or xgb.Error, closed with the connection
+	done    chan struct{}    // Closed when the connection is gone
+	dropped atomic.Int64     // Events dropped since the last takeDropped
+}
+
+// startEventPump starts reading events from source until it is closed
+func startEventPump(source eventSource) *eventPump {
+	pump := &eventPump{events: make(chan interface{}, eventBuffer), done: make(chan struct{})}
+	go pump.run(source)
+	return pump
+}
+
+// run forwards events without ever blocking, dropping them when nobody reads
+func (p *eventPump) run(source eventSource) {
+	defer close(p.done)
+	defer close(p.events)
+	for {
+		event, err := source.WaitForEvent()
+		var result interface{}
+		switch {
+		case err != nil:
+			result = err
+		case event != nil:
+			result = event
+		default:
+			// xgb reports a closed connection with neither event nor error
+			return
+		}
+
+		select {
+		case p.events <- result:
+		default:
+			p.dropped.Add(1)
+		}
+	}
+}
+
+// closed reports whether the connection is gone
+func (p *eventPump) closed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// takeDropped returns and resets the number of dropped events
+func (p *eventPump) takeDropped() int64 {
+	return p.dropped.Swap(0)
+}
@@ -0,0 +1,99 @@
+package desktop
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// fakeEventSource hands out a fixed number of events, then reports a closed connection
+type fakeEventSource struct {
+	events  chan xgb.Event
+	release chan struct{} // Closed to let the source report the connection closed
+}
+
+func (f *fakeEventSource) WaitForEvent() (xgb.Event, xgb.Error) {
+	if event, ok := <-f.events; ok {
+		return event, nil
+	}
+	<-f.release
+	return nil, nil
+}
+
+func TestEventPumpDropsInsteadOfBlocking(t *testing.T) {
+	source := &fakeEventSource{
+		events:  make(chan xgb.Event, eventBuffer+10),
+		release: make(chan struct{}),
+	}
+	for i := 0; i < eventBuffer+10; i++ {
+		source.events <- xproto.MapNotifyEvent{Window: xproto.Window(i + 1)}
+	}
+	close(source.events)
+
+	caps := FullCapabilities("test")
+	wm := &XLibWindowManager{pump: startEventPump(source), caps: &caps}
+
+	// The pump keeps reading while nobody waits, the excess is dropped
+	deadline := time.Now().Add(time.Second)
+	for wm.pump.dropped.Load() < 10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if event := wm.AwaitEvent(context.Background()); event.Kind != EventOverflow {
+		t.Fatalf("Expected overflow after dropped events, got %s", event)
+	}
+	if event := wm.AwaitEvent(context.Background()); event.Kind != EventMap || event.WindowID != 1 {
+		t.Errorf("Expected first queued event, got %s", event)
+	}
+
+	// Cancelling a wait does not end the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if event := wm.AwaitEvent(ctx); event.Kind != EventNone {
+		t.Errorf("Expected no event when cancelled, got %s", event)
+	}
+	if event := wm.AwaitEvent(context.Background()); event.Kind != EventMap || event.WindowID != 2 {
+		t.Errorf("Expected next queued event after cancellation, got %s", event)
+	}
+
+	// A closed connection ends the stream once the queue is drained
+	close(source.release)
+	for i := 2; i < eventBuffer; i++ {
+		wm.AwaitEvent(context.Background())
+	}
+	if event := wm.AwaitEvent(context.Background()); event.Kind != EventNone {
+		t.Errorf("Expected no event after the connection closed, got %s", event)
+	}
+}
+
+func TestFallbackEvents(t *testing.T) {
+	caps := NewCapabilities("", nil)
+	wm := &XLibWindowManager{caps: &caps}
+
+	tests := []struct {
+		event interface{}
+		want  Event
+	}{
+		{xproto.MapNotifyEvent{Window: 5}, Event{Kind: EventProperty, Atom: "_NET_CLIENT_LIST"}},
+		{xproto.MapNotifyEvent{Window: 6, OverrideRedirect: true}, Event{Kind: EventMap, WindowID: 6}},
+		{xproto.DestroyNotifyEvent{Window: 5}, Event{Kind: EventProperty, Atom: "_NET_CLIENT_LIST"}},
+		{xproto.FocusInEvent{Event: 5, Detail: xproto.NotifyDetailNonlinear}, Event{Kind: EventProperty, WindowID: 5, Atom: "_NET_ACTIVE_WINDOW"}},
+		{xproto.FocusInEvent{Event: 5, Mode: xproto.NotifyModeGrab}, Event{Kind: EventOther}},
+	}
+	for _, tt := range tests {
+		if got := wm.convertEvent(tt.event); got != tt.want {
+			t.Errorf("%T: got %s, want %s", tt.event, got, tt.want)
+		}
+	}
+
+	// With a client list and active window the events keep their meaning
+	caps = FullCapabilities("test")
+	if got := wm.convertEvent(xproto.MapNotifyEvent{Window: 5}); got.Kind != EventMap {
+		t.Errorf("Expected a map event, got %s", got)
+	}
+	if got := wm.convertEvent(xproto.FocusInEvent{Event: 5}); got.Kind != EventOther {
+		t.Errorf("Expected focus to be ignored, got %s", got)
+	}
+}
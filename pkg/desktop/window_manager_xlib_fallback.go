@@ -0,0 +1,238 @@
+package desktop
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/log"
+)
+
+// Fallback mode for window managers without _NET_CLIENT_LIST or
+// _NET_ACTIVE_WINDOW, and for bare X. Client windows are found by walking
+// the window tree, focus is tracked through the input focus and windows are
+// activated by raising and focusing them directly.
+
+// normalState is the ICCCM NormalState of WM_STATE, see iconicState
+const normalState = 1
+
+// maxFrameDepth limits the search for a client window below the frames of a
+// reparenting window manager
+const maxFrameDepth = 3
+
+// fallbackClients reports whether client windows are found by walking the tree
+func (wm *XLibWindowManager) fallbackClients() bool {
+	return !wm.Capabilities().Has("_NET_CLIENT_LIST")
+}
+
+// fallbackFocus reports whether the active window is the input focus
+func (wm *XLibWindowManager) fallbackFocus() bool {
+	return !wm.Capabilities().Has("_NET_ACTIVE_WINDOW")
+}
+
+// discoverClients walks the window tree from the root.
+// Returns the client windows from bottom to top, nil on error.
+func (wm *XLibWindowManager) discoverClients() []int {
+	root := wm.getRootWindow()
+	if root == 0 {
+		return nil
+	}
+	tree, err := xproto.QueryTree(wm.display, root).Reply()
+	if err != nil {
+		log.Error("Failed to query the window tree: %v", err)
+		return nil
+	}
+
+	found := wm.findClients(tree.Children, 0)
+	clients := make([]int, len(found))
+	for i, window := range found {
+		clients[i] = int(window)
+	}
+	return clients
+}
+
+// treeNode holds the replies deciding whether a window is a client
+type treeNode struct {
+	window     xproto.Window
+	state      xproto.GetPropertyCookie
+	attributes xproto.GetWindowAttributesCookie
+	class      xproto.GetPropertyCookie
+	children   xproto.QueryTreeCookie
+}
+
+// findClients returns the client windows among and below the given windows,
+// keeping their stacking order. A window whose WM_STATE is Normal or Iconic
+// is a client. Windows without WM_STATE are searched for clients, they are
+// frames of a reparenting window manager. A viewable top-level window that
+// has a WM_CLASS but no client below it counts too, nobody sets WM_STATE
+// without a window manager.
+// Requests are pipelined in batches like collectWindows.
+func (wm *XLibWindowManager) findClients(windows []xproto.Window, depth int) []xproto.Window {
+	stateAtom := wm.getAtomCached("WM_STATE")
+	if stateAtom == 0 {
+		return nil
+	}
+
+	var clients []xproto.Window
+	for start := 0; start < len(windows); start += batchSize {
+		end := min(start+batchSize, len(windows))
+
+		nodes := make([]*treeNode, 0, end-start)
+		for _, window := range windows[start:end] {
+			nodes = append(nodes, &treeNode{
+				window:     window,
+				state:      xproto.GetProperty(wm.display, false, window, stateAtom, stateAtom, 0, 2),
+				attributes: xproto.GetWindowAttributes(wm.display, window),
+				class:      xproto.GetProperty(wm.display, false, window, xproto.AtomWmClass, xproto.AtomString, 0, 64),
+			})
+		}
+
+		// Children are only queried for windows that are no clients
+		var frames []*treeNode
+		var viewable []bool
+		for _, node := range nodes {
+			state := propertyValue(node.state)
+			attributes, err := node.attributes.Reply()
+			hasClass := propertyValue(node.class) != nil
+			if err != nil || attributes.OverrideRedirect {
+				continue // Vanished, or a menu or tooltip
+			}
+			if len(state) >= 4 {
+				if value := binary.LittleEndian.Uint32(state); value == normalState || value == iconicState {
+					clients = append(clients, node.window)
+				}
+				continue // Withdrawn
+			}
+			if depth < maxFrameDepth {
+				node.children = xproto.QueryTree(wm.display, node.window)
+			}
+			frames = append(frames, node)
+			viewable = append(viewable, depth == 0 && hasClass && attributes.MapState == xproto.MapStateViewable)
+		}
+
+		for i, node := range frames {
+			var below []xproto.Window
+			if depth < maxFrameDepth {
+				if tree, err := node.children.Reply(); err == nil && len(tree.Children) > 0 {
+					below = wm.findClients(tree.Children, depth+1)
+				}
+			}
+			switch {
+			case len(below) > 0:
+				clients = append(clients, below...)
+			case viewable[i]:
+				clients = append(clients, node.window)
+			}
+		}
+	}
+	return clients
+}
+
+// focusedClient returns the client window holding the input focus, walking
+// up from a focused subwindow.
+// Returns the window ID, or 0 if no client has the focus.
+func (wm *XLibWindowManager) focusedClient() int {
+	focus, err := xproto.GetInputFocus(wm.display).Reply()
+	if err != nil {
+		log.Error("Failed to get the input focus: %v", err)
+		return 0
+	}
+	root := wm.getRootWindow()
+	window := focus.Focus
+	if window == xproto.InputFocusNone || window == xproto.InputFocusPointerRoot || window == root {
+		return 0
+	}
+
+	for depth := 0; depth <= maxFrameDepth+1; depth++ {
+		tree, err := xproto.QueryTree(wm.display, window).Reply()
+		if err != nil {
+			return 0
+		}
+		if tree.Parent == root || tree.Parent == 0 {
+			// A top-level window, the client is the window itself or inside its frame
+			clients := wm.findClients([]xproto.Window{window}, 0)
+			if len(clients) == 0 {
+				return 0
+			}
+			return int(clients[0])
+		}
+		window = tree.Parent
+	}
+	return 0
+}
+
+// topLevelWindow returns the child of the root containing a window, the
+// frame of a reparenting window manager or the window itself
+func (wm *XLibWindowManager) topLevelWindow(window xproto.Window) xproto.Window {
+	root := wm.getRootWindow()
+	for depth := 0; depth <= maxFrameDepth+1; depth++ {
+		tree, err := xproto.QueryTree(wm.display, window).Reply()
+		if err != nil || tree.Parent == root || tree.Parent == 0 {
+			return window
+		}
+		window = tree.Parent
+	}
+	return window
+}
+
+// activateFallback activates a window without _NET_ACTIVE_WINDOW. Iconic
+// windows are mapped, which asks the window manager to restore them
+// (ICCCM 4.1.4). The window is raised and gets the input focus.
+func (wm *XLibWindowManager) activateFallback(window xproto.Window) error {
+	attributes, err := xproto.GetWindowAttributes(wm.display, window).Reply()
+	if err != nil {
+		return fmt.Errorf("cannot activate invalid window ID %d", window)
+	}
+	if attributes.MapState != xproto.MapStateViewable {
+		if err := xproto.MapWindowChecked(wm.display, window).Check(); err != nil {
+			return fmt.Errorf("failed to map window %d: %w", window, err)
+		}
+	}
+
+	top := wm.topLevelWindow(window)
+	raise := []uint32{xproto.StackModeAbove}
+	if err := xproto.ConfigureWindowChecked(wm.display, top, xproto.ConfigWindowStackMode, raise).Check(); err != nil {
+		return fmt.Errorf("failed to raise window %d: %w", window, err)
+	}
+	err = xproto.SetInputFocusChecked(wm.display, xproto.InputFocusParent, window, wm.serverTime()).Check()
+	if err != nil {
+		return fmt.Errorf("failed to focus window %d: %w", window, err)
+	}
+	log.Debug("Raised and focused window %d", window)
+	return nil
+}
+
+// convertFallbackEvent maps the events replacing _NET_CLIENT_LIST and
+// _NET_ACTIVE_WINDOW changes in fallback mode onto those property events.
+// Returns the event and true if it was converted.
+func (wm *XLibWindowManager) convertFallbackEvent(event interface{}) (Event, bool) {
+	clientListChanged := Event{Kind: EventProperty, Atom: "_NET_CLIENT_LIST"}
+	switch ev := event.(type) {
+	case xproto.MapNotifyEvent:
+		// Menus and tooltips are no clients
+		if !ev.OverrideRedirect && wm.fallbackClients() {
+			return clientListChanged, true
+		}
+	case xproto.UnmapNotifyEvent, xproto.DestroyNotifyEvent, xproto.ReparentNotifyEvent:
+		if wm.fallbackClients() {
+			return clientListChanged, true
+		}
+	case xproto.PropertyNotifyEvent:
+		if ev.Atom == wm.getAtomCached("WM_STATE") && wm.fallbackClients() {
+			return clientListChanged, true
+		}
+	case xproto.FocusInEvent:
+		// Pointer focus and grabs, e.g. by a menu, do not change the active window
+		if ev.Detail == xproto.NotifyDetailPointer || ev.Mode == xproto.NotifyModeGrab || ev.Mode == xproto.NotifyModeUngrab {
+			return Event{Kind: EventOther}, true
+		}
+		if wm.fallbackFocus() {
+			return Event{Kind: EventProperty, WindowID: int(ev.Event), Atom: "_NET_ACTIVE_WINDOW"}, true
+		}
+		return Event{Kind: EventOther}, true
+	case xproto.FocusOutEvent:
+		return Event{Kind: EventOther}, true
+	}
+	return Event{}, false
+}
@@ -0,0 +1,180 @@
+package desktop
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// getWindowGeometry computes the frame-inclusive geometry of a client window.
+// The client position is translated to root coordinates and grown by its
+// border and the _NET_FRAME_EXTENTS of the window manager decorations.
+// Returns an empty geometry if the window is gone.
+func (wm *XLibWindowManager) getWindowGeometry(windowID xproto.Window) shared.Geometry {
+	root := wm.getRootWindow()
+	if root == 0 {
+		return shared.Geometry{}
+	}
+
+	geometry, err := xproto.GetGeometry(wm.display, xproto.Drawable(windowID)).Reply()
+	if err != nil {
+		log.Debug("Failed to get geometry of window %d: %v", windowID, err)
+		return shared.Geometry{}
+	}
+	// (0, 0) of the window is inside its border
+	position, err := xproto.TranslateCoordinates(wm.display, windowID, root, 0, 0).Reply()
+	if err != nil {
+		log.Debug("Failed to translate coordinates of window %d: %v", windowID, err)
+		return shared.Geometry{}
+	}
+
+	extents := wm.getWindowPropertyBytes(windowID, "_NET_FRAME_EXTENTS", xproto.AtomCardinal)
+	return frameGeometry(geometry, position, extents)
+}
+
+// frameGeometry grows the client geometry by its border and the frame extents
+func frameGeometry(geometry *xproto.GetGeometryReply, position *xproto.TranslateCoordinatesReply, extents []byte) shared.Geometry {
+	border := int(geometry.BorderWidth)
+	left, right, top, bottom := frameExtentsFromBytes(extents)
+	return shared.Geometry{
+		X:      int(position.DstX) - border - left,
+		Y:      int(position.DstY) - border - top,
+		Width:  int(geometry.Width) + 2*border + left + right,
+		Height: int(geometry.Height) + 2*border + top + bottom,
+	}
+}
+
+// frameExtentsFromBytes decodes _NET_FRAME_EXTENTS, the size of the WM decorations.
+// Returns zero extents for undecorated windows or WMs not setting the property.
+func frameExtentsFromBytes(data []byte) (left, right, top, bottom int) {
+	values := bytesToUint32s(data)
+	if len(values) < 4 {
+		return 0, 0, 0, 0
+	}
+	return int(values[0]), int(values[1]), int(values[2]), int(values[3])
+}
+
+// Monitors lists the active RandR outputs with their position on the root window.
+// The list is cached until RandR reports a change, see selectMonitorEvents.
+// Returns nil if the RandR extension is not available.
+func (wm *XLibWindowManager) Monitors() []shared.Monitor {
+	if !wm.guard.acquire() {
+		return nil
+	}
+	defer wm.guard.release()
+	wm.monitorMutex.Lock()
+	defer wm.monitorMutex.Unlock()
+
+	if !wm.monitorsValid {
+		monitors := wm.queryMonitors()
+		if monitors == nil {
+			return nil
+		}
+		wm.monitors = monitors
+		wm.monitorsValid = true
+	}
+	return append([]shared.Monitor(nil), wm.monitors...)
+}
+
+// selectMonitorEvents asks RandR to report screen, CRTC and output changes
+// on the root window, so the cached monitors are refreshed after a hotplug
+func (wm *XLibWindowManager) selectMonitorEvents(root xproto.Window) {
+	if err := wm.initRandr(); err != nil {
+		return
+	}
+	mask := uint16(randr.NotifyMaskScreenChange | randr.NotifyMaskCrtcChange | randr.NotifyMaskOutputChange)
+	if err := randr.SelectInputChecked(wm.display, root, mask).Check(); err != nil {
+		log.Warn("Failed to select RandR events, monitor changes are not noticed: %v", err)
+	}
+}
+
+// convertMonitorChange drops the cached monitors after a RandR event.
+// A hotplug sends several events, only the first one after the monitors
+// were read is reported as EventMonitors.
+func (wm *XLibWindowManager) convertMonitorChange() Event {
+	wm.monitorMutex.Lock()
+	defer wm.monitorMutex.Unlock()
+
+	if !wm.monitorsValid {
+		return Event{Kind: EventOther}
+	}
+	wm.monitorsValid = false
+	wm.monitors = nil
+	return Event{Kind: EventMonitors}
+}
+
+// queryMonitors reads the active RandR outputs from the server.
+// Returns nil if the RandR extension is not available.
+func (wm *XLibWindowManager) queryMonitors() []shared.Monitor {
+	if err := wm.initRandr(); err != nil {
+		return nil
+	}
+	root := wm.getRootWindow()
+	if root == 0 {
+		return nil
+	}
+
+	resources, err := randr.GetScreenResourcesCurrent(wm.display, root).Reply()
+	if err != nil {
+		log.Warn("Failed to get RandR screen resources: %v", err)
+		return nil
+	}
+	primary := randr.Output(0)
+	if reply, err := randr.GetOutputPrimary(wm.display, root).Reply(); err == nil {
+		primary = reply.Output
+	}
+
+	monitors := make([]shared.Monitor, 0, len(resources.Outputs))
+	for _, output := range resources.Outputs {
+		monitor, ok := wm.outputMonitor(output, resources.ConfigTimestamp)
+		if ok {
+			monitor.Primary = output == primary
+			monitors = append(monitors, monitor)
+		}
+	}
+	return monitors
+}
+
+// outputMonitor describes a RandR output.
+// Returns false for disconnected outputs and outputs without an active CRTC.
+func (wm *XLibWindowManager) outputMonitor(output randr.Output, timestamp xproto.Timestamp) (shared.Monitor, bool) {
+	info, err := randr.GetOutputInfo(wm.display, output, timestamp).Reply()
+	if err != nil {
+		log.Debug("Failed to get RandR output %d: %v", output, err)
+		return shared.Monitor{}, false
+	}
+	if info.Connection != randr.ConnectionConnected || info.Crtc == 0 {
+		return shared.Monitor{}, false
+	}
+
+	crtc, err := randr.GetCrtcInfo(wm.display, info.Crtc, timestamp).Reply()
+	if err != nil {
+		log.Debug("Failed to get RandR CRTC %d: %v", info.Crtc, err)
+		return shared.Monitor{}, false
+	}
+	return shared.Monitor{
+		Name: string(info.Name),
+		Geometry: shared.Geometry{
+			X:      int(crtc.X),
+			Y:      int(crtc.Y),
+			Width:  int(crtc.Width),
+			Height: int(crtc.Height),
+		},
+	}, true
+}
+
+// initRandr initializes the RandR extension once.
+// Returns the initialization error, logged only the first time.
+func (wm *XLibWindowManager) initRandr() error {
+	wm.randrOnce.Do(func() {
+		if err := randr.Init(wm.display); err != nil {
+			wm.randrErr = fmt.Errorf("RandR extension not available: %w", err)
+			log.Warn("%v, monitors unknown", wm.randrErr)
+		}
+	})
+	return wm.randrErr
+}
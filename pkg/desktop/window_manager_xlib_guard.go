@@ -0,0 +1,68 @@
+package desktop
+
+import (
+	"fmt"
+	"sync"
+)
+
+// errDisplayClosed is returned by calls after the X connection was closed or lost
+var errDisplayClosed = fmt.Errorf("connection to the X server is closed")
+
+// connGuard keeps calls off a closed connection, xgb panics when a request
+// is sent after the connection was closed. Every exported method of
+// XLibWindowManager holds it while it sends requests, Cleanup waits for
+// running calls before it closes the connection. Holding it twice is fine.
+type connGuard struct {
+	mutex  sync.Mutex
+	idle   sync.Cond // Signalled when the last call returned
+	calls  int
+	closed bool
+}
+
+// acquire registers a call.
+// Returns false once the connection is closed, the call then returns an
+// error or zero value instead of sending requests. Otherwise the caller
+// must call release.
+func (g *connGuard) acquire() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closed {
+		return false
+	}
+	g.calls++
+	return true
+}
+
+// release ends a call registered with acquire
+func (g *connGuard) release() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.calls--
+	if g.calls == 0 && g.idle.L != nil {
+		g.idle.Broadcast()
+	}
+}
+
+// close stops new calls and waits for the running ones.
+// Returns false if the connection was closed before.
+func (g *connGuard) close() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closed {
+		return false
+	}
+	g.closed = true
+	g.idle.L = &g.mutex
+	for g.calls > 0 {
+		g.idle.Wait()
+	}
+	return true
+}
+
+// lost stops new calls on a connection xgb closed itself after a read
+// error. Running calls are not waited for, their replies never arrive.
+func (g *connGuard) lost() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.closed = true
+}
@@ -0,0 +1,71 @@
+package desktop
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+)
+
+func TestConnGuardWaitsForCalls(t *testing.T) {
+	var guard connGuard
+	if !guard.acquire() || !guard.acquire() {
+		t.Fatal("Expected an open guard to admit nested calls")
+	}
+
+	closed := make(chan bool)
+	go func() { closed <- guard.close() }()
+	select {
+	case <-closed:
+		t.Fatal("Expected close to wait for running calls")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	guard.release()
+	guard.release()
+	if !<-closed {
+		t.Error("Expected the first close to report an open connection")
+	}
+	if guard.acquire() {
+		t.Error("Expected no calls after close")
+	}
+	if guard.close() {
+		t.Error("Expected a second close to be a no-op")
+	}
+}
+
+// TestCallsAfterCleanup checks that a manager still held after a reconnect
+// answers with zero values instead of using the closed connection
+func TestCallsAfterCleanup(t *testing.T) {
+	source := &fakeEventSource{events: make(chan xgb.Event), release: make(chan struct{})}
+	close(source.events)
+	close(source.release)
+	wm := &XLibWindowManager{pump: startEventPump(source)}
+
+	// The connection was lost, Cleanup must not close it again
+	if event := wm.AwaitEvent(context.Background()); event.Kind != EventNone {
+		t.Fatalf("Expected no event from a closed connection, got %s", event)
+	}
+	wm.Cleanup()
+
+	if ids := wm.ClientIDs(); ids != nil {
+		t.Errorf("Expected no clients, got %v", ids)
+	}
+	if windows := wm.StackingList(); windows != nil {
+		t.Errorf("Expected no windows, got %v", windows)
+	}
+	if id := wm.ActiveWindowID(); id != 0 {
+		t.Errorf("Expected no active window, got %d", id)
+	}
+	if wm.PingWindow(1) {
+		t.Error("Expected no ping on a closed connection")
+	}
+	if err := wm.CloseWindow(1); !errors.Is(err, errDisplayClosed) {
+		t.Errorf("Expected errDisplayClosed, got %v", err)
+	}
+	if caps := wm.Capabilities(); caps.Has("_NET_CLIENT_LIST") {
+		t.Errorf("Expected no capabilities, got %s", caps)
+	}
+}
@@ -0,0 +1,79 @@
+package desktop
+
+import "github.com/BurntSushi/xgb/xproto"
+
+// PingWindow sends a _NET_WM_PING to a window listing it in WM_PROTOCOLS.
+// The client answers by sending the message back to the root window, which
+// AwaitEvent reports as EventPong. Whether a window supports pings is cached
+// while it is watched.
+// Args:
+//
+//	windowID: The ID of the window to ping.
+//
+// Returns:
+//
+//	bool: True if the ping was sent.
+func (wm *XLibWindowManager) PingWindow(windowID int) bool {
+	if !wm.guard.acquire() {
+		return false
+	}
+	defer wm.guard.release()
+	window := xproto.Window(windowID)
+	if !wm.canPing(window) {
+		return false
+	}
+
+	protocolsAtom := wm.getAtomCached("WM_PROTOCOLS")
+	pingAtom := wm.getAtomCached("_NET_WM_PING")
+	if protocolsAtom == 0 || pingAtom == 0 {
+		return false
+	}
+
+	// EWMH spec for _NET_WM_PING:
+	// data.l[0] = _NET_WM_PING
+	// data.l[1] = timestamp, clients echo it back so CurrentTime will do
+	// data.l[2] = the window being pinged
+	cm := xproto.ClientMessageEvent{
+		Format: 32,
+		Window: window,
+		Type:   protocolsAtom,
+		Data: xproto.ClientMessageDataUnionData32New([]uint32{
+			uint32(pingAtom), xproto.TimeCurrentTime, uint32(window), 0, 0,
+		}),
+	}
+	// Unchecked, a round trip per window would make a round of pings slow.
+	// A window destroyed meanwhile shows up as an X error in AwaitEvent.
+	xproto.SendEvent(wm.display, false, window, xproto.EventMaskNoEvent, string(cm.Bytes()))
+	return true
+}
+
+// canPing checks whether a window supports _NET_WM_PING, caching the
+// answer for watched windows
+func (wm *XLibWindowManager) canPing(window xproto.Window) bool {
+	wm.watchMutex.Lock()
+	supported, known := wm.pingable[window]
+	wm.watchMutex.Unlock()
+	if known {
+		return supported
+	}
+
+	supported = wm.supportsProtocol(window, "_NET_WM_PING")
+	wm.watchMutex.Lock()
+	if wm.watched[window] {
+		wm.pingable[window] = supported
+	}
+	wm.watchMutex.Unlock()
+	return supported
+}
+
+// convertClientMessage converts client messages sent to the root window.
+// Pongs are WM_PROTOCOLS messages carrying _NET_WM_PING and the pinged window.
+func (wm *XLibWindowManager) convertClientMessage(ev xproto.ClientMessageEvent) Event {
+	if ev.Format == 32 && ev.Type == wm.getAtomCached("WM_PROTOCOLS") {
+		data := ev.Data.Data32
+		if len(data) >= 3 && xproto.Atom(data[0]) == wm.getAtomCached("_NET_WM_PING") {
+			return Event{Kind: EventPong, WindowID: int(data[2])}
+		}
+	}
+	return Event{Kind: EventOther}
+}
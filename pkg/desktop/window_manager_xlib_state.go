@@ -0,0 +1,198 @@
+package desktop
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// stateAtomName returns the _NET_WM_STATE_* atom name of a state name
+func stateAtomName(name string) string {
+	return "_NET_WM_STATE_" + strings.ToUpper(name)
+}
+
+// getWindowState reads _NET_WM_STATE and maps its atoms to state flags.
+// Atoms gofi does not know are ignored.
+// Returns the state set, empty if the property is missing.
+func (wm *XLibWindowManager) getWindowState(windowID xproto.Window) shared.WindowState {
+	data := wm.getWindowPropertyBytes(windowID, "_NET_WM_STATE", xproto.AtomAtom)
+	return wm.stateFromBytes(data)
+}
+
+// stateFromBytes maps a _NET_WM_STATE value to state flags
+func (wm *XLibWindowManager) stateFromBytes(data []byte) shared.WindowState {
+	if data == nil {
+		return 0
+	}
+
+	flags := wm.stateFlagsByAtom()
+	var state shared.WindowState
+	for _, atom := range bytesToUint32s(data) {
+		state |= flags[xproto.Atom(atom)]
+	}
+	return state
+}
+
+// stateFlagsByAtom maps every known _NET_WM_STATE_* atom to its flag.
+// Atoms come from the atom cache, so this is cheap after the first call.
+func (wm *XLibWindowManager) stateFlagsByAtom() map[xproto.Atom]shared.WindowState {
+	states := shared.AllWindowStates()
+	flags := make(map[xproto.Atom]shared.WindowState, len(states))
+	for name, flag := range states {
+		if atom := wm.getAtomCached(stateAtomName(name)); atom != 0 {
+			flags[atom] = flag
+		}
+	}
+	return flags
+}
+
+// _NET_WM_STATE client message actions
+const (
+	stateActionRemove = 0
+	stateActionAdd    = 1
+	stateActionToggle = 2
+)
+
+// iconicState is the ICCCM IconicState used with WM_CHANGE_STATE
+const iconicState = 3
+
+// SetWindowState adds or removes _NET_WM_STATE flags of a window.
+// The hidden flag cannot be set through _NET_WM_STATE, so it minimizes
+// the window or activates it again instead.
+// Args:
+//
+//	windowID: The ID of the window.
+//	state: Flags to change.
+//	enabled: True to add the flags, false to remove them.
+//
+// Returns:
+//
+//	error: An error if the window is invalid or a message could not be sent.
+func (wm *XLibWindowManager) SetWindowState(windowID int, state shared.WindowState, enabled bool) error {
+	if !wm.guard.acquire() {
+		return errDisplayClosed
+	}
+	defer wm.guard.release()
+	if state.Has(shared.StateHidden) {
+		if err := wm.setHidden(windowID, enabled); err != nil {
+			return err
+		}
+		state &^= shared.StateHidden
+	}
+	action := uint32(stateActionRemove)
+	if enabled {
+		action = stateActionAdd
+	}
+	return wm.changeWindowState(windowID, action, state)
+}
+
+// ToggleWindowState toggles _NET_WM_STATE flags of a window.
+// Toggling the hidden flag minimizes or activates the window.
+// Args:
+//
+//	windowID: The ID of the window.
+//	state: Flags to toggle.
+//
+// Returns:
+//
+//	error: An error if the window is invalid or a message could not be sent.
+func (wm *XLibWindowManager) ToggleWindowState(windowID int, state shared.WindowState) error {
+	if !wm.guard.acquire() {
+		return errDisplayClosed
+	}
+	defer wm.guard.release()
+	if state.Has(shared.StateHidden) {
+		hidden := wm.getWindowState(xproto.Window(windowID)).Has(shared.StateHidden)
+		if err := wm.setHidden(windowID, !hidden); err != nil {
+			return err
+		}
+		state &^= shared.StateHidden
+	}
+	return wm.changeWindowState(windowID, stateActionToggle, state)
+}
+
+// MinimizeWindow iconifies a window with the ICCCM WM_CHANGE_STATE client message.
+// Args:
+//
+//	windowID: The ID of the window to minimize.
+//
+// Returns:
+//
+//	error: An error if the window is invalid or the message could not be sent.
+func (wm *XLibWindowManager) MinimizeWindow(windowID int) error {
+	if !wm.guard.acquire() {
+		return errDisplayClosed
+	}
+	defer wm.guard.release()
+	window := xproto.Window(windowID)
+	if !wm.isValidWindow(window) {
+		return fmt.Errorf("cannot minimize invalid window ID %d", windowID)
+	}
+	changeAtom := wm.getAtomCached("WM_CHANGE_STATE")
+	if changeAtom == 0 {
+		return fmt.Errorf("could not get WM_CHANGE_STATE atom")
+	}
+	if err := wm.sendClientMessage(window, changeAtom, iconicState); err != nil {
+		return fmt.Errorf("failed to send minimize event: %w", err)
+	}
+	log.Debug("Sent WM_CHANGE_STATE event for window %d", windowID)
+	return nil
+}
+
+// setHidden minimizes a window or activates it to restore it
+func (wm *XLibWindowManager) setHidden(windowID int, hidden bool) error {
+	if hidden {
+		return wm.MinimizeWindow(windowID)
+	}
+	return wm.ActivateWindow(windowID)
+}
+
+// changeWindowState sends _NET_WM_STATE client messages for the given flags.
+// Each message carries up to two properties, so maximized goes out as one message.
+func (wm *XLibWindowManager) changeWindowState(windowID int, action uint32, state shared.WindowState) error {
+	if state == 0 {
+		return nil
+	}
+	window := xproto.Window(windowID)
+	if !wm.isValidWindow(window) {
+		return fmt.Errorf("cannot change state of invalid window ID %d", windowID)
+	}
+	if err := wm.Capabilities().RequireState(state); err != nil {
+		return fmt.Errorf("cannot change state of window %d: %w", windowID, err)
+	}
+	stateAtom := wm.getAtomCached("_NET_WM_STATE")
+	if stateAtom == 0 {
+		return fmt.Errorf("could not get _NET_WM_STATE atom")
+	}
+
+	atoms := wm.stateAtoms(state)
+	for i := 0; i < len(atoms); i += 2 {
+		second := uint32(0)
+		if i+1 < len(atoms) {
+			second = uint32(atoms[i+1])
+		}
+		// data.l[0] = action, data.l[1-2] = properties, data.l[3] = source indication
+		err := wm.sendClientMessage(window, stateAtom, action, uint32(atoms[i]), second, sourcePager)
+		if err != nil {
+			return fmt.Errorf("failed to send _NET_WM_STATE event: %w", err)
+		}
+	}
+	log.Debug("Sent _NET_WM_STATE action %d %v for window %d", action, state.Names(), windowID)
+	return nil
+}
+
+// stateAtoms returns the _NET_WM_STATE_* atoms of all set flags
+func (wm *XLibWindowManager) stateAtoms(state shared.WindowState) []xproto.Atom {
+	names := state.Names()
+	atoms := make([]xproto.Atom, 0, len(names))
+	for _, name := range names {
+		if atom := wm.getAtomCached(stateAtomName(name)); atom != 0 {
+			atoms = append(atoms, atom)
+		}
+	}
+	return atoms
+}
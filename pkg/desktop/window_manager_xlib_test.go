@@ -13,7 +13,7 @@ import (
 
 // setupXLibTest creates a new XLibWindowManager instance for testing
 // Skips the test if X11 display is not available
-func setupXLibTest(t *testing.T) *XLibWindowManager {
+func setupXLibTest(t testing.TB) *XLibWindowManager {
 	if os.Getenv("DISPLAY") == "" {
 		t.Skip("X11 display not available - skipping test")
 	}
@@ -36,6 +36,28 @@ func TestNewXLibWindowManager(t *testing.T) {
 	}
 }
 
+// TestMonitorChangeInvalidatesCache needs no display, the cache is set directly
+func TestMonitorChangeInvalidatesCache(t *testing.T) {
+	wm := &XLibWindowManager{
+		monitors:      []shared.Monitor{{Name: "DP-1", Geometry: shared.Geometry{Width: 1920, Height: 1080}}},
+		monitorsValid: true,
+	}
+	if monitors := wm.Monitors(); len(monitors) != 1 || monitors[0].Name != "DP-1" {
+		t.Fatalf("Expected the cached monitor, got %v", monitors)
+	}
+
+	// A hotplug sends several RandR events, the first one is reported
+	if event := wm.convertMonitorChange(); event.Kind != EventMonitors {
+		t.Errorf("Expected EventMonitors, got %s", event)
+	}
+	if event := wm.convertMonitorChange(); event.Kind != EventOther {
+		t.Errorf("Expected the following events to be coalesced, got %s", event)
+	}
+	if wm.monitorsValid || wm.monitors != nil {
+		t.Error("Expected the cached monitors to be dropped")
+	}
+}
+
 // TestStackingList tests getting the list of windows
 func TestStackingList(t *testing.T) {
 	wm := setupXLibTest(t)
@@ -156,35 +178,12 @@ func TestEventHandling(t *testing.T) {
 	// Test event handling with timeout
 	done := make(chan bool)
 	go func() {
-		eventName := wm.AwaitEvent(ctx)
-		// When cancelled quickly, we expect an empty string.
-		// If an event *did* arrive before cancellation, eventName would be non-empty.
+		event := wm.AwaitEvent(ctx)
+		// When cancelled quickly, we expect no event.
 		// The test primarily verifies that AwaitEvent respects cancellation.
-		if ctx.Err() != nil && eventName != "" {
-			t.Errorf("Expected empty event name on cancellation, got %q", eventName)
+		if ctx.Err() != nil && event.Kind != EventNone {
+			t.Errorf("Expected no event on cancellation, got %s", event)
 		}
-		// If no error (e.g., event arrived before cancel), we could check if eventName is valid
-		// but the rapid cancel makes this unlikely and harder to test reliably.
-		// else if eventName == "" {
-		// 	 t.Error("Expected non-empty event name when no cancellation occurred")
-		// }
-
-		// Original check logic (now adapted for string):
-		/*
-			if eventName != "" {
-				// If we got an event, verify it's a known event type string
-				switch eventName {
-				case "PropertyNotifyEvent",
-					"ConfigureNotifyEvent",
-					"MapNotifyEvent",
-					"UnmapNotifyEvent",
-					"DestroyNotifyEvent":
-					// These are expected event types
-				default:
-					t.Errorf("Unexpected event name: %s", eventName)
-				}
-			}
-		*/
 		done <- true
 	}()
 
@@ -200,3 +199,44 @@ func TestEventHandling(t *testing.T) {
 		t.Fatal("Event handling test timed out")
 	}
 }
+
+// TestSplitNullTerminated tests parsing of _NET_DESKTOP_NAMES values
+func TestSplitNullTerminated(t *testing.T) {
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"", nil},
+		{"mail\x00web\x00", []string{"mail", "web"}},
+		{"mail\x00web", []string{"mail", "web"}},
+		{"\x00web\x00", []string{"", "web"}},
+	}
+
+	for _, tt := range tests {
+		got := splitNullTerminated([]byte(tt.data))
+		if len(got) != len(tt.want) {
+			t.Errorf("splitNullTerminated(%q): got %q, want %q", tt.data, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("splitNullTerminated(%q): got %q, want %q", tt.data, got, tt.want)
+			}
+		}
+	}
+}
+
+// TestCapabilitiesDetection tests that capabilities are consistent with the client list
+func TestCapabilitiesDetection(t *testing.T) {
+	wm := setupXLibTest(t)
+	defer wm.Cleanup()
+
+	caps := wm.Capabilities()
+	t.Logf("Window manager: %s", caps)
+	if caps.WindowManager == "" && len(caps.Supported) != 0 {
+		t.Errorf("Expected no supported atoms without a window manager, got %v", caps.Supported)
+	}
+	if !caps.Has("_NET_ACTIVE_WINDOW") && wm.ActiveWindowID() != 0 {
+		t.Error("Expected no active window without _NET_ACTIVE_WINDOW support")
+	}
+}
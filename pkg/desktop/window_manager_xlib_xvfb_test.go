@@ -0,0 +1,214 @@
+package desktop
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"gofi/pkg/desktop/xtest"
+)
+
+// setupXvfbTest starts Xvfb with a fake window manager announcing the
+// given atoms and connects an XLibWindowManager to it.
+// Skips the test if Xvfb is not installed.
+func setupXvfbTest(t testing.TB, supported ...string) (*XLibWindowManager, *xtest.Server) {
+	server := xtest.StartXvfb(t)
+	xtest.StartFakeWM(t, server, supported...)
+
+	wm, err := NewXLibWindowManager()
+	if err != nil {
+		t.Fatalf("Failed to connect to Xvfb: %v", err)
+	}
+	t.Cleanup(wm.Cleanup)
+	return wm, server
+}
+
+// listed reports whether ClientIDs contains a window
+func listed(wm *XLibWindowManager, windowID int) bool {
+	return slices.Contains(wm.ClientIDs(), windowID)
+}
+
+func TestXvfbStackingList(t *testing.T) {
+	wm, server := setupXvfbTest(t)
+	terminal := xtest.NewClient(t, server, xtest.ClientOptions{
+		Title: "Terminal", Instance: "st", Class: "st-256color", PID: 4242,
+	})
+	browser := xtest.NewClient(t, server, xtest.ClientOptions{
+		Title: "News - Firefox", Instance: "Navigator", Class: "firefox", PID: 4343,
+	})
+	xtest.WaitFor(t, "both clients to be listed", func() bool {
+		return listed(wm, terminal.ID()) && listed(wm, browser.ID())
+	})
+
+	caps := wm.Capabilities()
+	if caps.WindowManager != xtest.FakeWMName || !caps.Has("_NET_CLIENT_LIST", "_NET_ACTIVE_WINDOW") {
+		t.Errorf("Expected the fake window manager with a client list, got %s", caps)
+	}
+
+	windows := wm.StackingList()
+	if len(windows) != 2 {
+		t.Fatalf("Expected 2 windows, got %d", len(windows))
+	}
+	want := map[int][4]string{
+		terminal.ID(): {"Terminal", "st", "st-256color", "4242"},
+		browser.ID():  {"News - Firefox", "Navigator", "firefox", "4343"},
+	}
+	for _, w := range windows {
+		expected := want[w.ID]
+		got := [4]string{w.Title, w.Instance, w.ClassName, strconv.Itoa(w.PID)}
+		if got != expected {
+			t.Errorf("Window %d: expected %v, got %v", w.ID, expected, got)
+		}
+		if w.Desktop != 0 {
+			t.Errorf("Window %d: expected desktop 0, got %d", w.ID, w.Desktop)
+		}
+	}
+
+	// The window mapped last gets the focus
+	if active := wm.ActiveWindowID(); active != browser.ID() {
+		t.Errorf("Expected window %d to be active, got %d", browser.ID(), active)
+	}
+	if order := wm.StackingOrder(); !slices.Equal(order, []int{terminal.ID(), browser.ID()}) {
+		t.Errorf("Expected stacking order [%d %d], got %v", terminal.ID(), browser.ID(), order)
+	}
+}
+
+func TestXvfbActivateAndMove(t *testing.T) {
+	wm, server := setupXvfbTest(t)
+	terminal := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Terminal", Instance: "st", Class: "st"})
+	editor := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Editor", Instance: "code", Class: "Code"})
+
+	if err := wm.ActivateWindow(terminal.ID()); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the terminal to become active", func() bool {
+		return wm.ActiveWindowID() == terminal.ID()
+	})
+
+	if err := wm.MoveWindowToDesktop(editor.ID(), 2); err != nil {
+		t.Fatalf("MoveWindowToDesktop failed: %v", err)
+	}
+	xtest.WaitFor(t, "the editor to move to desktop 2", func() bool {
+		return wm.WindowDesktop(editor.ID()) == 2
+	})
+	if current := wm.CurrentDesktop(); current != 0 {
+		t.Errorf("Moving a window switched to desktop %d", current)
+	}
+
+	// Activating a window on another desktop switches there first
+	if err := wm.ActivateWindow(editor.ID()); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the editor to become active on desktop 2", func() bool {
+		return wm.ActiveWindowID() == editor.ID() && wm.CurrentDesktop() == 2
+	})
+}
+
+func TestXvfbCloseWindow(t *testing.T) {
+	wm, server := setupXvfbTest(t)
+	polite := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Polite", Instance: "polite", Class: "Polite"})
+	hung := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Hung", Instance: "hung", Class: "Hung", Hung: true})
+
+	if err := wm.CloseWindow(polite.ID()); err != nil {
+		t.Fatalf("CloseWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the polite window to close", func() bool {
+		return polite.Closed() && !listed(wm, polite.ID())
+	})
+
+	// The hung window ignores WM_DELETE_WINDOW and is killed after the timeout
+	options := CloseOptions{Timeout: 200 * time.Millisecond, KillOnTimeout: true}
+	if err := CloseOrKillWindow(wm, hung.ID(), options); err != nil {
+		t.Fatalf("CloseOrKillWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the hung window to be killed", func() bool {
+		return hung.Closed() && !listed(wm, hung.ID())
+	})
+	if active := wm.ActiveWindowID(); active != 0 {
+		t.Errorf("Expected no active window, got %d", active)
+	}
+}
+
+func TestXvfbEvents(t *testing.T) {
+	wm, server := setupXvfbTest(t)
+	if !wm.InitEvents() {
+		t.Fatal("InitEvents failed")
+	}
+
+	client := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Terminal", Instance: "st", Class: "st"})
+	awaitXvfbEvent(t, wm, "_NET_CLIENT_LIST", 0)
+	awaitXvfbEvent(t, wm, "_NET_ACTIVE_WINDOW", 0)
+
+	// Listed windows are watched for property changes
+	wm.StackingList()
+	client.SetTitle("vim")
+	awaitXvfbEvent(t, wm, "_NET_WM_NAME", client.ID())
+	if title := wm.WindowTitle(client.ID()); title != "vim" {
+		t.Errorf("Expected title vim, got %q", title)
+	}
+
+	ping := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Ping", Instance: "ping", Class: "Ping"})
+	wm.StackingList()
+	if !wm.PingWindow(ping.ID()) {
+		t.Fatal("Expected the client to support pings")
+	}
+	deadline := time.Now().Add(xtest.Timeout)
+	for time.Now().Before(deadline) {
+		if event := nextXvfbEvent(t, wm); event.Kind == EventPong && event.WindowID == ping.ID() {
+			return
+		}
+	}
+	t.Errorf("No pong from window %d", ping.ID())
+}
+
+// awaitXvfbEvent reads events until a property event for an atom arrives.
+// A windowID of 0 matches any window.
+func awaitXvfbEvent(t *testing.T, wm *XLibWindowManager, atom string, windowID int) {
+	t.Helper()
+	deadline := time.Now().Add(xtest.Timeout)
+	for time.Now().Before(deadline) {
+		event := nextXvfbEvent(t, wm)
+		if event.Kind == EventProperty && event.Atom == atom && (windowID == 0 || event.WindowID == windowID) {
+			return
+		}
+	}
+	t.Fatalf("No %s event for window %d", atom, windowID)
+}
+
+// nextXvfbEvent waits for the next event, failing the test after xtest.Timeout
+func nextXvfbEvent(t *testing.T, wm *XLibWindowManager) Event {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), xtest.Timeout)
+	defer cancel()
+	event := wm.AwaitEvent(ctx)
+	if event.Kind == EventNone {
+		t.Fatal("No event within the timeout")
+	}
+	return event
+}
+
+func TestXvfbFallback(t *testing.T) {
+	// A window manager announcing neither a client list nor an active window
+	wm, server := setupXvfbTest(t, "_NET_NUMBER_OF_DESKTOPS", "_NET_CURRENT_DESKTOP", "_NET_WM_DESKTOP")
+	first := xtest.NewClient(t, server, xtest.ClientOptions{Title: "First", Instance: "first", Class: "First"})
+	second := xtest.NewClient(t, server, xtest.ClientOptions{Title: "Second", Instance: "second", Class: "Second"})
+
+	if !wm.fallbackClients() || !wm.fallbackFocus() {
+		t.Fatalf("Expected fallback mode, got %s", wm.Capabilities())
+	}
+	xtest.WaitFor(t, "the window tree to list both clients", func() bool {
+		return slices.Equal(wm.ClientIDs(), []int{first.ID(), second.ID()})
+	})
+	xtest.WaitFor(t, "the focused client to be active", func() bool {
+		return wm.ActiveWindowID() == second.ID()
+	})
+
+	if err := wm.ActivateWindow(first.ID()); err != nil {
+		t.Fatalf("ActivateWindow failed: %v", err)
+	}
+	xtest.WaitFor(t, "the first client to be focused and raised", func() bool {
+		return wm.ActiveWindowID() == first.ID() && slices.Equal(wm.StackingOrder(), []int{second.ID(), first.ID()})
+	})
+}
@@ -0,0 +1,210 @@
+package xtest
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// ClientOptions describes a client window
+// Fields:
+//
+//	Title: WM_NAME and _NET_WM_NAME
+//	Instance: Instance part of WM_CLASS
+//	Class: Class part of WM_CLASS
+//	PID: _NET_WM_PID, together with WM_CLIENT_MACHINE of this host, unset if 0
+//	Hung: Ignore WM_DELETE_WINDOW and pings like an application that hangs
+//	Busy: Ignore WM_DELETE_WINDOW but answer pings, like an application asking to save
+type ClientOptions struct {
+	Title    string
+	Instance string
+	Class    string
+	PID      int
+	Hung     bool
+	Busy     bool
+}
+
+// Client is a client window on its own connection, like an application.
+// It takes part in WM_DELETE_WINDOW, destroying its window, and answers
+// _NET_WM_PING unless it is hung. A busy client only answers pings.
+type Client struct {
+	conn       *xgb.Conn
+	window     xproto.Window
+	root       xproto.Window
+	atoms      *atomTable
+	hung       bool
+	busy       bool
+	mapped     chan struct{}
+	mappedOnce sync.Once
+	closed     chan struct{} // Closed when the window or the connection is gone
+	closedOnce sync.Once
+	done       chan struct{} // Closed when the event loop ended
+}
+
+// NewClient creates and maps a client window, waiting until it is mapped.
+// The connection is closed when the test ends.
+// Args:
+//
+//	t: The test using the window
+//	server: Server to connect to
+//	options: Properties of the window
+//
+// Returns:
+//
+//	*Client: The mapped client
+func NewClient(t testing.TB, server *Server, options ClientOptions) *Client {
+	t.Helper()
+	conn, err := xgb.NewConnDisplay(server.Display)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", server.Display, err)
+	}
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	client := &Client{
+		conn:   conn,
+		root:   screen.Root,
+		atoms:  newAtomTable(conn),
+		hung:   options.Hung,
+		busy:   options.Busy,
+		mapped: make(chan struct{}),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go client.run()
+	t.Cleanup(client.stop)
+
+	client.window, err = xproto.NewWindowId(conn)
+	if err != nil {
+		t.Fatalf("Failed to allocate a window: %v", err)
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, client.window, screen.Root,
+		0, 0, 400, 300, 0, xproto.WindowClassInputOutput, screen.RootVisual,
+		xproto.CwEventMask, []uint32{xproto.EventMaskStructureNotify}).Check()
+	if err != nil {
+		t.Fatalf("Failed to create window %q: %v", options.Title, err)
+	}
+	client.setProperties(options)
+
+	xproto.MapWindow(conn, client.window)
+	select {
+	case <-client.mapped:
+	case <-time.After(Timeout):
+		t.Fatalf("Window %q was not mapped within %s", options.Title, Timeout)
+	}
+	return client
+}
+
+// setProperties sets the ICCCM and EWMH properties of the window
+func (c *Client) setProperties(options ClientOptions) {
+	c.setTitle(options.Title)
+	setString(c.conn, c.window, xproto.AtomWmClass, xproto.AtomString,
+		options.Instance+"\x00"+options.Class+"\x00")
+	setUint32s(c.conn, c.window, c.atoms.get("WM_PROTOCOLS"), xproto.AtomAtom,
+		uint32(c.atoms.get("WM_DELETE_WINDOW")), uint32(c.atoms.get("_NET_WM_PING")))
+
+	if options.PID > 0 {
+		setUint32s(c.conn, c.window, c.atoms.get("_NET_WM_PID"), xproto.AtomCardinal, uint32(options.PID))
+		if hostname, err := os.Hostname(); err == nil {
+			setString(c.conn, c.window, xproto.AtomWmClientMachine, xproto.AtomString, hostname)
+		}
+	}
+}
+
+func (c *Client) setTitle(title string) {
+	setString(c.conn, c.window, xproto.AtomWmName, xproto.AtomString, title)
+	setString(c.conn, c.window, c.atoms.get("_NET_WM_NAME"), c.atoms.get("UTF8_STRING"), title)
+}
+
+// run handles events until the connection is closed
+func (c *Client) run() {
+	defer close(c.done)
+	for {
+		event, err := c.conn.WaitForEvent()
+		if event == nil && err == nil {
+			c.markClosed() // Closed, or killed with XKillClient
+			return
+		}
+		switch ev := event.(type) {
+		case xproto.MapNotifyEvent:
+			if ev.Window == c.window {
+				c.mappedOnce.Do(func() { close(c.mapped) })
+			}
+		case xproto.DestroyNotifyEvent:
+			if ev.Window == c.window {
+				c.markClosed()
+			}
+		case xproto.ClientMessageEvent:
+			c.handleProtocol(ev)
+		}
+	}
+}
+
+// handleProtocol answers WM_PROTOCOLS messages unless hung
+func (c *Client) handleProtocol(ev xproto.ClientMessageEvent) {
+	data := ev.Data.Data32
+	if c.hung || ev.Format != 32 || ev.Type != c.atoms.get("WM_PROTOCOLS") || len(data) < 5 {
+		return
+	}
+
+	switch xproto.Atom(data[0]) {
+	case c.atoms.get("WM_DELETE_WINDOW"):
+		if !c.busy {
+			xproto.DestroyWindow(c.conn, c.window)
+		}
+	case c.atoms.get("_NET_WM_PING"):
+		// The pong is the ping sent back to the root window
+		pong := clientMessage(c.root, ev.Type, data...)
+		mask := uint32(xproto.EventMaskSubstructureNotify | xproto.EventMaskSubstructureRedirect)
+		xproto.SendEvent(c.conn, false, c.root, mask, pong)
+	}
+}
+
+func (c *Client) markClosed() {
+	c.closedOnce.Do(func() { close(c.closed) })
+}
+
+// stop closes the connection, destroying the window
+func (c *Client) stop() {
+	select {
+	case <-c.done:
+		return // Killed, xgb closed the connection itself
+	default:
+	}
+	c.conn.Close()
+	<-c.done
+}
+
+// sync waits until the server processed all requests sent so far
+func (c *Client) sync() {
+	xproto.GetInputFocus(c.conn).Reply()
+}
+
+// ID returns the window ID as used by gofi
+func (c *Client) ID() int {
+	return int(c.window)
+}
+
+// SetTitle changes WM_NAME and _NET_WM_NAME
+func (c *Client) SetTitle(title string) {
+	c.setTitle(title)
+	c.sync()
+}
+
+// Destroy destroys the window, like an application quitting
+func (c *Client) Destroy() {
+	xproto.DestroyWindow(c.conn, c.window)
+	c.sync()
+}
+
+// Closed reports whether the window was destroyed or its connection killed
+func (c *Client) Closed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,366 @@
+package xtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// FakeWMName is the _NET_WM_NAME of the fake window manager
+const FakeWMName = "fakewm"
+
+// FakeWMDesktops is the number of desktops of the fake window manager
+const FakeWMDesktops = 4
+
+// ICCCM WM_STATE values
+const (
+	withdrawnState = 0
+	normalState    = 1
+)
+
+// DefaultSupported lists the atoms the fake window manager announces in
+// _NET_SUPPORTED unless StartFakeWM is given others
+var DefaultSupported = []string{
+	"_NET_CLIENT_LIST",
+	"_NET_CLIENT_LIST_STACKING",
+	"_NET_ACTIVE_WINDOW",
+	"_NET_NUMBER_OF_DESKTOPS",
+	"_NET_DESKTOP_NAMES",
+	"_NET_CURRENT_DESKTOP",
+	"_NET_WM_DESKTOP",
+	"_NET_CLOSE_WINDOW",
+}
+
+// FakeWM is a minimal EWMH window manager. It neither reparents nor hides
+// windows of other desktops. Mapped windows become clients on the current
+// desktop and get the focus. _NET_CLIENT_LIST, _NET_CLIENT_LIST_STACKING,
+// _NET_ACTIVE_WINDOW, _NET_CURRENT_DESKTOP and _NET_WM_DESKTOP are kept up
+// to date and the client messages to activate, close and move windows and
+// to switch desktops are honored. The properties are maintained whatever
+// _NET_SUPPORTED announces.
+type FakeWM struct {
+	conn     *xgb.Conn
+	root     xproto.Window
+	atoms    *atomTable
+	clients  []xproto.Window // In mapping order
+	stacking []xproto.Window // Bottom to top
+	active   xproto.Window
+	current  uint32
+	mutex    sync.Mutex
+	done     chan struct{} // Closed when the event loop ended
+}
+
+// StartFakeWM starts a fake window manager on a server, stopped when the
+// test ends
+// Args:
+//
+//	t: The test using the window manager
+//	server: Server to manage
+//	supported: Atoms to announce in _NET_SUPPORTED, DefaultSupported if none
+//
+// Returns:
+//
+//	*FakeWM: The running window manager
+func StartFakeWM(t testing.TB, server *Server, supported ...string) *FakeWM {
+	t.Helper()
+	if len(supported) == 0 {
+		supported = DefaultSupported
+	}
+
+	conn, err := xgb.NewConnDisplay(server.Display)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", server.Display, err)
+	}
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	wm := &FakeWM{
+		conn:  conn,
+		root:  screen.Root,
+		atoms: newAtomTable(conn),
+		done:  make(chan struct{}),
+	}
+
+	// Only one client can redirect the children of the root window, which
+	// makes it the window manager
+	mask := uint32(xproto.EventMaskSubstructureRedirect | xproto.EventMaskSubstructureNotify)
+	if err := xproto.ChangeWindowAttributesChecked(conn, wm.root, xproto.CwEventMask, []uint32{mask}).Check(); err != nil {
+		conn.Close()
+		t.Fatalf("Failed to become the window manager: %v", err)
+	}
+	if err := wm.announce(screen, supported); err != nil {
+		conn.Close()
+		t.Fatalf("Failed to announce the window manager: %v", err)
+	}
+
+	go wm.run()
+	t.Cleanup(wm.stop)
+	return wm
+}
+
+// announce creates the supporting WM check window and sets the root
+// window properties
+func (wm *FakeWM) announce(screen *xproto.ScreenInfo, supported []string) error {
+	check, err := xproto.NewWindowId(wm.conn)
+	if err != nil {
+		return err
+	}
+	err = xproto.CreateWindowChecked(wm.conn, 0, check, wm.root, -1, -1, 1, 1, 0,
+		xproto.WindowClassInputOnly, screen.RootVisual, 0, nil).Check()
+	if err != nil {
+		return fmt.Errorf("failed to create check window: %w", err)
+	}
+
+	utf8 := wm.atoms.get("UTF8_STRING")
+	checkAtom := wm.atoms.get("_NET_SUPPORTING_WM_CHECK")
+	setWindows(wm.conn, check, checkAtom, []xproto.Window{check})
+	setString(wm.conn, check, wm.atoms.get("_NET_WM_NAME"), utf8, FakeWMName)
+
+	atoms := make([]uint32, 0, len(supported))
+	for _, name := range supported {
+		atoms = append(atoms, uint32(wm.atoms.get(name)))
+	}
+	setUint32s(wm.conn, wm.root, wm.atoms.get("_NET_SUPPORTED"), xproto.AtomAtom, atoms...)
+	setUint32s(wm.conn, wm.root, wm.atoms.get("_NET_NUMBER_OF_DESKTOPS"), xproto.AtomCardinal, FakeWMDesktops)
+	setUint32s(wm.conn, wm.root, wm.atoms.get("_NET_CURRENT_DESKTOP"), xproto.AtomCardinal, 0)
+
+	var names strings.Builder
+	for i := 1; i <= FakeWMDesktops; i++ {
+		fmt.Fprintf(&names, "%d\x00", i)
+	}
+	setString(wm.conn, wm.root, wm.atoms.get("_NET_DESKTOP_NAMES"), utf8, names.String())
+
+	wm.mutex.Lock()
+	wm.publish()
+	wm.mutex.Unlock()
+	setWindows(wm.conn, wm.root, checkAtom, []xproto.Window{check})
+
+	// A round trip, the properties are in place once StartFakeWM returns
+	_, err = xproto.GetInputFocus(wm.conn).Reply()
+	return err
+}
+
+// run handles events until the connection is closed
+func (wm *FakeWM) run() {
+	defer close(wm.done)
+	for {
+		event, err := wm.conn.WaitForEvent()
+		if event == nil && err == nil {
+			return
+		}
+		if err != nil {
+			continue // Usually a request on a window that vanished meanwhile
+		}
+		wm.handleEvent(event)
+	}
+}
+
+// stop closes the connection, the server destroys the check window
+func (wm *FakeWM) stop() {
+	wm.conn.Close()
+	<-wm.done
+}
+
+func (wm *FakeWM) handleEvent(event xgb.Event) {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+
+	switch ev := event.(type) {
+	case xproto.MapRequestEvent:
+		wm.manage(ev.Window)
+	case xproto.ConfigureRequestEvent:
+		wm.configure(ev)
+	case xproto.UnmapNotifyEvent:
+		if wm.unmanage(ev.Window) {
+			stateAtom := wm.atoms.get("WM_STATE")
+			setUint32s(wm.conn, ev.Window, stateAtom, stateAtom, withdrawnState, 0)
+		}
+	case xproto.DestroyNotifyEvent:
+		wm.unmanage(ev.Window)
+	case xproto.ClientMessageEvent:
+		wm.handleClientMessage(ev)
+	}
+}
+
+// manage maps a window and makes it the active client
+func (wm *FakeWM) manage(window xproto.Window) {
+	if indexOf(wm.clients, window) < 0 {
+		desktopAtom := wm.atoms.get("_NET_WM_DESKTOP")
+		if getUint32s(wm.conn, window, desktopAtom, xproto.AtomCardinal) == nil {
+			setUint32s(wm.conn, window, desktopAtom, xproto.AtomCardinal, wm.current)
+		}
+		stateAtom := wm.atoms.get("WM_STATE")
+		setUint32s(wm.conn, window, stateAtom, stateAtom, normalState, 0)
+		wm.clients = append(wm.clients, window)
+		wm.stacking = append(wm.stacking, window)
+	}
+	xproto.MapWindow(wm.conn, window)
+	wm.focus(window)
+}
+
+// unmanage forgets a client, the topmost remaining one gets the focus if
+// it was active.
+// Returns true if the window was a client.
+func (wm *FakeWM) unmanage(window xproto.Window) bool {
+	i := indexOf(wm.clients, window)
+	if i < 0 {
+		return false
+	}
+	wm.clients = append(wm.clients[:i], wm.clients[i+1:]...)
+	if i := indexOf(wm.stacking, window); i >= 0 {
+		wm.stacking = append(wm.stacking[:i], wm.stacking[i+1:]...)
+	}
+
+	if wm.active != window {
+		wm.publish()
+		return true
+	}
+	var next xproto.Window
+	if len(wm.stacking) > 0 {
+		next = wm.stacking[len(wm.stacking)-1]
+	}
+	wm.focus(next)
+	return true
+}
+
+// configure grants a configure request as it is
+func (wm *FakeWM) configure(ev xproto.ConfigureRequestEvent) {
+	var values []uint32
+	fields := []struct {
+		flag  uint16
+		value uint32
+	}{
+		{xproto.ConfigWindowX, uint32(ev.X)},
+		{xproto.ConfigWindowY, uint32(ev.Y)},
+		{xproto.ConfigWindowWidth, uint32(ev.Width)},
+		{xproto.ConfigWindowHeight, uint32(ev.Height)},
+		{xproto.ConfigWindowBorderWidth, uint32(ev.BorderWidth)},
+		{xproto.ConfigWindowSibling, uint32(ev.Sibling)},
+		{xproto.ConfigWindowStackMode, uint32(ev.StackMode)},
+	}
+	for _, field := range fields {
+		if ev.ValueMask&field.flag != 0 {
+			values = append(values, field.value)
+		}
+	}
+	xproto.ConfigureWindow(wm.conn, ev.Window, ev.ValueMask, values)
+}
+
+// focus raises a client and gives it the input focus, 0 leaves no window active
+func (wm *FakeWM) focus(window xproto.Window) {
+	wm.active = window
+	if window != 0 {
+		xproto.ConfigureWindow(wm.conn, window, xproto.ConfigWindowStackMode, []uint32{xproto.StackModeAbove})
+		xproto.SetInputFocus(wm.conn, xproto.InputFocusPointerRoot, window, xproto.TimeCurrentTime)
+		if i := indexOf(wm.stacking, window); i >= 0 {
+			wm.stacking = append(append(wm.stacking[:i], wm.stacking[i+1:]...), window)
+		}
+	} else {
+		xproto.SetInputFocus(wm.conn, xproto.InputFocusPointerRoot, xproto.InputFocusPointerRoot, xproto.TimeCurrentTime)
+	}
+	wm.publish()
+}
+
+// publish sets the client lists and the active window on the root window
+func (wm *FakeWM) publish() {
+	setWindows(wm.conn, wm.root, wm.atoms.get("_NET_CLIENT_LIST"), wm.clients)
+	setWindows(wm.conn, wm.root, wm.atoms.get("_NET_CLIENT_LIST_STACKING"), wm.stacking)
+	setWindows(wm.conn, wm.root, wm.atoms.get("_NET_ACTIVE_WINDOW"), []xproto.Window{wm.active})
+}
+
+// handleClientMessage honors the EWMH requests of pagers and clients
+func (wm *FakeWM) handleClientMessage(ev xproto.ClientMessageEvent) {
+	data := ev.Data.Data32
+	if ev.Format != 32 || len(data) < 5 {
+		return
+	}
+	managed := indexOf(wm.clients, ev.Window) >= 0
+
+	switch ev.Type {
+	case wm.atoms.get("_NET_ACTIVE_WINDOW"):
+		if !managed {
+			return
+		}
+		desktop := getUint32s(wm.conn, ev.Window, wm.atoms.get("_NET_WM_DESKTOP"), xproto.AtomCardinal)
+		if len(desktop) > 0 {
+			wm.switchDesktop(desktop[0])
+		}
+		wm.focus(ev.Window)
+	case wm.atoms.get("_NET_CLOSE_WINDOW"):
+		if managed {
+			wm.close(ev.Window)
+		}
+	case wm.atoms.get("_NET_CURRENT_DESKTOP"):
+		wm.switchDesktop(data[0])
+	case wm.atoms.get("_NET_WM_DESKTOP"):
+		if managed {
+			setUint32s(wm.conn, ev.Window, wm.atoms.get("_NET_WM_DESKTOP"), xproto.AtomCardinal, data[0])
+		}
+	}
+}
+
+// switchDesktop changes the current desktop, sticky and unknown desktops are ignored
+func (wm *FakeWM) switchDesktop(desktop uint32) {
+	if desktop >= FakeWMDesktops || desktop == wm.current {
+		return
+	}
+	wm.current = desktop
+	setUint32s(wm.conn, wm.root, wm.atoms.get("_NET_CURRENT_DESKTOP"), xproto.AtomCardinal, desktop)
+}
+
+// close asks a client to close with WM_DELETE_WINDOW, clients not taking
+// part in the protocol are killed
+func (wm *FakeWM) close(window xproto.Window) {
+	protocolsAtom := wm.atoms.get("WM_PROTOCOLS")
+	deleteAtom := wm.atoms.get("WM_DELETE_WINDOW")
+	for _, protocol := range getUint32s(wm.conn, window, protocolsAtom, xproto.AtomAtom) {
+		if xproto.Atom(protocol) == deleteAtom {
+			message := clientMessage(window, protocolsAtom, uint32(deleteAtom), xproto.TimeCurrentTime)
+			xproto.SendEvent(wm.conn, false, window, xproto.EventMaskNoEvent, message)
+			return
+		}
+	}
+	xproto.KillClient(wm.conn, uint32(window))
+}
+
+// Clients returns the client windows in mapping order
+func (wm *FakeWM) Clients() []int {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	return windowIDs(wm.clients)
+}
+
+// Active returns the active client window, 0 if none
+func (wm *FakeWM) Active() int {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	return int(wm.active)
+}
+
+// CurrentDesktop returns the current desktop
+func (wm *FakeWM) CurrentDesktop() int {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	return int(wm.current)
+}
+
+// indexOf returns the position of a window in a list, -1 if missing
+func indexOf(windows []xproto.Window, window xproto.Window) int {
+	for i, w := range windows {
+		if w == window {
+			return i
+		}
+	}
+	return -1
+}
+
+// windowIDs converts windows to the int IDs used by gofi
+func windowIDs(windows []xproto.Window) []int {
+	ids := make([]int, len(windows))
+	for i, window := range windows {
+		ids[i] = int(window)
+	}
+	return ids
+}
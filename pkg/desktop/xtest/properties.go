@@ -0,0 +1,92 @@
+package xtest
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// atomTable interns atoms of a connection on first use
+type atomTable struct {
+	conn  *xgb.Conn
+	atoms map[string]xproto.Atom
+	mutex sync.Mutex
+}
+
+func newAtomTable(conn *xgb.Conn) *atomTable {
+	return &atomTable{conn: conn, atoms: make(map[string]xproto.Atom)}
+}
+
+// get returns the atom of a name, 0 if it cannot be interned
+func (a *atomTable) get(name string) xproto.Atom {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if atom, ok := a.atoms[name]; ok {
+		return atom
+	}
+	reply, err := xproto.InternAtom(a.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0
+	}
+	a.atoms[name] = reply.Atom
+	return reply.Atom
+}
+
+// uint32Bytes encodes values for a format 32 property
+func uint32Bytes(values []uint32) []byte {
+	data := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], value)
+	}
+	return data
+}
+
+// setUint32s replaces a format 32 property of a window
+func setUint32s(conn *xgb.Conn, window xproto.Window, property, propertyType xproto.Atom, values ...uint32) {
+	xproto.ChangeProperty(conn, xproto.PropModeReplace, window, property, propertyType,
+		32, uint32(len(values)), uint32Bytes(values))
+}
+
+// setWindows replaces a WINDOW list property of a window
+func setWindows(conn *xgb.Conn, window xproto.Window, property xproto.Atom, windows []xproto.Window) {
+	values := make([]uint32, len(windows))
+	for i, w := range windows {
+		values[i] = uint32(w)
+	}
+	setUint32s(conn, window, property, xproto.AtomWindow, values...)
+}
+
+// setString replaces a format 8 property of a window
+func setString(conn *xgb.Conn, window xproto.Window, property, propertyType xproto.Atom, value string) {
+	xproto.ChangeProperty(conn, xproto.PropModeReplace, window, property, propertyType,
+		8, uint32(len(value)), []byte(value))
+}
+
+// getUint32s reads a format 32 property of a window, nil if it is missing
+func getUint32s(conn *xgb.Conn, window xproto.Window, property, propertyType xproto.Atom) []uint32 {
+	reply, err := xproto.GetProperty(conn, false, window, property, propertyType, 0, 1024).Reply()
+	if err != nil || reply.Format != 32 {
+		return nil
+	}
+	values := make([]uint32, len(reply.Value)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(reply.Value[4*i:])
+	}
+	return values
+}
+
+// clientMessage builds a format 32 client message about a window
+func clientMessage(window xproto.Window, messageType xproto.Atom, data ...uint32) string {
+	fields := make([]uint32, 5)
+	copy(fields, data)
+	message := xproto.ClientMessageEvent{
+		Format: 32,
+		Window: window,
+		Type:   messageType,
+		Data:   xproto.ClientMessageDataUnionData32New(fields),
+	}
+	return string(message.Bytes())
+}
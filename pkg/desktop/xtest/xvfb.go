@@ -0,0 +1,134 @@
+// Package xtest runs X11 integration tests against a headless Xvfb server.
+// StartXvfb starts a server on a free display, StartFakeWM manages it with a
+// minimal EWMH window manager and NewClient opens client windows with
+// titles, classes and PIDs. Tests are skipped where Xvfb is not installed.
+package xtest
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+)
+
+const (
+	// startTimeout is how long Xvfb gets to report its display
+	startTimeout = 10 * time.Second
+	// Timeout is how long WaitFor polls before failing the test
+	Timeout = 5 * time.Second
+	// pollInterval is how often WaitFor checks its condition
+	pollInterval = 10 * time.Millisecond
+)
+
+// Server is a running Xvfb server
+type Server struct {
+	Display string // Display name, e.g. ":42"
+	cmd     *exec.Cmd
+}
+
+// StartXvfb starts Xvfb on a free display and points DISPLAY at it for the
+// rest of the test. The server is stopped when the test ends.
+// Skips the test if Xvfb is not installed.
+// Args:
+//
+//	t: The test using the server
+//
+// Returns:
+//
+//	*Server: The running server
+func StartXvfb(t testing.TB) *Server {
+	t.Helper()
+	path, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb not installed - skipping test")
+	}
+
+	// Xvfb picks a free display and writes its number to the -displayfd
+	// pipe once it accepts connections
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create display pipe: %v", err)
+	}
+	defer reader.Close()
+
+	// -noreset keeps root properties when the last client disconnects
+	cmd := exec.Command(path, "-displayfd", "3", "-screen", "0", "1280x1024x24", "-nolisten", "tcp", "-noreset")
+	cmd.ExtraFiles = []*os.File{writer}
+	if err := cmd.Start(); err != nil {
+		writer.Close()
+		t.Fatalf("Failed to start Xvfb: %v", err)
+	}
+	writer.Close()
+
+	server := &Server{cmd: cmd}
+	t.Cleanup(server.stop)
+
+	display := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(reader).ReadString('\n')
+		display <- strings.TrimSpace(line)
+	}()
+	select {
+	case number := <-display:
+		if _, err := strconv.Atoi(number); err != nil {
+			t.Fatalf("Xvfb did not report a display: %q", number)
+		}
+		server.Display = ":" + number
+	case <-time.After(startTimeout):
+		t.Fatalf("Xvfb did not start within %s", startTimeout)
+	}
+
+	t.Setenv("DISPLAY", server.Display)
+	return server
+}
+
+// stop terminates the server and waits for it to exit
+func (s *Server) stop() {
+	if s.cmd.Process == nil {
+		return
+	}
+	s.cmd.Process.Signal(syscall.SIGTERM)
+	s.cmd.Wait()
+}
+
+// Connect opens a connection to the server, closed when the test ends
+// Args:
+//
+//	t: The test using the connection
+//
+// Returns:
+//
+//	*xgb.Conn: The connection
+func (s *Server) Connect(t testing.TB) *xgb.Conn {
+	t.Helper()
+	conn, err := xgb.NewConnDisplay(s.Display)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", s.Display, err)
+	}
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+// WaitFor polls a condition until it holds, failing the test after Timeout.
+// The window manager and clients handle requests asynchronously.
+// Args:
+//
+//	t: The waiting test
+//	what: Description of the condition for the failure message
+//	condition: Function reporting whether the condition holds
+func WaitFor(t testing.TB, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out after %s waiting for %s", Timeout, what)
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,67 @@
+package gofi
+
+import (
+	"fmt"
+	"strconv"
+
+	"gofi/pkg/daemon"
+	"gofi/pkg/shared"
+)
+
+// RunAction performs a window action through the running daemon.
+// Used by the command line and the selector key bindings.
+// Args:
+//
+//	action: "activate", "minimize", "close", "kill", "pull", "send" or a state
+//	        name to toggle, e.g. "maximized"
+//	window: Window ID, decimal or 0x prefixed hex
+//	desktop: Target desktop of "send", ignored by other actions
+//
+// Returns:
+//
+//	error: Error if the arguments are invalid or the daemon call failed
+func RunAction(action, window string, desktop int) error {
+	windowID, err := parseWindowID(window)
+	if err != nil {
+		return err
+	}
+	method, params, err := actionRequest(action, windowID, desktop)
+	if err != nil {
+		return err
+	}
+	return callDaemon(SocketPath(), method, params, nil)
+}
+
+// actionRequest maps an action name to its daemon method and params
+func actionRequest(action string, windowID int, desktop int) (string, interface{}, error) {
+	switch action {
+	case "pull":
+		return daemon.MethodPull, daemon.WindowParams{ID: windowID}, nil
+	case "send":
+		if desktop < 0 {
+			return "", nil, fmt.Errorf("send needs a target desktop")
+		}
+		return daemon.MethodMove, daemon.MoveParams{ID: windowID, Desktop: desktop}, nil
+	case "activate":
+		return daemon.MethodActivate, daemon.WindowParams{ID: windowID}, nil
+	case "minimize":
+		return daemon.MethodMinimize, daemon.WindowParams{ID: windowID}, nil
+	case "close":
+		return daemon.MethodClose, daemon.WindowParams{ID: windowID}, nil
+	case "kill":
+		return daemon.MethodKill, daemon.WindowParams{ID: windowID}, nil
+	}
+	if _, err := shared.ParseWindowState(action); err != nil {
+		return "", nil, fmt.Errorf("unknown action %q", action)
+	}
+	return daemon.MethodToggle, daemon.StateParams{ID: windowID, State: action}, nil
+}
+
+// parseWindowID parses a decimal or 0x prefixed hex window ID
+func parseWindowID(window string) (int, error) {
+	id, err := strconv.ParseInt(window, 0, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid window ID %q", window)
+	}
+	return int(id), nil
+}
@@ -0,0 +1,79 @@
+package gofi
+
+import (
+	"testing"
+
+	"gofi/pkg/shared"
+)
+
+func TestRunActionTogglesState(t *testing.T) {
+	_, controller := startTestServer(t)
+
+	if err := RunAction("maximized", "0x2", -1); err != nil {
+		t.Fatalf("RunAction maximized failed: %v", err)
+	}
+	if err := RunAction("minimize", "3", -1); err != nil {
+		t.Fatalf("RunAction minimize failed: %v", err)
+	}
+
+	states := map[int]shared.WindowState{}
+	for _, w := range controller.wm.StackingList() {
+		states[w.ID] = w.State
+	}
+	if states[2] != shared.StateMaximized {
+		t.Errorf("Window 2 state: got %v, want maximized", states[2].Names())
+	}
+	if states[3] != shared.StateHidden {
+		t.Errorf("Window 3 state: got %v, want hidden", states[3].Names())
+	}
+}
+
+func TestRunActionRejectsInvalidArguments(t *testing.T) {
+	startTestServer(t)
+
+	if err := RunAction("wobble", "0x2", -1); err == nil {
+		t.Error("Expected error for unknown action")
+	}
+	if err := RunAction("minimize", "nope", -1); err == nil {
+		t.Error("Expected error for invalid window ID")
+	}
+	if err := RunAction("send", "0x2", -1); err == nil {
+		t.Error("Expected error for send without desktop")
+	}
+}
+
+func TestRunActionMovesWindows(t *testing.T) {
+	_, controller := startTestServer(t)
+
+	if err := RunAction("send", "1", 1); err != nil {
+		t.Fatalf("RunAction send failed: %v", err)
+	}
+	if err := RunAction("pull", "3", -1); err != nil {
+		t.Fatalf("RunAction pull failed: %v", err)
+	}
+
+	desktops := map[int]int{}
+	for _, w := range controller.wm.StackingList() {
+		desktops[w.ID] = w.Desktop
+	}
+	if desktops[1] != 1 {
+		t.Errorf("Window 1 desktop: got %d, want 1", desktops[1])
+	}
+	if desktops[3] != 0 {
+		t.Errorf("Window 3 desktop: got %d, want 0 after pull", desktops[3])
+	}
+	if controller.wm.ActiveWindowID() != 3 {
+		t.Errorf("Active window: got %d, want pulled window 3", controller.wm.ActiveWindowID())
+	}
+}
+
+func TestRunActionKillsWindow(t *testing.T) {
+	_, controller := startTestServer(t)
+
+	if err := RunAction("kill", "0x2", -1); err != nil {
+		t.Fatalf("RunAction kill failed: %v", err)
+	}
+	if kills := controller.wm.Kills(); len(kills) != 1 || kills[0] != 2 {
+		t.Errorf("Expected window 2 to be killed, got %v", kills)
+	}
+}
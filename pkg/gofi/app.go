@@ -0,0 +1,218 @@
+package gofi
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"gofi/pkg/client"
+	"gofi/pkg/daemon"
+	"gofi/pkg/desktop"
+	"gofi/pkg/log"
+	"gofi/pkg/shared"
+)
+
+// App is the long-running gofi daemon. It keeps the window list warm by
+// running a WindowWatcher in the background and shows the selector on request.
+type App struct {
+	wm           desktop.WindowManager
+	recordFile   string               // Path of the session trace, empty to not record
+	closeTimeout time.Duration        // Time a closed window gets, see SetCloseTimeout
+	trace        *os.File             // Open session trace, nil unless recording
+	traceWriter  *desktop.TraceWriter // Shared by the recorders of all connections
+	api          *daemon.API
+	apiMutex     sync.RWMutex // Guards api, the IPC server reads it concurrently
+	watcher      *daemon.WindowWatcher
+	showChan     chan daemon.WindowListParams // Monitor and order of the windows to show
+	quitChan     chan struct{}
+	quitOnce     sync.Once
+}
+
+// NewApp creates a new App instance
+// Returns:
+//
+//	*App: New app instance, not yet started
+func NewApp() *App {
+	return &App{
+		closeTimeout: desktop.DefaultCloseTimeout,
+		showChan:     make(chan daemon.WindowListParams, 1),
+		quitChan:     make(chan struct{}),
+	}
+}
+
+// Start connects to the window manager and starts watching window events
+// Returns:
+//
+//	error: Error if the window manager is unavailable or the watcher fails
+func (app *App) Start() error {
+	if app.wm == nil {
+		wm, err := desktop.Instance()
+		if err != nil {
+			return fmt.Errorf("no window manager connection available: %w", err)
+		}
+		app.wm = wm
+	}
+	if app.recordFile != "" && app.trace == nil {
+		trace, err := os.Create(app.recordFile)
+		if err != nil {
+			return fmt.Errorf("failed to create session trace: %w", err)
+		}
+		log.Info("Recording the session to %s", app.recordFile)
+		app.trace = trace
+		app.traceWriter = desktop.NewTraceWriter(trace)
+		app.wm = desktop.NewRecorder(app.wm, app.traceWriter)
+	}
+	return app.startWatcher()
+}
+
+// SetRecordFile makes Start record the window manager session to a trace
+// file for desktop.Replay. Must be called before Start.
+// Args:
+//
+//	path: Path of the trace file, replaced if it exists
+func (app *App) SetRecordFile(path string) {
+	app.recordFile = path
+}
+
+// SetCloseTimeout sets how long a closed window gets to close. Windows
+// still answering pings are left open after it, previous gofi windows are
+// killed. Must be called before Start.
+// Args:
+//
+//	timeout: Time to wait for a closed window
+func (app *App) SetCloseTimeout(timeout time.Duration) {
+	app.closeTimeout = timeout
+}
+
+// reconnect opens a new window manager connection, recorded to the same
+// trace as the first one
+// Returns:
+//
+//	desktop.WindowManager: The new connection
+//	error: Error if the window manager cannot be reached
+func (app *App) reconnect() (desktop.WindowManager, error) {
+	wm, err := desktop.Reconnect()
+	if err != nil || app.trace == nil {
+		return wm, err
+	}
+	return desktop.NewRecorder(wm, app.traceWriter), nil
+}
+
+// startWatcher creates the API and watcher on top of the window manager
+func (app *App) startWatcher() error {
+	api, err := daemon.NewAPI(app.wm)
+	if err != nil {
+		return fmt.Errorf("failed to create API: %w", err)
+	}
+	api.SetCloseTimeout(app.closeTimeout)
+	watcher, err := daemon.NewWindowWatcher(app.wm, api)
+	if err != nil {
+		return fmt.Errorf("failed to create window watcher: %w", err)
+	}
+	app.watcher = watcher
+	app.watcher.SetReconnect(app.reconnect)
+	if !app.watcher.Start() {
+		return fmt.Errorf("failed to start window watcher")
+	}
+
+	app.apiMutex.Lock()
+	app.api = api
+	app.apiMutex.Unlock()
+	return nil
+}
+
+// API returns the daemon API
+// Returns:
+//
+//	*daemon.API: The API, nil before Start
+func (app *App) API() *daemon.API {
+	app.apiMutex.RLock()
+	defer app.apiMutex.RUnlock()
+	return app.api
+}
+
+// Show requests the window selector to be shown.
+// Requests arriving while the selector is already pending are coalesced.
+// Args:
+//
+//	options: Monitor and sort mode of the shown windows, see daemon.WindowListParams
+func (app *App) Show(options daemon.WindowListParams) {
+	select {
+	case app.showChan <- options:
+	default:
+		log.Debug("Show already pending, ignoring request")
+	}
+}
+
+// Quit asks Run to return. Safe to call multiple times.
+func (app *App) Quit() {
+	app.quitOnce.Do(func() { close(app.quitChan) })
+}
+
+// Run blocks and serves show requests until Quit is called or a
+// termination signal is received.
+func (app *App) Run() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case options := <-app.showChan:
+			app.showSelector(options)
+		case sig := <-signals:
+			log.Info("Received signal %s, shutting down", sig)
+			return
+		case <-app.quitChan:
+			log.Debug("Quit requested, shutting down")
+			return
+		}
+	}
+}
+
+// showSelector runs the selector and activates the selected window
+func (app *App) showSelector(options daemon.WindowListParams) {
+	api := app.API()
+	if api == nil {
+		log.Warn("Window list not available yet, not showing selector")
+		return
+	}
+
+	client.KillExistingGofiWindows(nil, app.closeTimeout)
+	selected := client.SelectWindow(toValues(api.ListWindows(options)), api.Capabilities(), false)
+	if selected == 0 {
+		return
+	}
+	if err := api.ActivateWindow(selected); err != nil {
+		log.Error("Failed to activate window %d: %s", selected, err)
+	}
+}
+
+// Cleanup stops the watcher and closes the session trace
+func (app *App) Cleanup() {
+	if app.watcher != nil {
+		app.watcher.Cleanup()
+	}
+	if app.trace != nil {
+		app.trace.Close()
+	}
+}
+
+// toValues converts a list of window pointers to window values
+// Args:
+//
+//	windows: List of window pointers
+//
+// Returns:
+//
+//	[]shared.Window: List of window values
+func toValues(windows []*shared.Window) []shared.Window {
+	values := make([]shared.Window, 0, len(windows))
+	for _, w := range windows {
+		values = append(values, *w)
+	}
+	return values
+}
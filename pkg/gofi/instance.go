@@ -0,0 +1,235 @@
+package gofi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"gofi/pkg/daemon"
+	"gofi/pkg/log"
+)
+
+const (
+	// socketName is the file name of the IPC socket inside the runtime dir
+	socketName = "gofi.sock"
+
+	// ipcTimeout bounds a single request/response exchange
+	ipcTimeout = 2 * time.Second
+
+	// ipcIdleTimeout closes server connections without requests
+	ipcIdleTimeout = 30 * time.Second
+)
+
+// Controller is the part of the App the IPC server dispatches to
+type Controller interface {
+	Show(options daemon.WindowListParams)
+	Quit()
+	API() *daemon.API
+}
+
+// InstanceManager makes sure only one gofi daemon runs per user.
+// The first instance owns a Unix socket, later instances talk to it.
+type InstanceManager struct {
+	socketPath string
+	listener   net.Listener
+	mutex      sync.Mutex
+}
+
+// NewInstanceManager creates a new InstanceManager for the current user
+// Returns:
+//
+//	*InstanceManager: New instance manager
+func NewInstanceManager() *InstanceManager {
+	return &InstanceManager{socketPath: SocketPath()}
+}
+
+// SocketPath returns the per-user IPC socket path.
+// Uses $XDG_RUNTIME_DIR and falls back to the temp dir with the uid appended.
+// Returns:
+//
+//	string: Absolute socket path
+func SocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, socketName)
+	}
+	name := fmt.Sprintf("gofi-%d.sock", os.Getuid())
+	return filepath.Join(os.TempDir(), name)
+}
+
+// CheckExistingInstance asks a running daemon to show the selector.
+// Removes a stale socket if nothing listens on it anymore. A daemon that
+// is listening but fails the call, e.g. because it speaks another protocol
+// version or is busy, is left alone and reported as an error.
+// Args:
+//
+//	options: Monitor and sort mode of the shown windows, see daemon.WindowListParams
+//
+// Returns:
+//
+//	bool: True if another instance is running and was signaled
+//	error: Error if another instance is running but could not be signaled
+func (im *InstanceManager) CheckExistingInstance(options daemon.WindowListParams) (bool, error) {
+	err := callDaemon(im.socketPath, daemon.MethodShow, options, nil)
+	switch {
+	case err == nil:
+		log.Debug("Existing instance signaled to show")
+		return true, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case errors.Is(err, syscall.ECONNREFUSED):
+		log.Debug("Removing stale socket %s: %s", im.socketPath, err)
+		os.Remove(im.socketPath)
+		return false, nil
+	}
+	return false, fmt.Errorf("gofi daemon on %s did not answer: %w", im.socketPath, err)
+}
+
+// StartIPCServer starts listening on the socket and serves commands
+// Args:
+//
+//	controller: App receiving the dispatched commands
+//
+// Returns:
+//
+//	error: Error if the socket could not be created
+func (im *InstanceManager) StartIPCServer(controller Controller) error {
+	listener, err := net.Listen("unix", im.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", im.socketPath, err)
+	}
+
+	im.mutex.Lock()
+	im.listener = listener
+	im.mutex.Unlock()
+
+	log.Debug("IPC server listening on %s", im.socketPath)
+	go im.acceptLoop(listener, newDispatcher(controller))
+	return nil
+}
+
+// acceptLoop accepts connections until the listener is closed
+func (im *InstanceManager) acceptLoop(listener net.Listener, dispatcher *daemon.Dispatcher) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Debug("IPC server stopped accepting: %s", err)
+			return
+		}
+		go handleConnection(conn, dispatcher)
+	}
+}
+
+// handleConnection serves newline-delimited requests until the client disconnects
+func handleConnection(conn net.Conn, dispatcher *daemon.Dispatcher) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		conn.SetDeadline(time.Now().Add(ipcIdleTimeout))
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			response, sub, after := dispatcher.Dispatch(line)
+			_, werr := conn.Write(append(response, '\n'))
+			if after != nil {
+				after()
+			}
+			if werr != nil {
+				log.Error("Failed to write IPC response: %s", werr)
+				if sub != nil {
+					sub.Cancel() // Nobody will read its events
+				}
+				return
+			}
+			if sub != nil {
+				streamEvents(conn, reader, sub)
+				return
+			}
+		}
+		if err != nil {
+			return // EOF or idle timeout
+		}
+	}
+}
+
+// streamEvents writes events as notifications until the client disconnects
+func streamEvents(conn net.Conn, reader *bufio.Reader, sub *daemon.Subscription) {
+	defer sub.Cancel()
+	conn.SetDeadline(time.Time{})
+
+	// Further input is ignored, reading only detects the disconnect
+	go func() {
+		io.Copy(io.Discard, reader)
+		sub.Cancel()
+	}()
+
+	for event := range sub.Events {
+		if err := writeLine(conn, daemon.NewEventNotification(event)); err != nil {
+			log.Debug("Subscriber disconnected: %s", err)
+			return
+		}
+	}
+}
+
+// Cleanup stops the IPC server and removes the socket
+func (im *InstanceManager) Cleanup() {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	if im.listener == nil {
+		return
+	}
+	im.listener.Close()
+	im.listener = nil
+	os.Remove(im.socketPath)
+}
+
+// StreamEvents subscribes to the running daemon and writes every event
+// as a line of JSON until the daemon goes away
+// Args:
+//
+//	out: Writer receiving the events
+//
+// Returns:
+//
+//	error: Error if the daemon is unreachable or the stream broke
+func StreamEvents(out io.Writer) error {
+	c, err := Dial(SocketPath())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Subscribe(nil); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	for {
+		event, err := c.NextEvent()
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+}
+
+// KillInstance asks the running daemon to quit
+func KillInstance() {
+	var result daemon.QuitResult
+	if err := callDaemon(SocketPath(), daemon.MethodQuit, nil, &result); err != nil {
+		log.Info("No running gofi instance: %s", err)
+		return
+	}
+	log.Debug("Running instance answered: %s", result.Message)
+}
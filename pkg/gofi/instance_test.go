@@ -0,0 +1,245 @@
+package gofi
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gofi/pkg/daemon"
+	"gofi/pkg/desktop"
+	"gofi/pkg/shared"
+)
+
+// fakeController records the calls dispatched by the IPC server
+// and serves a real API on top of the mock window manager
+type fakeController struct {
+	mutex   sync.Mutex
+	shows   int
+	options daemon.WindowListParams
+	quits   int
+	wm      *desktop.MockWindowManager
+	api     *daemon.API
+}
+
+func (f *fakeController) Show(options daemon.WindowListParams) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.shows++
+	f.options = options
+}
+
+func (f *fakeController) Quit() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.quits++
+}
+
+func (f *fakeController) quitCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.quits
+}
+
+func (f *fakeController) API() *daemon.API {
+	return f.api
+}
+
+func startTestServer(t *testing.T) (*InstanceManager, *fakeController) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	im := NewInstanceManager()
+
+	wm := desktop.NewMockWindowManager()
+	api, err := daemon.NewAPI(wm)
+	if err != nil {
+		t.Fatalf("NewAPI failed: %v", err)
+	}
+	controller := &fakeController{wm: wm, api: api}
+	controller.api.InitializeWindowList()
+
+	if err := im.StartIPCServer(controller); err != nil {
+		t.Fatalf("Failed to start IPC server: %v", err)
+	}
+	t.Cleanup(im.Cleanup)
+	return im, controller
+}
+
+func dialTestServer(t *testing.T, im *InstanceManager) *Client {
+	client, err := Dial(im.socketPath)
+	if err != nil {
+		t.Fatalf("Failed to dial daemon: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestCheckExistingInstanceSignalsShow(t *testing.T) {
+	_, controller := startTestServer(t)
+
+	second := NewInstanceManager()
+	running, err := second.CheckExistingInstance(daemon.WindowListParams{Monitor: "DP-1", Sort: daemon.SortStacking})
+	if err != nil || !running {
+		t.Fatalf("Expected running instance to be detected, got %v", err)
+	}
+	if controller.shows != 1 {
+		t.Errorf("Expected one show request, got %d", controller.shows)
+	}
+	if controller.options.Monitor != "DP-1" || controller.options.Sort != daemon.SortStacking {
+		t.Errorf("Show options: got %+v, want DP-1 sorted by stacking", controller.options)
+	}
+}
+
+func TestCheckExistingInstanceWithoutDaemon(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if running, err := NewInstanceManager().CheckExistingInstance(daemon.WindowListParams{}); running || err != nil {
+		t.Errorf("Expected no running instance, got %v", err)
+	}
+}
+
+func TestCheckExistingInstanceRemovesStaleSocket(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	im := NewInstanceManager()
+
+	// A socket left behind by a crashed daemon refuses connections
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: im.socketPath, Net: "unix"})
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	listener.SetUnlinkOnClose(false)
+	listener.Close()
+
+	if running, err := im.CheckExistingInstance(daemon.WindowListParams{}); running || err != nil {
+		t.Errorf("Expected no running instance, got %v", err)
+	}
+	if _, err := os.Stat(im.socketPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the stale socket to be removed, got %v", err)
+	}
+}
+
+func TestCheckExistingInstanceKeepsLiveSocket(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	im := NewInstanceManager()
+
+	// A daemon of another protocol version rejects the handshake
+	listener, err := net.Listen("unix", im.socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadBytes('\n')
+		conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"unsupported protocol version"}}` + "\n"))
+	}()
+
+	running, err := im.CheckExistingInstance(daemon.WindowListParams{})
+	var rpcErr *daemon.Error
+	if running || !errors.As(err, &rpcErr) || rpcErr.Code != daemon.ErrCodeUnsupportedVersion {
+		t.Errorf("Expected the version error to be reported, got %v", err)
+	}
+	if _, err := os.Stat(im.socketPath); err != nil {
+		t.Errorf("Expected the socket of the live daemon to be kept, got %v", err)
+	}
+}
+
+func TestDaemonMethods(t *testing.T) {
+	im, controller := startTestServer(t)
+	client := dialTestServer(t, im)
+
+	var windows []shared.Window
+	if err := client.Call(daemon.MethodWindowList, nil, &windows); err != nil {
+		t.Fatalf("windows.list failed: %v", err)
+	}
+	if len(windows) != 3 {
+		t.Errorf("Unexpected window list: %v", windows)
+	}
+
+	params := daemon.WindowParams{ID: 3}
+	if err := client.Call(daemon.MethodActivate, params, nil); err != nil {
+		t.Fatalf("windows.activate failed: %v", err)
+	}
+	if activations := controller.wm.Activations(); len(activations) != 1 || activations[0] != 3 {
+		t.Errorf("Unexpected activations: %v", activations)
+	}
+
+	var quit daemon.QuitResult
+	if err := client.Call(daemon.MethodQuit, nil, &quit); err != nil {
+		t.Fatalf("daemon.quit failed: %v", err)
+	}
+	if quit.Message != "BYE" {
+		t.Errorf("Unexpected quit result %q", quit.Message)
+	}
+	// Quit is triggered after the response was written
+	deadline := time.Now().Add(time.Second)
+	for controller.quitCount() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if quits := controller.quitCount(); quits != 1 {
+		t.Errorf("Expected one quit, got %d", quits)
+	}
+}
+
+func TestDesktopMethods(t *testing.T) {
+	im, controller := startTestServer(t)
+	client := dialTestServer(t, im)
+
+	if err := client.Call(daemon.MethodSwitch, daemon.DesktopParams{Desktop: 1}, nil); err != nil {
+		t.Fatalf("desktops.switch failed: %v", err)
+	}
+
+	var desktops daemon.DesktopsResult
+	if err := client.Call(daemon.MethodDesktops, nil, &desktops); err != nil {
+		t.Fatalf("desktops.list failed: %v", err)
+	}
+	if desktops.Count != 2 || desktops.Current != 1 || desktops.Names[1] != "work" {
+		t.Errorf("Unexpected desktops: %+v", desktops)
+	}
+
+	err := client.Call(daemon.MethodSwitch, daemon.DesktopParams{Desktop: 5}, nil)
+	if rpcErr, ok := err.(*daemon.Error); !ok || rpcErr.Code != daemon.ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params error, got %v", err)
+	}
+	if controller.wm.CurrentDesktop() != 1 {
+		t.Errorf("Failed switch changed the desktop to %d", controller.wm.CurrentDesktop())
+	}
+}
+
+func TestUnknownMethodReturnsTypedError(t *testing.T) {
+	im, _ := startTestServer(t)
+
+	err := callDaemon(im.socketPath, "no.such.method", nil, nil)
+	rpcErr, ok := err.(*daemon.Error)
+	if !ok {
+		t.Fatalf("Expected *daemon.Error, got %T: %v", err, err)
+	}
+	if rpcErr.Code != daemon.ErrCodeMethodNotFound {
+		t.Errorf("Expected code %d, got %d", daemon.ErrCodeMethodNotFound, rpcErr.Code)
+	}
+}
+
+func TestSubscribeStreamsEvents(t *testing.T) {
+	im, controller := startTestServer(t)
+	client := dialTestServer(t, im)
+
+	if err := client.Subscribe([]daemon.EventType{daemon.EventWindowAdded}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	controller.wm.AddWindow(shared.NewWindow(4, "Mail", "thunderbird", "Normal", "Mail", 0, 42))
+	controller.api.UpdateWindowList()
+
+	event, err := client.NextEvent()
+	if err != nil {
+		t.Fatalf("NextEvent failed: %v", err)
+	}
+	if event.Type != daemon.EventWindowAdded || event.Window.Title != "Mail" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
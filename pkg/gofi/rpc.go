@@ -0,0 +1,197 @@
+package gofi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"gofi/pkg/daemon"
+)
+
+// newDispatcher registers every daemon method on a dispatcher
+// Args:
+//
+//	controller: App the methods act on
+//
+// Returns:
+//
+//	*daemon.Dispatcher: Dispatcher with all methods registered
+func newDispatcher(controller Controller) *daemon.Dispatcher {
+	d := daemon.NewDispatcher()
+	daemon.RegisterAPIMethods(d, controller.API)
+	d.Register(daemon.MethodShow, func(params json.RawMessage) (interface{}, *daemon.Error) {
+		var p daemon.WindowListParams
+		if err := daemon.DecodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		controller.Show(p)
+		return true, nil
+	})
+	d.Register(daemon.MethodQuit, func(json.RawMessage) (interface{}, *daemon.Error) {
+		// Quit only after the client got its answer, the daemon may exit right away
+		result, err := daemon.HandleQuit()
+		return daemon.AfterResponse{Result: result, Action: controller.Quit}, err
+	})
+	return d
+}
+
+// Client is a connection to the daemon's IPC socket
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+// Dial connects to the daemon and performs the version handshake
+// Args:
+//
+//	socketPath: Path of the daemon socket
+//
+// Returns:
+//
+//	*Client: Connected client
+//	error: Error if the daemon is unreachable or speaks another protocol version
+func Dial(socketPath string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", socketPath, ipcTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, reader: bufio.NewReader(conn)}
+
+	var result daemon.HandshakeResult
+	params := daemon.HandshakeParams{ProtocolVersion: daemon.ProtocolVersion}
+	if err := c.Call(daemon.MethodHandshake, params, &result); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Call sends a request and decodes the result
+// Args:
+//
+//	method: Method name
+//	params: Params to send, may be nil
+//	result: Pointer to decode the result into, may be nil
+//
+// Returns:
+//
+//	error: Transport error or *daemon.Error returned by the daemon
+func (c *Client) Call(method string, params, result interface{}) error {
+	c.nextID++
+	req, err := daemon.NewRequest(c.nextID, method, params)
+	if err != nil {
+		return err
+	}
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// roundTrip writes a request line and reads the matching response line
+func (c *Client) roundTrip(req daemon.Request) (*daemon.Response, error) {
+	c.conn.SetDeadline(time.Now().Add(ipcTimeout))
+	if err := writeLine(c.conn, req); err != nil {
+		return nil, fmt.Errorf("failed to send %s: %w", req.Method, err)
+	}
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response to %s: %w", req.Method, err)
+	}
+	var resp daemon.Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("malformed response to %s: %w", req.Method, err)
+	}
+	if resp.ID != req.ID {
+		return nil, fmt.Errorf("response ID %d does not match request ID %d", resp.ID, req.ID)
+	}
+	return &resp, nil
+}
+
+// Subscribe turns the connection into an event stream
+// Args:
+//
+//	types: Event types to receive, all types if empty
+//
+// Returns:
+//
+//	error: Error if the daemon refused the subscription
+func (c *Client) Subscribe(types []daemon.EventType) error {
+	params := daemon.SubscribeParams{Events: types}
+	if err := c.Call(daemon.MethodSubscribe, params, nil); err != nil {
+		return err
+	}
+	c.conn.SetDeadline(time.Time{}) // Events may be far apart
+	return nil
+}
+
+// NextEvent blocks until the next event arrives on a subscribed connection
+// Returns:
+//
+//	daemon.Event: The received event
+//	error: Error if the connection was closed or the message is malformed
+func (c *Client) NextEvent() (daemon.Event, error) {
+	var notification struct {
+		Method string       `json:"method"`
+		Params daemon.Event `json:"params"`
+	}
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return daemon.Event{}, err
+	}
+	if err := json.Unmarshal(line, &notification); err != nil {
+		return daemon.Event{}, fmt.Errorf("malformed event: %w", err)
+	}
+	if notification.Method != daemon.MethodEvent {
+		return daemon.Event{}, fmt.Errorf("unexpected notification %q", notification.Method)
+	}
+	return notification.Params, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+// callDaemon dials the daemon, performs a single call and disconnects
+// Args:
+//
+//	socketPath: Path of the daemon socket
+//	method: Method name
+//	params: Params to send, may be nil
+//	result: Pointer to decode the result into, may be nil
+//
+// Returns:
+//
+//	error: Error if the call failed
+func callDaemon(socketPath, method string, params, result interface{}) error {
+	c, err := Dial(socketPath)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Call(method, params, result)
+}
+
+// writeLine writes a value as a single line of JSON
+func writeLine(conn net.Conn, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,73 @@
+package shared
+
+// Geometry is a rectangle in root window coordinates
+// Fields:
+//
+//	X: Left edge
+//	Y: Top edge
+//	Width: Width in pixels
+//	Height: Height in pixels
+type Geometry struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Empty checks if the rectangle has no area
+// Returns:
+//
+//	bool: True if width or height is not positive
+func (g Geometry) Empty() bool {
+	return g.Width <= 0 || g.Height <= 0
+}
+
+// Overlap computes the area shared with another rectangle
+// Args:
+//
+//	other: Rectangle to intersect with
+//
+// Returns:
+//
+//	int: Shared area in pixels, 0 if they do not intersect
+func (g Geometry) Overlap(other Geometry) int {
+	width := min(g.X+g.Width, other.X+other.Width) - max(g.X, other.X)
+	height := min(g.Y+g.Height, other.Y+other.Height) - max(g.Y, other.Y)
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	return width * height
+}
+
+// Monitor is a physical output, e.g. a RandR output like "DP-1"
+// Fields:
+//
+//	Name: Output name
+//	Geometry: Area of the output in root window coordinates
+//	Primary: True for the primary output
+type Monitor struct {
+	Name     string   `json:"name"`
+	Geometry Geometry `json:"geometry"`
+	Primary  bool     `json:"primary"`
+}
+
+// MonitorFor finds the monitor showing most of a rectangle
+// Args:
+//
+//	geometry: Rectangle, usually a window frame
+//	monitors: Available monitors
+//
+// Returns:
+//
+//	string: Name of the monitor, empty if the rectangle is on none of them
+func MonitorFor(geometry Geometry, monitors []Monitor) string {
+	name := ""
+	best := 0
+	for _, m := range monitors {
+		if overlap := geometry.Overlap(m.Geometry); overlap > best {
+			name = m.Name
+			best = overlap
+		}
+	}
+	return name
+}
@@ -0,0 +1,43 @@
+package shared
+
+import "testing"
+
+func TestMonitorFor(t *testing.T) {
+	monitors := []Monitor{
+		{Name: "DP-1", Geometry: Geometry{X: 0, Y: 0, Width: 1920, Height: 1080}},
+		{Name: "DP-2", Geometry: Geometry{X: 1920, Y: 0, Width: 2560, Height: 1440}},
+	}
+
+	tests := []struct {
+		name     string
+		geometry Geometry
+		want     string
+	}{
+		{"inside first", Geometry{X: 100, Y: 100, Width: 800, Height: 600}, "DP-1"},
+		{"inside second", Geometry{X: 2000, Y: 100, Width: 800, Height: 600}, "DP-2"},
+		{"mostly on second", Geometry{X: 1800, Y: 0, Width: 800, Height: 600}, "DP-2"},
+		{"off screen", Geometry{X: -900, Y: 0, Width: 800, Height: 600}, ""},
+		{"empty", Geometry{}, ""},
+	}
+	for _, tt := range tests {
+		if got := MonitorFor(tt.geometry, monitors); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWindowGeometryJSON(t *testing.T) {
+	window := Window{ID: 1, Geometry: Geometry{X: 10, Y: 20, Width: 300, Height: 200}, Monitor: "DP-1"}
+	data, err := window.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal window: %v", err)
+	}
+
+	var decoded Window
+	if err := decoded.UnmarshalJSON(data); err != nil {
+		t.Fatalf("Failed to unmarshal window: %v", err)
+	}
+	if decoded.Geometry != window.Geometry || decoded.Monitor != window.Monitor {
+		t.Errorf("Round trip mismatch: got %+v, want %+v", decoded, window)
+	}
+}
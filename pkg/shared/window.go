@@ -14,15 +14,25 @@ import (
 //	Type: Window type
 //	Instance: Window instance
 //	Desktop: Desktop number
+//	DesktopName: Desktop name, empty if the WM does not name desktops
 //	PID: Process ID
+//	State: _NET_WM_STATE flags
+//	Geometry: Frame-inclusive position and size in root window coordinates
+//	Monitor: Name of the output showing most of the window, empty if unknown
+//	NotResponding: True if the client did not answer the last _NET_WM_PING in time
 type Window struct {
-	ID        int    `json:"id"`
-	Title     string `json:"title"`
-	ClassName string `json:"class_name"`
-	Type      string `json:"type"`
-	Instance  string `json:"instance"`
-	Desktop   int    `json:"desktop"`
-	PID       int    `json:"pid"`
+	ID            int         `json:"id"`
+	Title         string      `json:"title"`
+	ClassName     string      `json:"class_name"`
+	Type          string      `json:"type"`
+	Instance      string      `json:"instance"`
+	Desktop       int         `json:"desktop"`
+	DesktopName   string      `json:"desktop_name,omitempty"`
+	PID           int         `json:"pid"`
+	State         WindowState `json:"state,omitempty"`
+	Geometry      Geometry    `json:"geometry,omitempty"`
+	Monitor       string      `json:"monitor,omitempty"`
+	NotResponding bool        `json:"not_responding,omitempty"`
 }
 
 // HexID returns the window ID in hex format for wmctrl
@@ -33,17 +43,40 @@ func (w Window) HexID() string {
 	return fmt.Sprintf("0x%x", w.ID)
 }
 
-// DesktopStr returns the desktop number for display in selector
+// DesktopStr returns the desktop for display in selector
 // Returns:
 //
-//	string: Desktop number in format [X] or [S] if invalid
+//	string: Desktop name or number in format [X], or [S] if invalid
 func (w Window) DesktopStr() string {
 	if w.Desktop < 0 || w.Desktop > 99 {
 		return "[S]"
 	}
+	if w.DesktopName != "" {
+		return fmt.Sprintf("[%s]", w.DesktopName)
+	}
 	return fmt.Sprintf("[%d]", w.Desktop)
 }
 
+// StateStr returns a short marker of the most relevant state for display in selector
+// Returns:
+//
+//	string: "?" not responding, "!" demands attention, "_" hidden, "F" fullscreen, "M" maximized, or ""
+func (w Window) StateStr() string {
+	switch {
+	case w.NotResponding:
+		return "?"
+	case w.State.Has(StateDemandsAttention):
+		return "!"
+	case w.State.Has(StateHidden):
+		return "_"
+	case w.State.Has(StateFullscreen):
+		return "F"
+	case w.State.Has(StateMaximized):
+		return "M"
+	}
+	return ""
+}
+
 // String returns a string representation of the window
 // Returns:
 //
@@ -85,23 +118,17 @@ func NewWindow(id int, title, className, typeStr, instance string, desktop, pid
 //	[]byte: JSON representation of Window
 //	error: Any error that occurred
 func (w Window) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		ID        int    `json:"id"`
-		Title     string `json:"title"`
-		ClassName string `json:"class_name"`
-		Type      string `json:"type"`
-		Instance  string `json:"instance"`
-		Desktop   int    `json:"desktop"`
-		PID       int    `json:"pid"`
+	type Alias Window
+	aux := struct {
+		Alias
+		Geometry *Geometry `json:"geometry,omitempty"` // Left out if unknown
 	}{
-		ID:        w.ID,
-		Title:     w.Title,
-		ClassName: w.ClassName,
-		Type:      w.Type,
-		Instance:  w.Instance,
-		Desktop:   w.Desktop,
-		PID:       w.PID,
-	})
+		Alias: Alias(w),
+	}
+	if w.Geometry != (Geometry{}) {
+		aux.Geometry = &w.Geometry
+	}
+	return json.Marshal(aux)
 }
 
 // UnmarshalJSON implements json.Unmarshaler interface
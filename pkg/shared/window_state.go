@@ -0,0 +1,148 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gofi/pkg/log"
+)
+
+// WindowState is a set of EWMH _NET_WM_STATE flags.
+// It is a bit set so Window stays comparable, and encodes to JSON
+// as a list of state names.
+type WindowState uint32
+
+const (
+	StateModal WindowState = 1 << iota
+	StateSticky
+	StateMaximizedVert
+	StateMaximizedHorz
+	StateShaded
+	StateSkipTaskbar
+	StateSkipPager
+	StateHidden
+	StateFullscreen
+	StateAbove
+	StateBelow
+	StateDemandsAttention
+	StateFocused
+
+	// StateMaximized is both maximized flags
+	StateMaximized = StateMaximizedVert | StateMaximizedHorz
+)
+
+// stateNames maps each flag to its name, which is the lower case suffix
+// of the corresponding _NET_WM_STATE_* atom
+var stateNames = []struct {
+	flag WindowState
+	name string
+}{
+	{StateModal, "modal"},
+	{StateSticky, "sticky"},
+	{StateMaximizedVert, "maximized_vert"},
+	{StateMaximizedHorz, "maximized_horz"},
+	{StateShaded, "shaded"},
+	{StateSkipTaskbar, "skip_taskbar"},
+	{StateSkipPager, "skip_pager"},
+	{StateHidden, "hidden"},
+	{StateFullscreen, "fullscreen"},
+	{StateAbove, "above"},
+	{StateBelow, "below"},
+	{StateDemandsAttention, "demands_attention"},
+	{StateFocused, "focused"},
+}
+
+// Has checks if all given flags are set
+// Args:
+//
+//	flags: Flags to check
+//
+// Returns:
+//
+//	bool: True if every flag is set
+func (s WindowState) Has(flags WindowState) bool {
+	return flags != 0 && s&flags == flags
+}
+
+// Names returns the names of all set flags in a stable order
+// Returns:
+//
+//	[]string: State names, empty if no flag is set
+func (s WindowState) Names() []string {
+	names := make([]string, 0)
+	for _, sn := range stateNames {
+		if s&sn.flag != 0 {
+			names = append(names, sn.name)
+		}
+	}
+	return names
+}
+
+// AllWindowStates returns every single flag with its name
+// Returns:
+//
+//	map[string]WindowState: Flags by state name
+func AllWindowStates() map[string]WindowState {
+	states := make(map[string]WindowState, len(stateNames))
+	for _, sn := range stateNames {
+		states[sn.name] = sn.flag
+	}
+	return states
+}
+
+// ParseWindowState looks up a single flag by name
+// Args:
+//
+//	name: State name, e.g. "hidden" or "maximized"
+//
+// Returns:
+//
+//	WindowState: The flag
+//	error: Error if the name is unknown
+func ParseWindowState(name string) (WindowState, error) {
+	if name == "maximized" {
+		return StateMaximized, nil
+	}
+	for _, sn := range stateNames {
+		if sn.name == name {
+			return sn.flag, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown window state %q", name)
+}
+
+// MarshalJSON implements json.Marshaler interface
+// Returns:
+//
+//	[]byte: JSON list of state names
+//	error: Any error that occurred
+func (s WindowState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Names())
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+// Unknown state names are skipped, so a client keeps working with a daemon
+// that knows more states.
+// Args:
+//
+//	data: JSON list of state names
+//
+// Returns:
+//
+//	error: Error if the data is not a list of strings
+func (s *WindowState) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*s = 0
+	for _, name := range names {
+		flag, err := ParseWindowState(name)
+		if err != nil {
+			log.Debug("Skipping unknown window state %q", name)
+			continue
+		}
+		*s |= flag
+	}
+	return nil
+}
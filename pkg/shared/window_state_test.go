@@ -0,0 +1,81 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWindowStateJSON(t *testing.T) {
+	window := Window{ID: 1, State: StateHidden | StateSkipTaskbar}
+
+	data, err := json.Marshal(window)
+	if err != nil {
+		t.Fatalf("Failed to marshal window: %v", err)
+	}
+	want := `{"id":1,"title":"","class_name":"","type":"","instance":"","desktop":0,"pid":0,"state":["skip_taskbar","hidden"]}`
+	if string(data) != want {
+		t.Errorf("Marshal() got = %s, want %s", data, want)
+	}
+
+	var got Window
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed to unmarshal window: %v", err)
+	}
+	if got != window {
+		t.Errorf("Round trip mismatch: got %v, want %v", got, window)
+	}
+}
+
+func TestWindowStateUnknownName(t *testing.T) {
+	var state WindowState
+	if err := json.Unmarshal([]byte(`["hidden","wobbly"]`), &state); err != nil {
+		t.Fatalf("Expected unknown state name to be skipped, got %v", err)
+	}
+	if state != StateHidden {
+		t.Errorf("Expected only hidden to be set, got %v", state.Names())
+	}
+	if err := json.Unmarshal([]byte(`"hidden"`), &state); err == nil {
+		t.Error("Expected error for a state that is not a list")
+	}
+}
+
+func TestWindowStateHas(t *testing.T) {
+	state := StateMaximizedVert | StateAbove
+
+	if !state.Has(StateAbove) {
+		t.Error("Expected above to be set")
+	}
+	if state.Has(StateMaximized) {
+		t.Error("Expected maximized to need both directions")
+	}
+	if state.Has(0) {
+		t.Error("Expected empty flag set to never match")
+	}
+}
+
+func TestWindowStateStr(t *testing.T) {
+	tests := []struct {
+		state WindowState
+		want  string
+	}{
+		{0, ""},
+		{StateHidden, "_"},
+		{StateHidden | StateDemandsAttention, "!"},
+		{StateFullscreen, "F"},
+		{StateMaximized, "M"},
+		{StateMaximizedHorz, ""},
+	}
+
+	for _, tt := range tests {
+		window := Window{State: tt.state}
+		if got := window.StateStr(); got != tt.want {
+			t.Errorf("StateStr() for %v: got %q, want %q", tt.state.Names(), got, tt.want)
+		}
+	}
+
+	// Hung windows are marked whatever their state
+	window := Window{State: StateHidden | StateDemandsAttention, NotResponding: true}
+	if got := window.StateStr(); got != "?" {
+		t.Errorf("StateStr() for hung window: got %q, want \"?\"", got)
+	}
+}
@@ -98,6 +98,25 @@ func TestWindowDesktopStr(t *testing.T) {
 	}
 }
 
+func TestWindowDesktopStrWithName(t *testing.T) {
+	tests := []struct {
+		desktop int
+		name    string
+		want    string
+	}{
+		{3, "mail", "[mail]"},
+		{3, "", "[3]"},
+		{-1, "mail", "[S]"},
+	}
+
+	for _, tt := range tests {
+		window := Window{Desktop: tt.desktop, DesktopName: tt.name}
+		if got := window.DesktopStr(); got != tt.want {
+			t.Errorf("DesktopStr() for %d/%q: got %s, want %s", tt.desktop, tt.name, got, tt.want)
+		}
+	}
+}
+
 func TestWindowUnmarshal(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -251,3 +270,32 @@ func TestWindowMarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestWindowJSONRoundTripAllFields(t *testing.T) {
+	window := Window{
+		ID:            123,
+		Title:         "Test Window",
+		ClassName:     "TestClass",
+		Type:          "Normal",
+		Instance:      "test-instance",
+		Desktop:       1,
+		DesktopName:   "work",
+		PID:           456,
+		State:         StateMaximized | StateAbove,
+		Geometry:      Geometry{X: 10, Y: 20, Width: 800, Height: 600},
+		Monitor:       "DP-1",
+		NotResponding: true,
+	}
+
+	data, err := json.Marshal(window)
+	if err != nil {
+		t.Fatalf("Failed to marshal window: %v", err)
+	}
+	var unmarshaled Window
+	if err := json.Unmarshal(data, &unmarshaled); err != nil {
+		t.Fatalf("Failed to unmarshal window: %v", err)
+	}
+	if unmarshaled != window {
+		t.Errorf("Round trip through %s lost fields: got %+v, want %+v", data, unmarshaled, window)
+	}
+}